@@ -35,13 +35,18 @@ func (b *BasicRpcResponse) SetError(err error) error {
 type ErrorCode string
 
 const (
-	UnknownError        = "UnknownError"
-	RoomNotFoundError   = "RoomNotFoundError"
-	RoomCloseError      = "RoomCloseError"
-	NetWorkTimeoutError = "NetWorkTimeoutError"
-	MessageContentError = "MessageContentError"
-	ServeError          = "ServeError"
-	ClientError         = "ClientError"
+	UnknownError             = "UnknownError"
+	RoomNotFoundError        = "RoomNotFoundError"
+	RoomCloseError           = "RoomCloseError"
+	NetWorkTimeoutError      = "NetWorkTimeoutError"
+	MessageContentError      = "MessageContentError"
+	ServeError               = "ServeError"
+	ClientError              = "ClientError"
+	QuotaExceededError       = "QuotaExceededError"
+	TooManyRequestError      = "TooManyRequestError"
+	InvalidLogError          = "InvalidLogError"
+	UnsupportedEncodingError = "UnsupportedEncodingError"
+	PermissionDeniedError    = "PermissionDeniedError"
 )
 
 type Error struct {
@@ -90,3 +95,23 @@ func NewServeError(msg string, a ...any) *Error {
 func NewClientError(msg string, a ...any) *Error {
 	return NewErrorWithCode(fmt.Sprintf(msg, a...), ClientError)
 }
+
+func NewQuotaExceededError(msg string, a ...any) *Error {
+	return NewErrorWithCode(fmt.Sprintf(msg, a...), QuotaExceededError)
+}
+
+func NewTooManyRequestError(msg string, a ...any) *Error {
+	return NewErrorWithCode(fmt.Sprintf(msg, a...), TooManyRequestError)
+}
+
+func NewInvalidLogError(msg string, a ...any) *Error {
+	return NewErrorWithCode(fmt.Sprintf(msg, a...), InvalidLogError)
+}
+
+func NewUnsupportedEncodingError(msg string, a ...any) *Error {
+	return NewErrorWithCode(fmt.Sprintf(msg, a...), UnsupportedEncodingError)
+}
+
+func NewPermissionDeniedError(msg string, a ...any) *Error {
+	return NewErrorWithCode(fmt.Sprintf(msg, a...), PermissionDeniedError)
+}
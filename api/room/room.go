@@ -2,11 +2,13 @@ package room
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/HuolalaTech/page-spy-api/api/event"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -51,6 +53,8 @@ type Message struct {
 	CreatedAt int64       `json:"createdAt"`
 	RequestId string      `json:"requestId"`
 	Content   interface{} `json:"content"`
+	// Replayed 新连接加入后补发的历史消息
+	Replayed bool `json:"replayed,omitempty"`
 }
 
 func (m *Message) GetPong() *Message {
@@ -210,6 +214,8 @@ type BroadcastMessageContent struct {
 	Data        json.RawMessage `json:"data"`
 	From        *Connection     `json:"from"`
 	IncludeSelf bool            `json:"includeSelf"`
+	// ToRole 只发给该角色的连接，为空时发给所有连接
+	ToRole string `json:"toRole,omitempty"`
 }
 
 func NewBroadcastMessage(data json.RawMessage, from *Connection) *Message {
@@ -235,11 +241,28 @@ func NewSendMessage(data json.RawMessage, from *Connection, to *Connection) *Mes
 	}
 }
 
+const (
+	ClientRole   = "client"
+	DebuggerRole = "debugger"
+	ObserverRole = "observer"
+)
+
+func IsRole(role string) bool {
+	switch role {
+	case ClientRole, DebuggerRole, ObserverRole:
+		return true
+	}
+
+	return false
+}
+
 type Connection struct {
 	Address   *event.Address `json:"address"`
 	CreatedAt time.Time      `json:"createdAt"`
 	UserID    string         `json:"userId"`
 	Name      string         `json:"name"`
+	// Role 加入时确定的角色：client 为 SDK，debugger 为调试端，observer 只读
+	Role string `json:"role"`
 }
 
 type BasicInfo struct {
@@ -255,6 +278,82 @@ type Info struct {
 	CreatedAt   time.Time      `json:"createdAt"`
 	ActiveAt    time.Time      `json:"activeAt"`
 	Connections []*Connection  `json:"connections"`
+	// SecretHash 持久化的密码哈希，重启恢复的房间只有哈希没有明文
+	SecretHash string `json:"secretHash,omitempty"`
+	// Timeouts 房间生效的超时设置
+	Timeouts *Timeouts `json:"timeouts"`
+	// ExpireAt 按房间当前状态推算的关闭时间
+	ExpireAt time.Time `json:"expireAt"`
+	// Replay 是否缓存消息补发给新加入的连接，为空时使用服务端配置
+	Replay *bool `json:"replay,omitempty"`
+	// Record 是否录制房间消息，关闭后保存为日志，为空时按服务端的标签规则
+	Record *bool `json:"record,omitempty"`
+	// RoleCounts 每种角色的连接数，只在房间列表中返回
+	RoleCounts map[string]int `json:"roleCounts,omitempty"`
+	// ClientToken 创建房间时生成，只返回给创建者，SDK 以 client 角色加入时用来证明身份
+	ClientToken string `json:"clientToken,omitempty"`
+}
+
+// Detail 管理接口返回的房间详情
+type Detail struct {
+	Info        *Info               `json:"info"`
+	Connections []*ConnectionDetail `json:"connections"`
+	// MessageCounts 经过房间的各类型消息数，单播消息直接发给目标连接，不计入
+	MessageCounts map[string]int64 `json:"messageCounts"`
+}
+
+type ConnectionDetail struct {
+	*Connection
+	// ActiveAt 连接最后一次发送广播的时间，没有发送过时为加入时间
+	ActiveAt time.Time `json:"activeAt"`
+}
+
+// Timeouts 房间的超时设置，单位秒
+type Timeouts struct {
+	// 房间没有连接的最长时间
+	EmptyTimeoutOfSecond int64 `json:"emptyTimeoutOfSecond"`
+	// 房间没有消息的最长时间
+	IdleTimeoutOfSecond int64 `json:"idleTimeoutOfSecond"`
+	// 房间从创建开始的最长存活时间
+	LifeTimeOfSecond int64 `json:"lifeTimeOfSecond"`
+}
+
+func (t *Timeouts) EmptyTimeout() time.Duration {
+	return time.Duration(t.EmptyTimeoutOfSecond) * time.Second
+}
+
+func (t *Timeouts) IdleTimeout() time.Duration {
+	return time.Duration(t.IdleTimeoutOfSecond) * time.Second
+}
+
+func (t *Timeouts) LifeTime() time.Duration {
+	return time.Duration(t.LifeTimeOfSecond) * time.Second
+}
+
+func HashSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckSecret 有明文时直接比较，否则与哈希比较
+func (i *Info) CheckSecret(secret string) bool {
+	if i.Secret != "" {
+		return i.Secret == secret
+	}
+
+	if i.SecretHash == "" || secret == "" {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(i.SecretHash), []byte(secret)) == nil
+}
+
+func (i *Info) CheckClientToken(token string) bool {
+	return i.ClientToken != "" && subtle.ConstantTimeCompare([]byte(i.ClientToken), []byte(token)) == 1
 }
 
 func (i *Info) Update(info *Info) {
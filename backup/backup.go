@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/logger"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+var log = logger.Log().WithField("module", "backup")
+
+// ndjsonFile 记录先写入临时文件，写完后才能确定 tar 中的文件大小
+type ndjsonFile struct {
+	file    *os.File
+	encoder *json.Encoder
+	count   int
+}
+
+func newNdjsonFile() (*ndjsonFile, error) {
+	file, err := os.CreateTemp("", "page-spy-backup-*.ndjson")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ndjsonFile{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+func (n *ndjsonFile) write(v any) error {
+	n.count++
+	return n.encoder.Encode(v)
+}
+
+func (n *ndjsonFile) remove() {
+	n.file.Close()
+	os.Remove(n.file.Name())
+}
+
+func (n *ndjsonFile) writeTo(tw *tar.Writer, name string) error {
+	size, err := n.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	return writeTarFile(tw, name, size, n.file)
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(tw, r, size)
+	return err
+}
+
+// writeBlob 写入日志文件内容，存储中读取不到的文件返回 false
+func writeBlob(tw *tar.Writer, st storage.StorageApi, fileId string) (bool, error) {
+	file, err := st.GetLog(fileId)
+	if err != nil {
+		log.Warnf("backup file %s not found in storage: %s", fileId, err.Error())
+		return false, nil
+	}
+
+	defer file.FileSteam.Close()
+	return true, writeTarFile(tw, blobDir+fileId, file.Size, file.FileSteam)
+}
+
+func backupLogs(d data.DataApi, st storage.StorageApi, tw *tar.Writer, manifest *Manifest, records *ndjsonFile) error {
+	blobs := map[string]struct{}{}
+	var afterId uint
+	for {
+		logs, err := d.FindLogsForBackup(afterId, pageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(logs) <= 0 {
+			return nil
+		}
+
+		for _, l := range logs {
+			afterId = l.ID
+			err := records.write(newLogRecord(l))
+			if err != nil {
+				return err
+			}
+
+			// 回收站中的记录可能与现有记录共用同一个文件
+			if _, ok := blobs[l.FileId]; ok || l.Status != data.Saved {
+				continue
+			}
+
+			blobs[l.FileId] = struct{}{}
+			ok, err := writeBlob(tw, st, l.FileId)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				manifest.MissingBlobs = append(manifest.MissingBlobs, l.FileId)
+				continue
+			}
+
+			manifest.Blobs++
+		}
+	}
+}
+
+func backupLogGroups(d data.DataApi, records *ndjsonFile) error {
+	var afterId uint
+	for {
+		logGroups, err := d.FindLogGroupsForBackup(afterId, pageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(logGroups) <= 0 {
+			return nil
+		}
+
+		for _, g := range logGroups {
+			afterId = g.ID
+			err := records.write(newGroupRecord(g))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func backupNotes(d data.DataApi, records *ndjsonFile) error {
+	var afterId uint
+	for {
+		notes, err := d.FindNotesForBackup(afterId, pageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(notes) <= 0 {
+			return nil
+		}
+
+		for _, n := range notes {
+			afterId = n.ID
+			err := records.write(newNoteRecord(n))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func backupUploadKeys(d data.DataApi, records *ndjsonFile) error {
+	var afterId uint
+	for {
+		keys, err := d.FindUploadKeysForBackup(afterId, pageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(keys) <= 0 {
+			return nil
+		}
+
+		for _, k := range keys {
+			afterId = k.ID
+			err := records.write(newUploadKeyRecord(k))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func backupShareLinks(d data.DataApi, records *ndjsonFile) error {
+	var afterId uint
+	for {
+		shares, err := d.FindShareLinksForBackup(afterId, pageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(shares) <= 0 {
+			return nil
+		}
+
+		for _, s := range shares {
+			afterId = s.ID
+			err := records.write(newShareRecord(s))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Backup 将全部日志、日志组、批注、上传密钥、分享链接记录和日志文件写入 tar.gz 归档
+// 归档中依次为 blobs/<fileId>、logs.ndjson、groups.ndjson、notes.ndjson、upload_keys.ndjson、shares.ndjson 和 manifest.json，
+// 恢复时按顺序读取即可保证文件先于记录写入
+func Backup(d data.DataApi, st storage.StorageApi, w io.Writer) (*Manifest, error) {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	manifest := &Manifest{
+		Version:   formatVersion,
+		CreatedAt: time.Now(),
+	}
+
+	logs, err := newNdjsonFile()
+	if err != nil {
+		return nil, err
+	}
+	defer logs.remove()
+
+	groups, err := newNdjsonFile()
+	if err != nil {
+		return nil, err
+	}
+	defer groups.remove()
+
+	notes, err := newNdjsonFile()
+	if err != nil {
+		return nil, err
+	}
+	defer notes.remove()
+
+	keys, err := newNdjsonFile()
+	if err != nil {
+		return nil, err
+	}
+	defer keys.remove()
+
+	shares, err := newNdjsonFile()
+	if err != nil {
+		return nil, err
+	}
+	defer shares.remove()
+
+	err = backupLogs(d, st, tw, manifest, logs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = backupLogGroups(d, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	err = backupNotes(d, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = backupUploadKeys(d, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = backupShareLinks(d, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.Logs = logs.count
+	manifest.Groups = groups.count
+	manifest.Notes = notes.count
+	manifest.UploadKeys = keys.count
+	manifest.Shares = shares.count
+	err = logs.writeTo(tw, logsName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = groups.writeTo(tw, groupsName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = notes.writeTo(tw, notesName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = keys.writeTo(tw, keysName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = shares.writeTo(tw, sharesName)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeTarFile(tw, manifestName, int64(len(bs)), bytes.NewReader(bs))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, gw.Close()
+}
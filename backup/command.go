@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/container"
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+// RunBackup 处理 backup 子命令
+func RunBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", fmt.Sprintf("page-spy-backup-%s.tar.gz", time.Now().Format("20060102150405")), "backup archive path")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	return container.Container().Invoke(func(st storage.StorageApi, d data.DataApi) error {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		w := bufio.NewWriter(file)
+		manifest, err := Backup(d, st, w)
+		if err != nil {
+			os.Remove(*output)
+			return err
+		}
+
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+
+		log.Infof("backup to %s success, logs %d, groups %d, notes %d, upload keys %d, shares %d, files %d, missing files %d",
+			*output, manifest.Logs, manifest.Groups, manifest.Notes, manifest.UploadKeys, manifest.Shares, manifest.Blobs, len(manifest.MissingBlobs))
+		return nil
+	})
+}
+
+// RunRestore 处理 restore 子命令，恢复期间不要让服务使用同一个数据库
+func RunRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("i", "", "backup archive path")
+	remap := Remap{}
+	flags.Var(remap, "remap", "replace machine id prefix, e.g. A0=local")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *input == "" {
+		return fmt.Errorf("restore archive is required, use -i <path>")
+	}
+
+	return container.Container().Invoke(func(cfg *config.Config, st storage.StorageApi, d data.DataApi) error {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		result, err := Restore(d, st, bufio.NewReader(file), remap)
+		if err != nil {
+			return err
+		}
+
+		if cfg.IsRemoteStorage() {
+			err = data.SyncData(cfg, st)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Infof("restore from %s success, logs %d/%d, groups %d/%d, notes %d/%d, upload keys %d/%d, shares %d/%d, files %d/%d (created/skipped)",
+			*input,
+			result.Logs.Created, result.Logs.Skipped,
+			result.Groups.Created, result.Groups.Skipped,
+			result.Notes.Created, result.Notes.Skipped,
+			result.UploadKeys.Created, result.UploadKeys.Skipped,
+			result.Shares.Created, result.Shares.Skipped,
+			result.Blobs.Created, result.Blobs.Skipped)
+		return nil
+	})
+}
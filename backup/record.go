@@ -0,0 +1,317 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+const (
+	formatVersion = 1
+	manifestName  = "manifest.json"
+	logsName      = "logs.ndjson"
+	groupsName    = "groups.ndjson"
+	notesName     = "notes.ndjson"
+	keysName      = "upload_keys.ndjson"
+	sharesName    = "shares.ndjson"
+	blobDir       = "blobs/"
+	pageSize      = 500
+)
+
+// Manifest 写在归档末尾，记录格式版本和各类记录数量
+type Manifest struct {
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Logs         int       `json:"logs"`
+	Groups       int       `json:"groups"`
+	Notes        int       `json:"notes"`
+	UploadKeys   int       `json:"uploadKeys"`
+	Shares       int       `json:"shares"`
+	Blobs        int       `json:"blobs"`
+	MissingBlobs []string  `json:"missingBlobs,omitempty"`
+}
+
+type LogRecord struct {
+	FileId        string         `json:"fileId"`
+	Name          string         `json:"name"`
+	Size          int64          `json:"size"`
+	Status        data.Status    `json:"status"`
+	Tags          []*storage.Tag `json:"tags"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+	TrashedAt     *time.Time     `json:"trashedAt,omitempty"`
+	TrashedBy     string         `json:"trashedBy,omitempty"`
+	FormatVersion int            `json:"formatVersion,omitempty"`
+}
+
+type GroupRecord struct {
+	GroupId   string         `json:"groupId"`
+	Name      string         `json:"name"`
+	Size      int64          `json:"size"`
+	Tags      []*storage.Tag `json:"tags"`
+	FileIds   []string       `json:"fileIds"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	TrashedAt *time.Time     `json:"trashedAt,omitempty"`
+	TrashedBy string         `json:"trashedBy,omitempty"`
+}
+
+type NoteRecord struct {
+	NoteId     string    `json:"noteId"`
+	FileId     string    `json:"fileId,omitempty"`
+	GroupId    string    `json:"groupId,omitempty"`
+	Author     string    `json:"author"`
+	Content    string    `json:"content"`
+	AnchorTime *int64    `json:"anchorTime,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func toRecordTags(tags []*data.Tag) []*storage.Tag {
+	result := make([]*storage.Tag, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, &storage.Tag{Key: t.Key, Value: t.Value})
+	}
+
+	return result
+}
+
+func toDataTags(tags []*storage.Tag) []*data.Tag {
+	result := make([]*data.Tag, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, &data.Tag{Key: t.Key, Value: t.Value})
+	}
+
+	return result
+}
+
+func newLogRecord(l *data.LogData) *LogRecord {
+	return &LogRecord{
+		FileId:        l.FileId,
+		Name:          l.Name,
+		Size:          l.Size,
+		Status:        l.Status,
+		Tags:          toRecordTags(l.Tags),
+		CreatedAt:     l.CreatedAt,
+		UpdatedAt:     l.UpdatedAt,
+		TrashedAt:     l.TrashedAt,
+		TrashedBy:     l.TrashedBy,
+		FormatVersion: l.FormatVersion,
+	}
+}
+
+func (r *LogRecord) toLogData() *data.LogData {
+	return &data.LogData{
+		Model: data.Model{
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+		},
+		FileId:        r.FileId,
+		Name:          r.Name,
+		Size:          r.Size,
+		Status:        r.Status,
+		Tags:          toDataTags(r.Tags),
+		TrashedAt:     r.TrashedAt,
+		TrashedBy:     r.TrashedBy,
+		FormatVersion: r.FormatVersion,
+	}
+}
+
+func newGroupRecord(g *data.LogGroup) *GroupRecord {
+	fileIds := make([]string, 0, len(g.Logs))
+	for _, l := range g.Logs {
+		fileIds = append(fileIds, l.FileId)
+	}
+
+	return &GroupRecord{
+		GroupId:   g.GroupId,
+		Name:      g.Name,
+		Size:      g.Size,
+		Tags:      toRecordTags(g.Tags),
+		FileIds:   fileIds,
+		CreatedAt: g.CreatedAt,
+		UpdatedAt: g.UpdatedAt,
+		TrashedAt: g.TrashedAt,
+		TrashedBy: g.TrashedBy,
+	}
+}
+
+func (r *GroupRecord) toLogGroup() *data.LogGroup {
+	return &data.LogGroup{
+		Model: data.Model{
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+		},
+		GroupId:   r.GroupId,
+		Name:      r.Name,
+		Size:      r.Size,
+		Tags:      toDataTags(r.Tags),
+		TrashedAt: r.TrashedAt,
+		TrashedBy: r.TrashedBy,
+	}
+}
+
+func newNoteRecord(n *data.LogNote) *NoteRecord {
+	return &NoteRecord{
+		NoteId:     n.NoteId,
+		FileId:     n.FileId,
+		GroupId:    n.GroupId,
+		Author:     n.Author,
+		Content:    n.Content,
+		AnchorTime: n.AnchorTime,
+		CreatedAt:  n.CreatedAt,
+		UpdatedAt:  n.UpdatedAt,
+	}
+}
+
+func (r *NoteRecord) toLogNote() *data.LogNote {
+	return &data.LogNote{
+		Model: data.Model{
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+		},
+		NoteId:     r.NoteId,
+		FileId:     r.FileId,
+		GroupId:    r.GroupId,
+		Author:     r.Author,
+		Content:    r.Content,
+		AnchorTime: r.AnchorTime,
+	}
+}
+
+// UploadKeyRecord 只包含密钥哈希，恢复后原有密钥仍然可用
+type UploadKeyRecord struct {
+	KeyId     string     `json:"keyId"`
+	Name      string     `json:"name"`
+	Project   string     `json:"project"`
+	Origins   []string   `json:"origins"`
+	KeyHash   string     `json:"keyHash"`
+	KeyPrefix string     `json:"keyPrefix"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+func newUploadKeyRecord(k *data.UploadKey) *UploadKeyRecord {
+	return &UploadKeyRecord{
+		KeyId:     k.KeyId,
+		Name:      k.Name,
+		Project:   k.Project,
+		Origins:   k.Origins,
+		KeyHash:   k.KeyHash,
+		KeyPrefix: k.KeyPrefix,
+		RevokedAt: k.RevokedAt,
+		CreatedBy: k.CreatedBy,
+		CreatedAt: k.CreatedAt,
+		UpdatedAt: k.UpdatedAt,
+	}
+}
+
+func (r *UploadKeyRecord) toUploadKey() *data.UploadKey {
+	return &data.UploadKey{
+		Model: data.Model{
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+		},
+		KeyId:     r.KeyId,
+		Name:      r.Name,
+		Project:   r.Project,
+		Origins:   r.Origins,
+		KeyHash:   r.KeyHash,
+		KeyPrefix: r.KeyPrefix,
+		RevokedAt: r.RevokedAt,
+		CreatedBy: r.CreatedBy,
+	}
+}
+
+type ShareRecord struct {
+	ShareId   string     `json:"shareId"`
+	FileId    string     `json:"fileId,omitempty"`
+	GroupId   string     `json:"groupId,omitempty"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+func newShareRecord(s *data.ShareLink) *ShareRecord {
+	return &ShareRecord{
+		ShareId:   s.ShareId,
+		FileId:    s.FileId,
+		GroupId:   s.GroupId,
+		ExpiresAt: s.ExpiresAt,
+		RevokedAt: s.RevokedAt,
+		CreatedBy: s.CreatedBy,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+func (r *ShareRecord) toShareLink() *data.ShareLink {
+	return &data.ShareLink{
+		Model: data.Model{
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+		},
+		ShareId:   r.ShareId,
+		FileId:    r.FileId,
+		GroupId:   r.GroupId,
+		ExpiresAt: r.ExpiresAt,
+		RevokedAt: r.RevokedAt,
+		CreatedBy: r.CreatedBy,
+	}
+}
+
+// Remap 将 fileId、noteId、keyId、shareId 中的 machineId 前缀替换为新节点的 machineId
+type Remap map[string]string
+
+func (r Remap) String() string {
+	items := make([]string, 0, len(r))
+	for from, to := range r {
+		items = append(items, from+"="+to)
+	}
+
+	return strings.Join(items, ",")
+}
+
+// Set 实现 flag.Value，支持 --remap A0=local 或 --remap A0=local,A1=local
+func (r Remap) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || from == "" || to == "" || strings.Contains(from, ".") || strings.Contains(to, ".") {
+			return fmt.Errorf("remap %s format error, expect from=to", item)
+		}
+
+		r[from] = to
+	}
+
+	return nil
+}
+
+func (r Remap) Id(id string) string {
+	machine, rest, ok := strings.Cut(id, ".")
+	if !ok {
+		return id
+	}
+
+	to, ok := r[machine]
+	if !ok {
+		return id
+	}
+
+	return to + "." + rest
+}
+
+func (r Remap) Ids(ids []string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, r.Id(id))
+	}
+
+	return result
+}
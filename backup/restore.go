@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+type RestoreCount struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+func (c *RestoreCount) add(created bool) {
+	if created {
+		c.Created++
+		return
+	}
+
+	c.Skipped++
+}
+
+type RestoreResult struct {
+	Blobs      RestoreCount `json:"blobs"`
+	Logs       RestoreCount `json:"logs"`
+	Groups     RestoreCount `json:"groups"`
+	Notes      RestoreCount `json:"notes"`
+	UploadKeys RestoreCount `json:"uploadKeys"`
+	Shares     RestoreCount `json:"shares"`
+}
+
+func restoreBlob(st storage.StorageApi, fileId string, r io.Reader) (bool, error) {
+	exist, err := st.ExistLog(fileId)
+	if err != nil || exist {
+		return false, err
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+
+	return true, st.SaveLog(&storage.LogFile{
+		FileId:     fileId,
+		Size:       int64(len(content)),
+		UpdateFile: content,
+	})
+}
+
+// readRecords 逐行解析 ndjson，每条记录交给 fn 处理
+func readRecords[T any](r io.Reader, fn func(record *T) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) <= 0 {
+			continue
+		}
+
+		record := new(T)
+		err := json.Unmarshal(line, record)
+		if err != nil {
+			return err
+		}
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Restore 从备份归档恢复数据，已存在的文件和记录会被跳过，因此可以重复执行
+func Restore(d data.DataApi, st storage.StorageApi, r io.Reader, remap Remap) (*RestoreResult, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	result := &RestoreResult{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(header.Name, blobDir):
+			fileId := remap.Id(strings.TrimPrefix(header.Name, blobDir))
+			created, err := restoreBlob(st, fileId, tr)
+			if err != nil {
+				return nil, fmt.Errorf("restore file %s error: %w", fileId, err)
+			}
+
+			result.Blobs.add(created)
+		case header.Name == logsName:
+			err = readRecords(tr, func(record *LogRecord) error {
+				record.FileId = remap.Id(record.FileId)
+				created, err := d.ImportLog(record.toLogData())
+				if err != nil {
+					return fmt.Errorf("restore log %s error: %w", record.FileId, err)
+				}
+
+				result.Logs.add(created)
+				return nil
+			})
+		case header.Name == groupsName:
+			err = readRecords(tr, func(record *GroupRecord) error {
+				created, err := d.ImportLogGroup(record.toLogGroup(), remap.Ids(record.FileIds))
+				if err != nil {
+					return fmt.Errorf("restore log group %s error: %w", record.GroupId, err)
+				}
+
+				result.Groups.add(created)
+				return nil
+			})
+		case header.Name == notesName:
+			err = readRecords(tr, func(record *NoteRecord) error {
+				record.NoteId = remap.Id(record.NoteId)
+				record.FileId = remap.Id(record.FileId)
+				created, err := d.ImportNote(record.toLogNote())
+				if err != nil {
+					return fmt.Errorf("restore note %s error: %w", record.NoteId, err)
+				}
+
+				result.Notes.add(created)
+				return nil
+			})
+		case header.Name == keysName:
+			err = readRecords(tr, func(record *UploadKeyRecord) error {
+				record.KeyId = remap.Id(record.KeyId)
+				created, err := d.ImportUploadKey(record.toUploadKey())
+				if err != nil {
+					return fmt.Errorf("restore upload key %s error: %w", record.KeyId, err)
+				}
+
+				result.UploadKeys.add(created)
+				return nil
+			})
+		case header.Name == sharesName:
+			err = readRecords(tr, func(record *ShareRecord) error {
+				record.ShareId = remap.Id(record.ShareId)
+				record.FileId = remap.Id(record.FileId)
+				created, err := d.ImportShareLink(record.toShareLink())
+				if err != nil {
+					return fmt.Errorf("restore share %s error: %w", record.ShareId, err)
+				}
+
+				result.Shares.add(created)
+				return nil
+			})
+		case header.Name == manifestName:
+			manifest := &Manifest{}
+			err = json.NewDecoder(tr).Decode(manifest)
+			if err == nil && manifest.Version > formatVersion {
+				err = fmt.Errorf("backup version %d is newer than supported version %d", manifest.Version, formatVersion)
+			}
+		default:
+			log.Warnf("restore skip unknown entry %s", header.Name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"embed"
 	"log"
+	"os"
 
+	"github.com/HuolalaTech/page-spy-api/backup"
 	"github.com/HuolalaTech/page-spy-api/config"
 	"github.com/HuolalaTech/page-spy-api/container"
 	"github.com/HuolalaTech/page-spy-api/serve"
@@ -25,5 +27,19 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 && (os.Args[1] == "backup" || os.Args[1] == "restore") {
+		if os.Args[1] == "backup" {
+			err = backup.RunBackup(os.Args[2:])
+		} else {
+			err = backup.RunRestore(os.Args[2:])
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	serve.Run()
 }
@@ -38,20 +38,94 @@ func (s *StorageConfig) GetLogDir() string {
 
 // Config 应用配置结构体
 type Config struct {
-	Port                string          `json:"port"`
-	Debug               bool            `json:"debug"`
-	NotAllowedDeleteLog bool            `json:"notAllowedDeleteLog"`
-	RpcAddress          []*Address      `json:"rpcAddress"`
-	SelfRpcAddress      *Address        `json:"selfRpcAddress"`
-	CorsConfig          *CorsConfig     `json:"corsConfig"`
-	StorageConfig       *StorageConfig  `json:"storageConfig"`
-	DatabaseConfig      *DatabaseConfig `json:"databaseConfig"`
-	MaxRoomNumber       int             `json:"maxRoomNumber"`
+	Port                string `json:"port"`
+	Debug               bool   `json:"debug"`
+	NotAllowedDeleteLog bool   `json:"notAllowedDeleteLog"`
+	// reject uploads without an upload key
+	NotAllowedAnonymousUpload bool `json:"notAllowedAnonymousUpload"`
+	// store uploads without checking the offline log format
+	SkipUploadValidation bool            `json:"skipUploadValidation"`
+	RpcAddress           []*Address      `json:"rpcAddress"`
+	SelfRpcAddress       *Address        `json:"selfRpcAddress"`
+	CorsConfig           *CorsConfig     `json:"corsConfig"`
+	StorageConfig        *StorageConfig  `json:"storageConfig"`
+	DatabaseConfig       *DatabaseConfig `json:"databaseConfig"`
+	MaxRoomNumber        int             `json:"maxRoomNumber"`
+	// how long a room restored after restart waits for its clients to rejoin, unit is second
+	RoomReconnectGraceOfSecond int64 `json:"roomReconnectGraceOfSecond"`
+	// room timeouts and the limits of timeouts set when creating a room
+	RoomConfig *RoomConfig `json:"roomConfig"`
 	// max log file size, unit is mb
 	MaxLogFileSizeOfMB int64 `json:"maxLogFileSizeOfMB"`
+	// max size of one upload after decompression, unit is mb
+	MaxUploadSizeOfMB int64 `json:"maxUploadSizeOfMB"`
 	// max log file size, unit is day
-	MaxLogLifeTimeOfHour int64       `json:"maxLogLifeTimeOfHour"`
-	AuthConfig           *AuthConfig `json:"authConfig"`
+	MaxLogLifeTimeOfHour int64 `json:"maxLogLifeTimeOfHour"`
+	// how long deleted logs stay in the trash before purged, unit is hour
+	TrashLifeTimeOfHour int64 `json:"trashLifeTimeOfHour"`
+	// max lifetime of a share link, unit is hour
+	MaxShareLifeTimeOfHour int64 `json:"maxShareLifeTimeOfHour"`
+	// how long an unfinished resumable upload is kept after the last chunk, unit is hour
+	TusLifeTimeOfHour int64 `json:"tusLifeTimeOfHour"`
+	// max size of a resumable upload, unit is mb
+	TusMaxSizeOfMB int64       `json:"tusMaxSizeOfMB"`
+	AuthConfig     *AuthConfig `json:"authConfig"`
+	// ordered retention rules, a log only follows the first matched rule
+	RetentionRules  []*RetentionRule `json:"retentionRules"`
+	QuotaConfig     *QuotaConfig     `json:"quotaConfig"`
+	RateLimitConfig *RateLimitConfig `json:"rateLimitConfig"`
+	WebhookConfig   *WebhookConfig   `json:"webhookConfig"`
+	NotifyConfig    *NotifyConfig    `json:"notifyConfig"`
+	// websocket compression of room connections
+	WebsocketConfig *WebsocketConfig `json:"websocketConfig"`
+}
+
+// WebsocketConfig 房间 WebSocket 连接的设置
+type WebsocketConfig struct {
+	Compression *CompressionConfig `json:"compression"`
+}
+
+// CompressionConfig permessage-deflate 压缩，客户端不支持时不压缩
+type CompressionConfig struct {
+	Enabled bool `json:"enabled"`
+	// deflate level from -2 to 9, default is 1
+	Level int `json:"level"`
+	// messages smaller than this are sent uncompressed, unit is byte
+	ThresholdOfByte int `json:"thresholdOfByte"`
+}
+
+func (c *WebsocketConfig) GetCompression() *CompressionConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.Compression
+}
+
+func (c *CompressionConfig) GetLevel() int {
+	if c == nil || c.Level == 0 {
+		return 1
+	}
+
+	return c.Level
+}
+
+func (c *CompressionConfig) GetThresholdOfByte() int {
+	if c == nil || c.ThresholdOfByte <= 0 {
+		return 1024
+	}
+
+	return c.ThresholdOfByte
+}
+
+// RetentionRule 按标签设置日志的保留时间和大小上限
+type RetentionRule struct {
+	// tag filter, format is key=value
+	Tag string `json:"tag"`
+	// max log life time of matched logs, unit is hour, 0 means no limit
+	MaxLifeTimeOfHour int64 `json:"maxLifeTimeOfHour"`
+	// max total size of matched logs, unit is mb, 0 means no limit
+	MaxSizeOfMB int64 `json:"maxSizeOfMB"`
 }
 
 func (c *Config) GetLogDir() string {
@@ -73,6 +147,182 @@ func (c *Config) Save() error {
 	return os.WriteFile(ConfigFileName, data, 0644)
 }
 
+// QuotaConfig 按标签值限制上传，未配置时不限制
+type QuotaConfig struct {
+	// tag key used to group uploads, default is project
+	TagKey string `json:"tagKey"`
+	// quota of tag values not listed in projects, empty means no limit
+	Default *Quota `json:"default"`
+	// quota of each tag value
+	Projects map[string]*Quota `json:"projects"`
+}
+
+// Quota 限制值为 0 时表示不限制
+type Quota struct {
+	// max total size of logs, unit is mb
+	MaxSizeOfMB int64 `json:"maxSizeOfMB"`
+	MaxFiles    int64 `json:"maxFiles"`
+	// max uploads in the last hour
+	MaxUploadsPerHour int64 `json:"maxUploadsPerHour"`
+}
+
+func (q *QuotaConfig) GetTagKey() string {
+	if q == nil || q.TagKey == "" {
+		return "project"
+	}
+
+	return q.TagKey
+}
+
+func (q *QuotaConfig) GetQuota(value string) *Quota {
+	quota, ok := q.Projects[value]
+	if ok {
+		return quota
+	}
+
+	return q.Default
+}
+
+// RateLimitConfig 公开接口限流，未配置的策略不限流
+type RateLimitConfig struct {
+	// use X-Forwarded-For and X-Real-IP as the client ip, only enable it behind a trusted reverse proxy
+	TrustProxy bool `json:"trustProxy"`
+	// split every limit evenly across the nodes in rpcAddress
+	ClusterAware bool `json:"clusterAware"`
+	// POST /room/create
+	Room *RateLimit `json:"room"`
+	// GET /room/check
+	Check *RateLimit `json:"check"`
+	// GET /ws/room/join
+	Join *RateLimit `json:"join"`
+	// log upload endpoints and resumable upload creation
+	Upload *RateLimit `json:"upload"`
+}
+
+// RateLimit 令牌桶限流策略
+type RateLimit struct {
+	RequestsPerMinute float64 `json:"requestsPerMinute"`
+	// max requests allowed at once, default is requestsPerMinute
+	Burst int `json:"burst"`
+	// bucket key, one of ip, uploadKey and room
+	KeyBy string `json:"keyBy"`
+}
+
+// GetPolicy 返回指定路由组的限流策略，未配置时返回 nil
+func (r *RateLimitConfig) GetPolicy(name string) *RateLimit {
+	if r == nil {
+		return nil
+	}
+
+	switch name {
+	case "room":
+		return r.Room
+	case "check":
+		return r.Check
+	case "join":
+		return r.Join
+	case "upload":
+		return r.Upload
+	}
+
+	return nil
+}
+
+// WebhookConfig 上传和房间事件的 webhook 推送配置
+type WebhookConfig struct {
+	Hooks []*Webhook `json:"hooks"`
+	// max delivery attempts before a delivery is marked as failed, default is 8
+	MaxAttempts int `json:"maxAttempts"`
+	// timeout of each delivery request, unit is second, default is 10
+	TimeoutOfSecond int64 `json:"timeoutOfSecond"`
+	// how long finished deliveries are kept in the delivery log, unit is hour, default is 72
+	LogLifeTimeOfHour int64 `json:"logLifeTimeOfHour"`
+}
+
+// Webhook 订阅的事件和标签都匹配时推送
+type Webhook struct {
+	// unique name of the webhook, used in the delivery log
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	// payload is signed with HMAC-SHA256 when secret is set
+	Secret string `json:"secret"`
+	// subscribed event types, empty means all events
+	Events []string `json:"events"`
+	// tag filters, format is key=value, all of them should match
+	Tags []string `json:"tags"`
+}
+
+func (w *WebhookConfig) GetHooks() []*Webhook {
+	if w == nil {
+		return nil
+	}
+
+	return w.Hooks
+}
+
+func (w *WebhookConfig) GetMaxAttempts() int {
+	if w == nil || w.MaxAttempts <= 0 {
+		return 8
+	}
+
+	return w.MaxAttempts
+}
+
+func (w *WebhookConfig) GetTimeoutOfSecond() int64 {
+	if w == nil || w.TimeoutOfSecond <= 0 {
+		return 10
+	}
+
+	return w.TimeoutOfSecond
+}
+
+func (w *WebhookConfig) GetLogLifeTimeOfHour() int64 {
+	if w == nil || w.LogLifeTimeOfHour <= 0 {
+		return 3 * 24 // default delivery log life 3 day
+	}
+
+	return w.LogLifeTimeOfHour
+}
+
+// NotifyConfig 群聊机器人通知配置
+type NotifyConfig struct {
+	// base url of the web ui used in links, e.g. https://pagespy.example.com
+	WebBaseUrl string `json:"webBaseUrl"`
+	// link template of room events, default is {{.BaseUrl}}/#/devtools?address={{query .Address}}
+	RoomLink string `json:"roomLink"`
+	// link template of log events, default opens the log in the replay page
+	LogLink  string           `json:"logLink"`
+	Channels []*NotifyChannel `json:"channels"`
+}
+
+// NotifyChannel 群聊机器人，订阅的事件、房间分组和标签都匹配时发送消息
+type NotifyChannel struct {
+	// unique name of the channel
+	Name string `json:"name"`
+	// one of feishu, dingtalk, wecom and slack
+	Type string `json:"type"`
+	// incoming webhook url of the bot
+	Url string `json:"url"`
+	// signing secret of feishu and dingtalk bots
+	Secret string `json:"secret"`
+	// subscribed event types, default is room.created and log.uploaded
+	Events []string `json:"events"`
+	// room groups, empty means all groups, log events are skipped when set
+	Groups []string `json:"groups"`
+	// tag filters, format is key=value, all of them should match
+	Tags []string `json:"tags"`
+	// title template, empty means the built-in title of each event
+	Title string `json:"title"`
+}
+
+func (n *NotifyConfig) GetChannels() []*NotifyChannel {
+	if n == nil {
+		return nil
+	}
+
+	return n.Channels
+}
+
 // AuthConfig 认证配置结构体
 type AuthConfig struct {
 	Password        string `json:"password"`        // 认证密码
@@ -92,6 +342,38 @@ func (c *Config) GetMaxLogLifeTimeOfHour() int64 {
 	return c.MaxLogLifeTimeOfHour
 }
 
+func (c *Config) GetTrashLifeTimeOfHour() int64 {
+	if c.TrashLifeTimeOfHour <= 0 {
+		return 3 * 24 // default trash life 3 day
+	}
+
+	return c.TrashLifeTimeOfHour
+}
+
+func (c *Config) GetMaxShareLifeTimeOfHour() int64 {
+	if c.MaxShareLifeTimeOfHour <= 0 {
+		return 30 * 24 // default share life 30 day
+	}
+
+	return c.MaxShareLifeTimeOfHour
+}
+
+func (c *Config) GetTusLifeTimeOfHour() int64 {
+	if c.TusLifeTimeOfHour <= 0 {
+		return 24 // default unfinished upload life 1 day
+	}
+
+	return c.TusLifeTimeOfHour
+}
+
+func (c *Config) GetTusMaxSizeOfMB() int64 {
+	if c.TusMaxSizeOfMB <= 0 {
+		return 1024 // default max upload size 1GB
+	}
+
+	return c.TusMaxSizeOfMB
+}
+
 func (c *Config) GetMaxLogFileSizeOfMB() int64 {
 	if c.MaxLogFileSizeOfMB <= 0 {
 		return 10 * 1024 // default log size 10GB
@@ -100,6 +382,22 @@ func (c *Config) GetMaxLogFileSizeOfMB() int64 {
 	return c.MaxLogFileSizeOfMB
 }
 
+func (c *Config) GetMaxUploadSizeOfMB() int64 {
+	if c.MaxUploadSizeOfMB <= 0 {
+		return 100 // default upload size 100MB
+	}
+
+	return c.MaxUploadSizeOfMB
+}
+
+func (c *Config) GetRoomReconnectGraceOfSecond() int64 {
+	if c.RoomReconnectGraceOfSecond <= 0 {
+		return 120 // default reconnect grace 2 minutes
+	}
+
+	return c.RoomReconnectGraceOfSecond
+}
+
 func (c *Config) GetMaxRoomNumber() int {
 	if c.MaxRoomNumber <= 0 {
 		return 500
@@ -108,6 +406,243 @@ func (c *Config) GetMaxRoomNumber() int {
 	return c.MaxRoomNumber
 }
 
+// RoomConfig 房间的默认超时时间，创建房间时可以在上限内单独设置
+type RoomConfig struct {
+	// close a room without connections after this time, unit is second
+	EmptyTimeoutOfSecond int64 `json:"emptyTimeoutOfSecond"`
+	// close a room without messages after this time, unit is second
+	IdleTimeoutOfSecond int64 `json:"idleTimeoutOfSecond"`
+	// close a room this long after it is created, unit is second
+	LifeTimeOfSecond int64 `json:"lifeTimeOfSecond"`
+	// max emptyTimeoutOfSecond of a single room, unit is second
+	MaxEmptyTimeoutOfSecond int64 `json:"maxEmptyTimeoutOfSecond"`
+	// max idleTimeoutOfSecond of a single room, unit is second
+	MaxIdleTimeoutOfSecond int64 `json:"maxIdleTimeoutOfSecond"`
+	// max lifeTimeOfSecond of a single room, unit is second
+	MaxLifeTimeOfSecond int64 `json:"maxLifeTimeOfSecond"`
+	// close a connection to a room on another node without messages after this time, unit is second
+	RemoteIdleTimeoutOfSecond int64 `json:"remoteIdleTimeoutOfSecond"`
+	// buffer broadcasts from the SDK and replay them to connections that join later
+	Replay *ReplayConfig `json:"replay"`
+	// record rooms and save the recording as a log when the room closes
+	Record *RecordConfig `json:"record"`
+	// outbound message queue of each connection
+	Queue *QueueConfig `json:"queue"`
+	// roles of connections and the messages each role may send
+	Roles *RolesConfig `json:"roles"`
+}
+
+// RolesConfig 连接角色，加入房间时未指定角色的连接按 userId 推断
+type RolesConfig struct {
+	// userId of SDK connections joined without a role, other connections are debuggers
+	ClientUserIds []string `json:"clientUserIds"`
+	// debuggers must carry a login token when authConfig.password is set
+	DebuggerAuth bool `json:"debuggerAuth"`
+	// message types each role may send, listed roles replace their defaults
+	Permissions map[string][]string `json:"permissions"`
+}
+
+func (c *RolesConfig) GetClientUserIds() []string {
+	if c == nil || len(c.ClientUserIds) <= 0 {
+		return []string{"Client"}
+	}
+
+	return c.ClientUserIds
+}
+
+func (c *RoomConfig) GetRoles() *RolesConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.Roles
+}
+
+// QueueConfig 每个连接的发送队列，队列满时按 policy 处理
+type QueueConfig struct {
+	// max queued messages of a connection
+	Size int `json:"size"`
+	// what to do when the queue is full: dropOldest, dropType or disconnect
+	Policy string `json:"policy"`
+	// message types dropped first by the dropType policy
+	DropTypes []string `json:"dropTypes"`
+}
+
+func (c *QueueConfig) GetSize() int {
+	if c == nil || c.Size <= 0 {
+		return 2000
+	}
+
+	return c.Size
+}
+
+func (c *QueueConfig) GetPolicy() string {
+	if c == nil || c.Policy == "" {
+		return "dropOldest"
+	}
+
+	return c.Policy
+}
+
+func (c *QueueConfig) GetDropTypes() []string {
+	if c == nil || len(c.DropTypes) <= 0 {
+		return []string{"broadcast"}
+	}
+
+	return c.DropTypes
+}
+
+// RecordConfig 房间录制，创建时未指定的房间按标签决定是否录制
+type RecordConfig struct {
+	// record rooms that carry one of these tags, format is key=value
+	Tags []string `json:"tags"`
+	// max size of a recording, the rest of the room is not recorded, unit is mb
+	MaxSizeOfMB int64 `json:"maxSizeOfMB"`
+}
+
+func (c *RecordConfig) GetTags() []string {
+	if c == nil {
+		return nil
+	}
+
+	return c.Tags
+}
+
+func (c *RecordConfig) GetMaxSizeOfMB() int64 {
+	if c == nil || c.MaxSizeOfMB <= 0 {
+		return 100 // default 100MB
+	}
+
+	return c.MaxSizeOfMB
+}
+
+// ReplayConfig 房间消息回放缓冲的上限，超过任一上限时淘汰最早的消息
+type ReplayConfig struct {
+	// enable replay for rooms that do not set it when created
+	Enabled bool `json:"enabled"`
+	// max buffered messages of a room
+	MaxMessages int `json:"maxMessages"`
+	// max buffered size of a room, unit is kb
+	MaxSizeOfKB int64 `json:"maxSizeOfKB"`
+	// max age of buffered messages, unit is second
+	MaxAgeOfSecond int64 `json:"maxAgeOfSecond"`
+	// userId of SDK connections, only their broadcasts are buffered
+	UserIds []string `json:"userIds"`
+}
+
+func (c *ReplayConfig) GetMaxMessages() int {
+	if c == nil || c.MaxMessages <= 0 {
+		return 1000
+	}
+
+	return c.MaxMessages
+}
+
+func (c *ReplayConfig) GetMaxSizeOfKB() int64 {
+	if c == nil || c.MaxSizeOfKB <= 0 {
+		return 2 * 1024 // default 2MB
+	}
+
+	return c.MaxSizeOfKB
+}
+
+func (c *ReplayConfig) GetMaxAgeOfSecond() int64 {
+	if c == nil || c.MaxAgeOfSecond <= 0 {
+		return 10 * 60 // default 10 minutes
+	}
+
+	return c.MaxAgeOfSecond
+}
+
+func (c *ReplayConfig) GetUserIds() []string {
+	if c == nil || len(c.UserIds) <= 0 {
+		return []string{"Client"}
+	}
+
+	return c.UserIds
+}
+
+func (c *RoomConfig) GetEmptyTimeoutOfSecond() int64 {
+	if c == nil || c.EmptyTimeoutOfSecond <= 0 {
+		return 60 // default 1 minute
+	}
+
+	return c.EmptyTimeoutOfSecond
+}
+
+func (c *RoomConfig) GetIdleTimeoutOfSecond() int64 {
+	if c == nil || c.IdleTimeoutOfSecond <= 0 {
+		return 5 * 60 // default 5 minutes
+	}
+
+	return c.IdleTimeoutOfSecond
+}
+
+func (c *RoomConfig) GetLifeTimeOfSecond() int64 {
+	if c == nil || c.LifeTimeOfSecond <= 0 {
+		return 60 * 60 // default 1 hour
+	}
+
+	return c.LifeTimeOfSecond
+}
+
+// GetMaxEmptyTimeoutOfSecond 上限不会小于默认值，未配置时房间不能延长默认值
+func (c *RoomConfig) GetMaxEmptyTimeoutOfSecond() int64 {
+	if c == nil || c.MaxEmptyTimeoutOfSecond < c.GetEmptyTimeoutOfSecond() {
+		return c.GetEmptyTimeoutOfSecond()
+	}
+
+	return c.MaxEmptyTimeoutOfSecond
+}
+
+func (c *RoomConfig) GetMaxIdleTimeoutOfSecond() int64 {
+	if c == nil || c.MaxIdleTimeoutOfSecond < c.GetIdleTimeoutOfSecond() {
+		return c.GetIdleTimeoutOfSecond()
+	}
+
+	return c.MaxIdleTimeoutOfSecond
+}
+
+func (c *RoomConfig) GetMaxLifeTimeOfSecond() int64 {
+	if c == nil || c.MaxLifeTimeOfSecond < c.GetLifeTimeOfSecond() {
+		return c.GetLifeTimeOfSecond()
+	}
+
+	return c.MaxLifeTimeOfSecond
+}
+
+func (c *RoomConfig) GetReplay() *ReplayConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.Replay
+}
+
+func (c *RoomConfig) GetQueue() *QueueConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.Queue
+}
+
+func (c *RoomConfig) GetRecord() *RecordConfig {
+	if c == nil {
+		return nil
+	}
+
+	return c.Record
+}
+
+func (c *RoomConfig) GetRemoteIdleTimeoutOfSecond() int64 {
+	if c == nil || c.RemoteIdleTimeoutOfSecond <= 0 {
+		return 20 // default 20 seconds
+	}
+
+	return c.RemoteIdleTimeoutOfSecond
+}
+
 type Address struct {
 	Ip   string `json:"ip"`
 	Port string `json:"port"`
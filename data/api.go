@@ -1,6 +1,10 @@
 package data
 
-import "time"
+import (
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+)
 
 type DataApi interface {
 	CreateLogGroup(logGroup *LogGroup) error
@@ -15,7 +19,75 @@ type DataApi interface {
 	UpdateLogStatus(fileId string, status Status) error
 	DeleteLogByFileId(fileId string) error
 	FindLogByFileId(fileId string) (*LogData, error)
-	FindTimeoutLogs(before time.Time, size int) ([]*LogData, error)
-	FindOldestLogs(size int) ([]*LogData, error)
-	CountLogsSize() (int64, error)
+
+	TrashLog(fileId string, operator string) error
+	TrashLogGroup(groupId string, operator string) error
+	RestoreLog(fileId string) error
+	RestoreLogGroup(groupId string) error
+	FindTrashedLogByFileId(fileId string) (*LogData, error)
+	FindTrashedLogGroup(groupId string) (*LogGroup, error)
+	FindExpiredTrashLogs(before time.Time, size int) ([]*LogData, error)
+	FindExpiredTrashLogGroups(before time.Time, size int) ([]*LogGroup, error)
+	PurgeLogByFileId(fileId string) error
+	PurgeLogGroupByGroupId(groupId string) error
+
+	CreateNote(note *LogNote) error
+	UpdateNote(note *LogNote) error
+	FindNote(noteId string) (*LogNote, error)
+	FindNotesByFileId(fileId string) ([]*LogNote, error)
+	FindNotesByGroupId(groupId string) ([]*LogNote, error)
+	FindNoteIdsByGroupIds(groupIds []string) ([]*LogNote, error)
+	DeleteNote(noteId string) error
+	DeleteNotesByFileId(fileId string) error
+	DeleteNotesByGroupId(groupId string) error
+
+	CreateShareLink(share *ShareLink) error
+	FindShareLink(shareId string) (*ShareLink, error)
+	FindShareLinks(query *ShareListQuery) (*Page[*ShareLink], error)
+	RevokeShareLink(shareId string) error
+
+	CreateUploadKey(key *UploadKey) error
+	FindUploadKey(keyId string) (*UploadKey, error)
+	FindUploadKeyByHash(keyHash string) (*UploadKey, error)
+	FindUploadKeys(query *UploadKeyListQuery) (*Page[*UploadKey], error)
+	RevokeUploadKey(keyId string) error
+
+	CreateWebhookDeliveries(deliveries []*WebhookDelivery) error
+	FindWebhookDelivery(deliveryId string) (*WebhookDelivery, error)
+	FindDueWebhookDeliveries(machineId string, webhook string, now time.Time, size int) ([]*WebhookDelivery, error)
+	FindWebhookDeliveries(query *WebhookDeliveryQuery) (*Page[*WebhookDelivery], error)
+	UpdateWebhookDelivery(delivery *WebhookDelivery) error
+	FailRemovedWebhookDeliveries(machineId string, webhooks []string) error
+	PurgeWebhookDeliveries(machineId string, before time.Time) error
+
+	SaveRoom(info *room.Info) error
+	DeleteRoom(address string) error
+	FindRooms(machineId string) ([]*room.Info, error)
+
+	UpdateLogMeta(log *LogData) error
+	UpdateLogGroupName(logGroup *LogGroup) error
+	RefreshLogGroupTags(logGroupID uint) error
+
+	SummaryLogs(query *FileListQuery) (*LogSummary, error)
+	FindAllLogs(query *FileListQuery, limit int) ([]*LogData, error)
+
+	FindLogsForBackup(afterId uint, size int) ([]*LogData, error)
+	FindLogGroupsForBackup(afterId uint, size int) ([]*LogGroup, error)
+	FindNotesForBackup(afterId uint, size int) ([]*LogNote, error)
+	FindUploadKeysForBackup(afterId uint, size int) ([]*UploadKey, error)
+	FindShareLinksForBackup(afterId uint, size int) ([]*ShareLink, error)
+	ImportLog(log *LogData) (bool, error)
+	ImportLogGroup(logGroup *LogGroup, fileIds []string) (bool, error)
+	ImportNote(note *LogNote) (bool, error)
+	ImportUploadKey(key *UploadKey) (bool, error)
+	ImportShareLink(share *ShareLink) (bool, error)
+
+	SummaryRetentionLogs(scope *RetentionScope) (*LogSummary, error)
+	FindRetentionLogs(scope *RetentionScope, size int) ([]*LogData, error)
+
+	CountQuotaUsage(query *QuotaUsageQuery) ([]*QuotaUsage, error)
+
+	CountLogsByStatus(machineId string) ([]*StatusCount, error)
+	FindLargestLogs(machineId string, size int) ([]*LogData, error)
+	CountLogSizes(machineId string, from time.Time, to time.Time, interval int64) ([]*LogSizeBucket, error)
 }
@@ -0,0 +1,148 @@
+package data
+
+import "gorm.io/gorm"
+
+// FindLogsForBackup 按主键顺序分页读取全部日志记录，包含回收站中的记录
+func (d *Data) FindLogsForBackup(afterId uint, size int) ([]*LogData, error) {
+	var logs []*LogData
+	result := d.db.Where("id > ?", afterId).
+		Preload("Tags").
+		Order("id asc").
+		Limit(size).
+		Find(&logs)
+	return logs, result.Error
+}
+
+// FindLogGroupsForBackup 按主键顺序分页读取全部日志组记录，包含回收站中的记录
+func (d *Data) FindLogGroupsForBackup(afterId uint, size int) ([]*LogGroup, error) {
+	var logGroups []*LogGroup
+	result := d.db.Where("id > ?", afterId).
+		Preload("Tags").
+		Preload("Logs").
+		Order("id asc").
+		Limit(size).
+		Find(&logGroups)
+	return logGroups, result.Error
+}
+
+func (d *Data) FindNotesForBackup(afterId uint, size int) ([]*LogNote, error) {
+	var notes []*LogNote
+	result := d.db.Where("id > ?", afterId).
+		Order("id asc").
+		Limit(size).
+		Find(&notes)
+	return notes, result.Error
+}
+
+// ImportLog 导入备份中的日志记录，已存在相同 fileId 的记录时跳过
+func (d *Data) ImportLog(log *LogData) (bool, error) {
+	var count int64
+	err := d.db.Model(&LogData{}).Where("file_id = ?", log.FileId).Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	return true, d.db.Create(log).Error
+}
+
+// ImportLogGroup 导入备份中的日志组记录并关联组内日志，已存在相同 groupId 的记录时跳过
+func (d *Data) ImportLogGroup(logGroup *LogGroup, fileIds []string) (bool, error) {
+	var count int64
+	err := d.db.Model(&LogGroup{}).Where("group_id = ?", logGroup.GroupId).Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	err = d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(logGroup).Error
+		if err != nil {
+			return err
+		}
+
+		if len(fileIds) <= 0 {
+			return nil
+		}
+
+		return tx.Model(&LogData{}).
+			Where("file_id in ?", fileIds).
+			Where("log_group_id is null").
+			Update("log_group_id", logGroup.ID).Error
+	})
+
+	return err == nil, err
+}
+
+// ImportNote 导入备份中的批注并关联日志或日志组，已存在相同 noteId 的记录时跳过
+func (d *Data) ImportNote(note *LogNote) (bool, error) {
+	var count int64
+	err := d.db.Model(&LogNote{}).Where("note_id = ?", note.NoteId).Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	if note.FileId != "" {
+		log := &LogData{}
+		result := d.db.Where("file_id = ?", note.FileId).Limit(1).Find(log)
+		if result.Error != nil {
+			return false, result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			note.LogDataID = &log.ID
+		}
+	}
+
+	if note.GroupId != "" {
+		logGroup := &LogGroup{}
+		result := d.db.Where("group_id = ?", note.GroupId).Limit(1).Find(logGroup)
+		if result.Error != nil {
+			return false, result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			note.LogGroupID = &logGroup.ID
+		}
+	}
+
+	return true, d.db.Create(note).Error
+}
+
+func (d *Data) FindUploadKeysForBackup(afterId uint, size int) ([]*UploadKey, error) {
+	var keys []*UploadKey
+	result := d.db.Where("id > ?", afterId).
+		Order("id asc").
+		Limit(size).
+		Find(&keys)
+	return keys, result.Error
+}
+
+func (d *Data) FindShareLinksForBackup(afterId uint, size int) ([]*ShareLink, error) {
+	var shares []*ShareLink
+	result := d.db.Where("id > ?", afterId).
+		Order("id asc").
+		Limit(size).
+		Find(&shares)
+	return shares, result.Error
+}
+
+// ImportUploadKey 导入备份中的上传密钥，已存在相同 keyId 或相同密钥哈希的记录时跳过，密钥哈希是唯一索引，需要包含已删除的记录
+func (d *Data) ImportUploadKey(key *UploadKey) (bool, error) {
+	var count int64
+	err := d.db.Unscoped().Model(&UploadKey{}).Where("key_id = ? or key_hash = ?", key.KeyId, key.KeyHash).Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	return true, d.db.Create(key).Error
+}
+
+// ImportShareLink 导入备份中的分享链接，已存在相同 shareId 的记录时跳过
+func (d *Data) ImportShareLink(share *ShareLink) (bool, error) {
+	var count int64
+	err := d.db.Model(&ShareLink{}).Where("share_id = ?", share.ShareId).Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	return true, d.db.Create(share).Error
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/HuolalaTech/page-spy-api/rpc"
+)
+
+type LogSummary struct {
+	Total int64 `json:"total"`
+	Size  int64 `json:"size"`
+}
+
+func (s *LogSummary) Merge(result rpc.MergeResult) error {
+	summary, ok := result.(*LogSummary)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	s.Total += summary.Total
+	s.Size += summary.Size
+	return nil
+}
+
+func (s *LogSummary) New() rpc.MergeResult {
+	return &LogSummary{}
+}
+
+// SummaryLogs 统计符合条件的日志数量和总大小
+func (d *Data) SummaryLogs(query *FileListQuery) (*LogSummary, error) {
+	summary := &LogSummary{}
+	result := query.getLogFilterDB(d.db.Model(&LogData{})).
+		Where("log_data.status = ?", Saved).
+		Select("count(*) as total, coalesce(sum(log_data.size), 0) as size").
+		Scan(summary)
+	return summary, result.Error
+}
+
+// FindAllLogs 查询符合条件的全部日志，limit 用于限制单次批量操作的数量
+func (d *Data) FindAllLogs(query *FileListQuery, limit int) ([]*LogData, error) {
+	var logs []*LogData
+	result := query.getLogFilterDB(d.db).
+		Where("log_data.status = ?", Saved).
+		Preload("Tags").
+		Order("log_data.created_at desc").
+		Limit(limit).
+		Find(&logs)
+	return logs, result.Error
+}
+
+type LogList struct {
+	Logs []*LogData `json:"logs"`
+}
+
+func (l *LogList) Merge(result rpc.MergeResult) error {
+	list, ok := result.(*LogList)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	l.Logs = append(l.Logs, list.Logs...)
+	return nil
+}
+
+func (l *LogList) New() rpc.MergeResult {
+	return &LogList{}
+}
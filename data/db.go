@@ -76,7 +76,7 @@ func InitData(cfg *config.Config, gormConfig *gorm.Config) (*Data, error) {
 		}
 	}
 
-	if err := db.AutoMigrate(&LogGroup{}, &LogData{}, &Tag{}); err != nil {
+	if err := db.AutoMigrate(&LogGroup{}, &LogData{}, &Tag{}, &LogNote{}, &ShareLink{}, &UploadKey{}, &WebhookDelivery{}, &RoomData{}); err != nil {
 		return nil, fmt.Errorf("failed to auto migrate database %w", err)
 	}
 
@@ -190,6 +190,11 @@ func syncData(config *config.Config, s storage.StorageApi) func() error {
 	}
 }
 
+// SyncData 立即将本地 SQLite 文件同步到远程存储
+func SyncData(config *config.Config, s storage.StorageApi) error {
+	return syncData(config, s)()
+}
+
 func (d *Data) UpdateLogGroup(groupLog *LogGroup) error {
 	result := d.db.Model(groupLog).Updates(&LogGroup{
 		Size: groupLog.Size,
@@ -206,12 +211,21 @@ func (d *Data) CreateLogGroup(groupLog *LogGroup) error {
 
 func (d *Data) FindLogGroup(groupId string) (*LogGroup, error) {
 	logGroup := &LogGroup{}
-	result := d.db.Where("group_id = ?", groupId).Preload("Logs").First(logGroup)
+	result := d.db.Where("group_id = ?", groupId).
+		Where("trashed_at is null").
+		Preload("Tags").
+		Preload("Logs", "trashed_at is null").
+		Preload("Logs.Tags").
+		First(logGroup)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 
-	return logGroup, result.Error
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return logGroup, d.fillLogGroupsNoteCount([]*LogGroup{logGroup})
 }
 
 func (d *Data) FindLogGroups(query *FileListQuery) (*Page[*LogGroup], error) {
@@ -236,6 +250,11 @@ func (d *Data) FindLogGroups(query *FileListQuery) (*Page[*LogGroup], error) {
 		return nil, result.Error
 	}
 
+	err := d.fillLogGroupsNoteCount(logGroups)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Page[*LogGroup]{
 		Data:  logGroups,
 		Total: total,
@@ -281,6 +300,18 @@ type FileListQuery struct {
 	From *int64
 	To   *int64
 	Tags []*storage.Tag
+	// Trashed 为 true 时只查询回收站中的数据
+	Trashed bool
+	// MachineId 不为空时只查询该节点生成的日志，共享数据库时避免各节点重复返回
+	MachineId string
+}
+
+func (f *FileListQuery) trashedCondition(table string) string {
+	if f.Trashed {
+		return table + ".trashed_at is not null"
+	}
+
+	return table + ".trashed_at is null"
 }
 
 func (f *FileListQuery) GetFrom() *time.Time {
@@ -324,10 +355,16 @@ func (query *FileListQuery) getLogGroupDB(db *gorm.DB) *gorm.DB {
 		q = q.Where("log_groups.created_at < ?", to)
 	}
 
-	return q.Preload("Tags").Preload("Logs").Order("log_groups.created_at desc")
+	q = q.Where(query.trashedCondition("log_groups"))
+	return q.Preload("Tags").Preload("Logs", query.trashedCondition("log_data")).Order("log_groups.created_at desc")
 }
 
 func (query *FileListQuery) getLogDB(db *gorm.DB) *gorm.DB {
+	return query.getLogFilterDB(db).Preload("Tags").Order("log_data.created_at desc")
+}
+
+// getLogFilterDB 只包含筛选条件，便于统计查询复用
+func (query *FileListQuery) getLogFilterDB(db *gorm.DB) *gorm.DB {
 	q := db
 
 	if query.Tags != nil && len(query.Tags) > 0 {
@@ -349,7 +386,12 @@ func (query *FileListQuery) getLogDB(db *gorm.DB) *gorm.DB {
 		q = q.Where("log_data.created_at < ?", to)
 	}
 
-	return q.Preload("Tags").Order("log_data.created_at desc")
+	if query.MachineId != "" {
+		q = q.Where("log_data.file_id like ?", query.MachineId+".%")
+	}
+
+	q = q.Where(query.trashedCondition("log_data"))
+	return q
 }
 
 type LogGroupResult struct {
@@ -394,6 +436,11 @@ func (d *Data) FindLogs(query *FileListQuery) (*Page[*LogData], error) {
 		return nil, result.Error
 	}
 
+	err := d.fillLogsNoteCount(logs)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Page[*LogData]{
 		Data:  logs,
 		Total: total,
@@ -412,7 +459,11 @@ func (d *Data) DeleteLogByFileId(fileId string) error {
 
 func (d *Data) FindLogByFileId(FileId string) (*LogData, error) {
 	log := &LogData{}
-	result := d.db.Where("file_id = ?", FileId).Where("status = ?", Saved).First(log)
+	result := d.db.Where("file_id = ?", FileId).
+		Where("status = ?", Saved).
+		Where("trashed_at is null").
+		Preload("Tags").
+		First(log)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -420,18 +471,6 @@ func (d *Data) FindLogByFileId(FileId string) (*LogData, error) {
 	return log, result.Error
 }
 
-func (d *Data) FindTimeoutLogs(before time.Time, size int) ([]*LogData, error) {
-	var logs []*LogData
-	result := d.db.Where("created_at < ?", before).Limit(size).Order("created_at desc").Find(&logs)
-	return logs, result.Error
-}
-
-func (d *Data) FindOldestLogs(size int) ([]*LogData, error) {
-	var logs []*LogData
-	result := d.db.Limit(size).Order("created_at asc").Find(&logs)
-	return logs, result.Error
-}
-
 func (d *Data) FindShouldDeleteLogs(size int) ([]*LogData, error) {
 	var logs []*LogData
 	status := []Status{
@@ -445,19 +484,3 @@ func (d *Data) FindShouldDeleteLogs(size int) ([]*LogData, error) {
 		Where("status in ?", status).Find(&logs)
 	return logs, result.Error
 }
-
-type Sum struct {
-	Total int64
-}
-
-func (d *Data) CountLogsSize() (int64, error) {
-	sum := &Sum{}
-	result := d.db.Model(&LogData{}).
-		Where("status = ?", Saved).
-		Select("sum(size) as total").Scan(sum)
-	if result.Error != nil {
-		return 0, result.Error
-	}
-
-	return sum.Total, nil
-}
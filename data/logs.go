@@ -80,19 +80,32 @@ func (m *Model) GetUniqKey() string {
 
 type LogData struct {
 	Model
-	Status     Status `json:"status"`
-	Size       int64  `json:"size"`
-	FileId     string `gorm:"index:unique" json:"fileId"`
-	LogGroupID *uint  `json:"-" gorm:"index;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Tags       []*Tag `gorm:"many2many:log_tags;" json:"tags"`
-	Name       string `json:"name"`
+	Status     Status     `json:"status"`
+	Size       int64      `json:"size"`
+	FileId     string     `gorm:"index:unique" json:"fileId"`
+	LogGroupID *uint      `json:"-" gorm:"index;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Tags       []*Tag     `gorm:"many2many:log_tags;" json:"tags"`
+	Name       string     `json:"name"`
+	TrashedAt  *time.Time `gorm:"index" json:"trashedAt,omitempty"`
+	TrashedBy  string     `json:"trashedBy,omitempty"`
+	NoteCount  int64      `gorm:"-" json:"noteCount"`
+	// FormatVersion 上传时识别的离线日志格式版本，0 表示未识别
+	FormatVersion int `json:"formatVersion"`
+}
+
+// GetUniqKey 经过 RPC 后 ID 不会被序列化，使用 fileId 去重
+func (l *LogData) GetUniqKey() string {
+	return l.FileId
 }
 
 type LogGroup struct {
 	Model
-	GroupId string     `json:"groupId"`
-	Tags    []*Tag     `gorm:"many2many:log_group_tags;" json:"tags"`
-	Size    int64      `json:"size"`
-	Logs    []*LogData `gorm:"foreignKey:LogGroupID" json:"logs"`
-	Name    string     `json:"name"`
+	GroupId   string     `json:"groupId"`
+	Tags      []*Tag     `gorm:"many2many:log_group_tags;" json:"tags"`
+	Size      int64      `json:"size"`
+	Logs      []*LogData `gorm:"foreignKey:LogGroupID" json:"logs"`
+	Name      string     `json:"name"`
+	TrashedAt *time.Time `gorm:"index" json:"trashedAt,omitempty"`
+	TrashedBy string     `json:"trashedBy,omitempty"`
+	NoteCount int64      `gorm:"-" json:"noteCount"`
 }
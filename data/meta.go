@@ -0,0 +1,94 @@
+package data
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deleteUnusedTags 删除替换后不再被任何日志或日志组引用的标签，新建的日志组和第一个日志共用标签记录
+func deleteUnusedTags(tx *gorm.DB, tagIds []uint) error {
+	if len(tagIds) <= 0 {
+		return nil
+	}
+
+	return tx.Unscoped().
+		Where("id in ?", tagIds).
+		Where("not exists (select 1 from log_tags where log_tags.tag_id = tags.id)").
+		Where("not exists (select 1 from log_group_tags where log_group_tags.tag_id = tags.id)").
+		Delete(&Tag{}).Error
+}
+
+// UpdateLogMeta 更新日志名称并替换日志标签
+func (d *Data) UpdateLogMeta(log *LogData) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(log).Omit(clause.Associations).Update("name", log.Name).Error
+		if err != nil {
+			return err
+		}
+
+		var oldTagIds []uint
+		err = tx.Table("log_tags").Where("log_data_id = ?", log.ID).Pluck("tag_id", &oldTagIds).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(log).Association("Tags").Replace(log.Tags)
+		if err != nil {
+			return err
+		}
+
+		return deleteUnusedTags(tx, oldTagIds)
+	})
+}
+
+// UpdateLogGroupName 更新日志组名称，日志组标签由 RefreshLogGroupTags 计算
+func (d *Data) UpdateLogGroupName(logGroup *LogGroup) error {
+	return d.db.Model(logGroup).Omit(clause.Associations).Update("name", logGroup.Name).Error
+}
+
+// RefreshLogGroupTags 将日志组标签重新计算为组内未删除日志标签的并集
+func (d *Data) RefreshLogGroupTags(logGroupID uint) error {
+	logGroup := &LogGroup{}
+	result := d.db.Where("id = ?", logGroupID).
+		Preload("Logs", "trashed_at is null").
+		Preload("Logs.Tags").
+		First(logGroup)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil
+	}
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	seen := map[Tag]struct{}{}
+	tags := []*Tag{}
+	for _, l := range logGroup.Logs {
+		for _, t := range l.Tags {
+			key := Tag{Key: t.Key, Value: t.Value}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+
+			seen[key] = struct{}{}
+			tags = append(tags, &Tag{Key: t.Key, Value: t.Value})
+		}
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var oldTagIds []uint
+		err := tx.Table("log_group_tags").Where("log_group_id = ?", logGroup.ID).Pluck("tag_id", &oldTagIds).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(logGroup).Association("Tags").Replace(tags)
+		if err != nil {
+			return err
+		}
+
+		return deleteUnusedTags(tx, oldTagIds)
+	})
+}
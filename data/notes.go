@@ -0,0 +1,139 @@
+package data
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type LogNote struct {
+	Model
+	NoteId     string `gorm:"index" json:"noteId"`
+	FileId     string `gorm:"index" json:"fileId,omitempty"`
+	GroupId    string `gorm:"index" json:"groupId,omitempty"`
+	LogDataID  *uint  `gorm:"index" json:"-"`
+	LogGroupID *uint  `gorm:"index" json:"-"`
+	Author     string `json:"author"`
+	Content    string `gorm:"type:text" json:"content"`
+	// AnchorTime 批注关联的日志时间点，单位毫秒
+	AnchorTime *int64 `json:"anchorTime,omitempty"`
+}
+
+func (d *Data) CreateNote(note *LogNote) error {
+	return d.db.Create(note).Error
+}
+
+func (d *Data) UpdateNote(note *LogNote) error {
+	return d.db.Model(note).Select("Content", "AnchorTime").Updates(note).Error
+}
+
+func (d *Data) FindNote(noteId string) (*LogNote, error) {
+	note := &LogNote{}
+	result := d.db.Where("note_id = ?", noteId).First(note)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return note, result.Error
+}
+
+func (d *Data) FindNotesByFileId(fileId string) ([]*LogNote, error) {
+	var notes []*LogNote
+	result := d.db.Where("file_id = ?", fileId).Order("created_at asc").Find(&notes)
+	return notes, result.Error
+}
+
+func (d *Data) FindNotesByGroupId(groupId string) ([]*LogNote, error) {
+	var notes []*LogNote
+	result := d.db.Where("group_id = ?", groupId).Order("created_at asc").Find(&notes)
+	return notes, result.Error
+}
+
+// FindNoteIdsByGroupIds 按日志组查询批注 ID，只用于统计数量
+func (d *Data) FindNoteIdsByGroupIds(groupIds []string) ([]*LogNote, error) {
+	var notes []*LogNote
+	if len(groupIds) <= 0 {
+		return notes, nil
+	}
+
+	result := d.db.Select("note_id, group_id").Where("group_id in ?", groupIds).Find(&notes)
+	return notes, result.Error
+}
+
+func (d *Data) DeleteNote(noteId string) error {
+	return d.db.Unscoped().Where("note_id = ?", noteId).Delete(&LogNote{}).Error
+}
+
+func (d *Data) DeleteNotesByFileId(fileId string) error {
+	return d.db.Unscoped().Where("file_id = ?", fileId).Delete(&LogNote{}).Error
+}
+
+func (d *Data) DeleteNotesByGroupId(groupId string) error {
+	return d.db.Unscoped().Where("group_id = ?", groupId).Delete(&LogNote{}).Error
+}
+
+type noteCount struct {
+	Key   string
+	Total int64
+}
+
+func (d *Data) countNotes(column string, keys []string) (map[string]int64, error) {
+	counts := map[string]int64{}
+	if len(keys) <= 0 {
+		return counts, nil
+	}
+
+	var results []noteCount
+	err := d.db.Model(&LogNote{}).
+		Select(column+" as `key`, count(*) as total").
+		Where(column+" in ?", keys).
+		Group(column).
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range results {
+		counts[r.Key] = r.Total
+	}
+
+	return counts, nil
+}
+
+func (d *Data) fillLogsNoteCount(logs []*LogData) error {
+	fileIds := make([]string, 0, len(logs))
+	for _, l := range logs {
+		fileIds = append(fileIds, l.FileId)
+	}
+
+	counts, err := d.countNotes("file_id", fileIds)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range logs {
+		l.NoteCount = counts[l.FileId]
+	}
+
+	return nil
+}
+
+func (d *Data) fillLogGroupsNoteCount(logGroups []*LogGroup) error {
+	groupIds := make([]string, 0, len(logGroups))
+	logs := []*LogData{}
+	for _, g := range logGroups {
+		groupIds = append(groupIds, g.GroupId)
+		logs = append(logs, g.Logs...)
+	}
+
+	counts, err := d.countNotes("group_id", groupIds)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range logGroups {
+		g.NoteCount = counts[g.GroupId]
+	}
+
+	return d.fillLogsNoteCount(logs)
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"gorm.io/gorm"
+)
+
+type QuotaUsage struct {
+	Value   string `json:"value"`
+	Files   int64  `json:"files"`
+	Size    int64  `json:"size"`
+	Uploads int64  `json:"uploads"`
+}
+
+type QuotaUsageList struct {
+	Usages []*QuotaUsage `json:"usages"`
+}
+
+func (l *QuotaUsageList) Merge(result rpc.MergeResult) error {
+	list, ok := result.(*QuotaUsageList)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	for _, usage := range list.Usages {
+		found := false
+		for _, u := range l.Usages {
+			if u.Value == usage.Value {
+				u.Files += usage.Files
+				u.Size += usage.Size
+				u.Uploads += usage.Uploads
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			l.Usages = append(l.Usages, usage)
+		}
+	}
+
+	return nil
+}
+
+func (l *QuotaUsageList) New() rpc.MergeResult {
+	return &QuotaUsageList{}
+}
+
+type QuotaUsageQuery struct {
+	TagKey string
+	// Value 不为空时只统计该标签值
+	Value *string
+	// Since 之后创建的日志计入上传次数
+	Since     time.Time
+	MachineId string
+}
+
+// CountQuotaUsage 按标签值统计已保存日志的数量、大小和 Since 之后的上传次数，没有该标签的日志统计在空值下
+func (d *Data) CountQuotaUsage(query *QuotaUsageQuery) ([]*QuotaUsage, error) {
+	selectUsage := "count(*) as files, coalesce(sum(log_data.size), 0) as size, coalesce(sum(case when log_data.created_at > ? then 1 else 0 end), 0) as uploads"
+	q := d.db.Model(&LogData{}).Where("log_data.status = ?", Saved)
+	if query.MachineId != "" {
+		q = q.Where("log_data.file_id like ?", query.MachineId+".%")
+	}
+
+	// 下面分别统计有标签和没有标签的日志，共用上面的条件
+	q = q.Session(&gorm.Session{})
+
+	usages := []*QuotaUsage{}
+	if query.Value == nil || *query.Value != "" {
+		tagged := q.
+			Select("tags.value as value, "+selectUsage, query.Since).
+			Joins("join log_tags on log_tags.log_data_id = log_data.id").
+			Joins("join tags on tags.id = log_tags.tag_id and tags.key = ?", query.TagKey).
+			Group("tags.value")
+		if query.Value != nil {
+			tagged = tagged.Where("tags.value = ?", *query.Value)
+		}
+
+		err := tagged.Scan(&usages).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if query.Value == nil || *query.Value == "" {
+		untagged := &QuotaUsage{}
+		err := q.
+			Select(selectUsage, query.Since).
+			Where("not exists (select 1 from log_tags join tags on tags.id = log_tags.tag_id where log_tags.log_data_id = log_data.id and tags.key = ?)", query.TagKey).
+			Scan(untagged).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if untagged.Files > 0 || query.Value != nil {
+			usages = append(usages, untagged)
+		}
+	}
+
+	return usages, nil
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"github.com/HuolalaTech/page-spy-api/storage"
+	"gorm.io/gorm"
+)
+
+const hasTagCondition = "exists (select 1 from log_tags join tags on tags.id = log_tags.tag_id where log_tags.log_data_id = log_data.id and tags.key = ? and tags.value = ?)"
+
+// RetentionScope 保留规则覆盖的日志范围：包含 Tag 且不包含 Exclude 中任一标签，Tag 为空时不限制标签
+// 回收站中的日志同样占用存储，因此不区分是否在回收站中
+type RetentionScope struct {
+	Tag       *storage.Tag
+	Exclude   []*storage.Tag
+	MachineId string
+}
+
+func (s *RetentionScope) getLogDB(db *gorm.DB) *gorm.DB {
+	q := db.Model(&LogData{})
+	if s.Tag != nil {
+		q = q.Where(hasTagCondition, s.Tag.Key, s.Tag.Value)
+	}
+
+	for _, tag := range s.Exclude {
+		q = q.Where("not "+hasTagCondition, tag.Key, tag.Value)
+	}
+
+	if s.MachineId != "" {
+		q = q.Where("log_data.file_id like ?", s.MachineId+".%")
+	}
+
+	return q
+}
+
+// SummaryRetentionLogs 统计范围内已保存日志的数量和总大小
+func (d *Data) SummaryRetentionLogs(scope *RetentionScope) (*LogSummary, error) {
+	summary := &LogSummary{}
+	result := scope.getLogDB(d.db).
+		Where("log_data.status = ?", Saved).
+		Select("count(*) as total, coalesce(sum(log_data.size), 0) as size").
+		Scan(summary)
+	return summary, result.Error
+}
+
+// FindRetentionLogs 按创建时间从旧到新查询范围内的日志
+func (d *Data) FindRetentionLogs(scope *RetentionScope, size int) ([]*LogData, error) {
+	var logs []*LogData
+	result := scope.getLogDB(d.db).
+		Preload("Tags").
+		Order("log_data.created_at asc").
+		Limit(size).
+		Find(&logs)
+	return logs, result.Error
+}
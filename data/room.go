@@ -0,0 +1,98 @@
+package data
+
+import (
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/event"
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"gorm.io/gorm/clause"
+)
+
+// RoomData 持久化的房间信息，只保存密码哈希，房间关闭后删除
+type RoomData struct {
+	Model
+	Address    string            `gorm:"uniqueIndex;size:191" json:"address"`
+	MachineId  string            `gorm:"index" json:"machineId"`
+	Name       string            `json:"name"`
+	Group      string            `json:"group"`
+	Tags       map[string]string `gorm:"serializer:json" json:"tags"`
+	UseSecret  bool              `json:"useSecret"`
+	SecretHash string            `json:"-"`
+	// ClientToken 随机生成，不是用户设置的密码，按原样保存
+	ClientToken string    `json:"-"`
+	ActiveAt    time.Time `json:"activeAt"`
+	// 创建时确定的超时设置，单位秒
+	EmptyTimeoutOfSecond int64 `json:"emptyTimeoutOfSecond"`
+	IdleTimeoutOfSecond  int64 `json:"idleTimeoutOfSecond"`
+	LifeTimeOfSecond     int64 `json:"lifeTimeOfSecond"`
+	Replay               bool  `json:"replay"`
+	Record               bool  `json:"record"`
+}
+
+func (d *Data) SaveRoom(info *room.Info) error {
+	roomData := &RoomData{
+		Model: Model{
+			CreatedAt: info.CreatedAt,
+			UpdatedAt: time.Now(),
+		},
+		Address:     info.Address.ID,
+		MachineId:   info.Address.MachineID,
+		Name:        info.Name,
+		Group:       info.Group,
+		Tags:        info.Tags,
+		UseSecret:   info.UseSecret,
+		SecretHash:  info.SecretHash,
+		ClientToken: info.ClientToken,
+		ActiveAt:    info.ActiveAt,
+		Replay:      info.Replay != nil && *info.Replay,
+		Record:      info.Record != nil && *info.Record,
+	}
+
+	if info.Timeouts != nil {
+		roomData.EmptyTimeoutOfSecond = info.Timeouts.EmptyTimeoutOfSecond
+		roomData.IdleTimeoutOfSecond = info.Timeouts.IdleTimeoutOfSecond
+		roomData.LifeTimeOfSecond = info.Timeouts.LifeTimeOfSecond
+	}
+
+	return d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "name", "group", "tags", "use_secret", "secret_hash", "active_at"}),
+	}).Create(roomData).Error
+}
+
+func (d *Data) DeleteRoom(address string) error {
+	return d.db.Unscoped().Where("address = ?", address).Delete(&RoomData{}).Error
+}
+
+func (d *Data) FindRooms(machineId string) ([]*room.Info, error) {
+	var rooms []*RoomData
+	result := d.db.Where("machine_id = ?", machineId).Order("created_at asc").Find(&rooms)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	infos := make([]*room.Info, 0, len(rooms))
+	for _, r := range rooms {
+		address, err := event.NewAddressFromID(r.Address)
+		if err != nil {
+			continue
+		}
+
+		info := room.NewRoomInfo(r.Name, "", r.UseSecret, r.Tags, r.Group, address)
+		info.SecretHash = r.SecretHash
+		info.ClientToken = r.ClientToken
+		info.CreatedAt = r.CreatedAt
+		info.ActiveAt = r.ActiveAt
+		info.Timeouts = &room.Timeouts{
+			EmptyTimeoutOfSecond: r.EmptyTimeoutOfSecond,
+			IdleTimeoutOfSecond:  r.IdleTimeoutOfSecond,
+			LifeTimeOfSecond:     r.LifeTimeOfSecond,
+		}
+		replay, record := r.Replay, r.Record
+		info.Replay = &replay
+		info.Record = &record
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ShareLink struct {
+	Model
+	ShareId   string     `gorm:"index" json:"shareId"`
+	FileId    string     `gorm:"index" json:"fileId,omitempty"`
+	GroupId   string     `gorm:"index" json:"groupId,omitempty"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	Token     string     `gorm:"-" json:"token,omitempty"`
+}
+
+func (s *ShareLink) GetUniqKey() string {
+	return s.ShareId
+}
+
+// IsValid 分享未撤销且未过期
+func (s *ShareLink) IsValid() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+type ShareListQuery struct {
+	PageQuery
+	FileId  string
+	GroupId string
+}
+
+func (query *ShareListQuery) getShareLinkDB(db *gorm.DB) *gorm.DB {
+	q := db
+	if query.FileId != "" {
+		q = q.Where("file_id = ?", query.FileId)
+	}
+
+	if query.GroupId != "" {
+		q = q.Where("group_id = ?", query.GroupId)
+	}
+
+	return q
+}
+
+func (d *Data) CreateShareLink(share *ShareLink) error {
+	return d.db.Create(share).Error
+}
+
+func (d *Data) FindShareLink(shareId string) (*ShareLink, error) {
+	share := &ShareLink{}
+	result := d.db.Where("share_id = ?", shareId).First(share)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return share, result.Error
+}
+
+func (d *Data) FindShareLinks(query *ShareListQuery) (*Page[*ShareLink], error) {
+	if query.Size <= 0 {
+		return nil, fmt.Errorf("size should be greater than 0")
+	}
+
+	if query.Page <= 0 {
+		return nil, fmt.Errorf("page should be greater than 0")
+	}
+
+	var shares []*ShareLink
+	result := query.getShareLinkDB(d.db).
+		Order("created_at desc").
+		Offset(query.GetOffset()).
+		Limit(query.Size).
+		Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var total int64
+	result = query.getShareLinkDB(d.db).Model(&ShareLink{}).Count(&total)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &Page[*ShareLink]{
+		Data:  shares,
+		Total: total,
+	}, nil
+}
+
+func (d *Data) RevokeShareLink(shareId string) error {
+	result := d.db.Model(&ShareLink{}).
+		Where("share_id = ?", shareId).
+		Where("revoked_at is null").
+		Update("revoked_at", time.Now())
+	return result.Error
+}
@@ -0,0 +1,68 @@
+package data
+
+import "time"
+
+type StatusCount struct {
+	Status Status `json:"status"`
+	Files  int64  `json:"files"`
+	Size   int64  `json:"size"`
+}
+
+// CountLogsByStatus 按状态统计日志数量和大小，包含回收站中的日志
+func (d *Data) CountLogsByStatus(machineId string) ([]*StatusCount, error) {
+	var counts []*StatusCount
+	q := d.db.Model(&LogData{})
+	if machineId != "" {
+		q = q.Where("log_data.file_id like ?", machineId+".%")
+	}
+
+	result := q.Select("log_data.status as status, count(*) as files, coalesce(sum(log_data.size), 0) as size").
+		Group("log_data.status").
+		Scan(&counts)
+	return counts, result.Error
+}
+
+// FindLargestLogs 查询最大的已保存日志
+func (d *Data) FindLargestLogs(machineId string, size int) ([]*LogData, error) {
+	var logs []*LogData
+	q := d.db.Where("status = ?", Saved)
+	if machineId != "" {
+		q = q.Where("file_id like ?", machineId+".%")
+	}
+
+	result := q.Preload("Tags").Order("size desc").Limit(size).Find(&logs)
+	return logs, result.Error
+}
+
+// LogSizeBucket Bucket 为分桶序号，从 from 开始每 interval 秒一个分桶
+type LogSizeBucket struct {
+	Bucket int64
+	Files  int64
+	Size   int64
+}
+
+// CountLogSizes 按创建时间分桶统计时间范围内已保存日志的数量和大小，没有日志的分桶不返回
+func (d *Data) CountLogSizes(machineId string, from time.Time, to time.Time, interval int64) ([]*LogSizeBucket, error) {
+	// sqlite 中时间保存为文本，mysql 中两侧的时间使用同一个时区转换，差值不受时区影响
+	bucket := "(cast(strftime('%s', log_data.created_at) as integer) - ?) / ?"
+	var args []interface{}
+	if d.db.Dialector.Name() == "mysql" {
+		bucket = "floor(timestampdiff(second, ?, log_data.created_at) / ?)"
+		args = []interface{}{from, interval}
+	} else {
+		args = []interface{}{from.Unix(), interval}
+	}
+
+	var buckets []*LogSizeBucket
+	q := d.db.Model(&LogData{}).
+		Where("log_data.status = ?", Saved).
+		Where("log_data.created_at >= ? and log_data.created_at < ?", from, to)
+	if machineId != "" {
+		q = q.Where("log_data.file_id like ?", machineId+".%")
+	}
+
+	result := q.Select("("+bucket+") as bucket, count(*) as files, coalesce(sum(log_data.size), 0) as size", args...).
+		Group("bucket").
+		Scan(&buckets)
+	return buckets, result.Error
+}
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (d *Data) TrashLog(fileId string, operator string) error {
+	result := d.db.Model(&LogData{}).
+		Where("file_id = ?", fileId).
+		Where("trashed_at is null").
+		Updates(map[string]interface{}{
+			"trashed_at": time.Now(),
+			"trashed_by": operator,
+		})
+
+	return result.Error
+}
+
+func (d *Data) TrashLogGroup(groupId string, operator string) error {
+	logGroup, err := d.FindLogGroup(groupId)
+	if err != nil {
+		return err
+	}
+
+	if logGroup == nil {
+		return nil
+	}
+
+	now := time.Now()
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&LogData{}).
+			Where("log_group_id = ?", logGroup.ID).
+			Where("trashed_at is null").
+			Updates(map[string]interface{}{
+				"trashed_at": now,
+				"trashed_by": operator,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Model(logGroup).Updates(map[string]interface{}{
+			"trashed_at": now,
+			"trashed_by": operator,
+		}).Error
+	})
+}
+
+// RestoreLog 相同内容重新上传后会生成相同的 fileId，已有同名日志时拒绝恢复
+func (d *Data) RestoreLog(fileId string) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&LogData{}).
+			Where("file_id = ?", fileId).
+			Where("trashed_at is null").
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return fmt.Errorf("file %s already exists", fileId)
+		}
+
+		return tx.Model(&LogData{}).
+			Where("file_id = ?", fileId).
+			Where("trashed_at is not null").
+			Updates(map[string]interface{}{
+				"trashed_at": nil,
+				"trashed_by": "",
+			}).Error
+	})
+}
+
+func (d *Data) RestoreLogGroup(groupId string) error {
+	logGroup, err := d.FindTrashedLogGroup(groupId)
+	if err != nil {
+		return err
+	}
+
+	if logGroup == nil {
+		return nil
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&LogGroup{}).
+			Where("group_id = ?", groupId).
+			Where("trashed_at is null").
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return fmt.Errorf("log group %s already exists", groupId)
+		}
+
+		result := tx.Model(&LogData{}).
+			Where("log_group_id = ?", logGroup.ID).
+			Where("trashed_at is not null").
+			Updates(map[string]interface{}{
+				"trashed_at": nil,
+				"trashed_by": "",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Model(logGroup).Updates(map[string]interface{}{
+			"trashed_at": nil,
+			"trashed_by": "",
+		}).Error
+	})
+}
+
+func (d *Data) FindTrashedLogByFileId(fileId string) (*LogData, error) {
+	log := &LogData{}
+	result := d.db.Where("file_id = ?", fileId).
+		Where("trashed_at is not null").
+		First(log)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return log, result.Error
+}
+
+func (d *Data) FindTrashedLogGroup(groupId string) (*LogGroup, error) {
+	logGroup := &LogGroup{}
+	result := d.db.Where("group_id = ?", groupId).
+		Where("trashed_at is not null").
+		Preload("Logs").
+		First(logGroup)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return logGroup, result.Error
+}
+
+func (d *Data) FindExpiredTrashLogs(before time.Time, size int) ([]*LogData, error) {
+	var logs []*LogData
+	result := d.db.Where("trashed_at < ?", before).
+		Limit(size).
+		Order("trashed_at asc").
+		Find(&logs)
+	return logs, result.Error
+}
+
+func (d *Data) FindExpiredTrashLogGroups(before time.Time, size int) ([]*LogGroup, error) {
+	var logGroups []*LogGroup
+	result := d.db.Where("trashed_at < ?", before).
+		Preload("Logs").
+		Limit(size).
+		Order("trashed_at asc").
+		Find(&logGroups)
+	return logGroups, result.Error
+}
+
+// PurgeLogByFileId 彻底删除回收站中的日志记录及其标签关联，无法恢复
+func (d *Data) PurgeLogByFileId(fileId string) error {
+	var logs []*LogData
+	result := d.db.Unscoped().
+		Where("file_id = ?", fileId).
+		Where("trashed_at is not null").
+		Find(&logs)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, log := range logs {
+		err := d.db.Model(log).Association("Tags").Clear()
+		if err != nil {
+			return err
+		}
+
+		err = d.db.Unscoped().Delete(log).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PurgeLogGroupByGroupId 彻底删除已进入回收站的日志组记录，组内日志需由调用方先行删除
+func (d *Data) PurgeLogGroupByGroupId(groupId string) error {
+	var logGroups []*LogGroup
+	result := d.db.Unscoped().
+		Where("group_id = ?", groupId).
+		Where("trashed_at is not null").
+		Find(&logGroups)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, logGroup := range logGroups {
+		err := d.db.Model(logGroup).Association("Tags").Clear()
+		if err != nil {
+			return err
+		}
+
+		err = d.db.Unscoped().Delete(logGroup).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
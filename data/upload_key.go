@@ -0,0 +1,126 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UploadKey struct {
+	Model
+	KeyId   string `gorm:"index" json:"keyId"`
+	Name    string `json:"name"`
+	Project string `gorm:"index" json:"project"`
+	// Origins 为空时不限制来源
+	Origins []string `gorm:"serializer:json" json:"origins"`
+	// KeyHash 只保存密钥的哈希，明文只在创建时返回一次
+	KeyHash   string     `gorm:"uniqueIndex;size:64" json:"-"`
+	KeyPrefix string     `json:"keyPrefix"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	Key       string     `gorm:"-" json:"key,omitempty"`
+}
+
+func (k *UploadKey) GetUniqKey() string {
+	return k.KeyId
+}
+
+func (k *UploadKey) IsValid() bool {
+	return k.RevokedAt == nil
+}
+
+// AllowOrigin 检查请求来源，配置了来源时 origin 必须完全一致
+func (k *UploadKey) AllowOrigin(origin string) bool {
+	if len(k.Origins) <= 0 {
+		return true
+	}
+
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, o := range k.Origins {
+		if origin != "" && strings.ToLower(strings.TrimSuffix(o, "/")) == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+type UploadKeyListQuery struct {
+	PageQuery
+	Project string
+}
+
+func (query *UploadKeyListQuery) getUploadKeyDB(db *gorm.DB) *gorm.DB {
+	q := db
+	if query.Project != "" {
+		q = q.Where("project = ?", query.Project)
+	}
+
+	return q
+}
+
+func (d *Data) CreateUploadKey(key *UploadKey) error {
+	return d.db.Create(key).Error
+}
+
+func (d *Data) FindUploadKey(keyId string) (*UploadKey, error) {
+	key := &UploadKey{}
+	result := d.db.Where("key_id = ?", keyId).First(key)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return key, result.Error
+}
+
+func (d *Data) FindUploadKeyByHash(keyHash string) (*UploadKey, error) {
+	key := &UploadKey{}
+	result := d.db.Where("key_hash = ?", keyHash).First(key)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return key, result.Error
+}
+
+func (d *Data) FindUploadKeys(query *UploadKeyListQuery) (*Page[*UploadKey], error) {
+	if query.Size <= 0 {
+		return nil, fmt.Errorf("size should be greater than 0")
+	}
+
+	if query.Page <= 0 {
+		return nil, fmt.Errorf("page should be greater than 0")
+	}
+
+	var keys []*UploadKey
+	result := query.getUploadKeyDB(d.db).
+		Order("created_at desc").
+		Offset(query.GetOffset()).
+		Limit(query.Size).
+		Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var total int64
+	result = query.getUploadKeyDB(d.db).Model(&UploadKey{}).Count(&total)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &Page[*UploadKey]{
+		Data:  keys,
+		Total: total,
+	}, nil
+}
+
+func (d *Data) RevokeUploadKey(keyId string) error {
+	result := d.db.Model(&UploadKey{}).
+		Where("key_id = ?", keyId).
+		Where("revoked_at is null").
+		Update("revoked_at", time.Now())
+	return result.Error
+}
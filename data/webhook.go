@@ -0,0 +1,161 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "Pending"
+	DeliverySuccess DeliveryStatus = "Success"
+	DeliveryFailed  DeliveryStatus = "Failed"
+)
+
+// WebhookDelivery 每个事件对每个匹配的 webhook 生成一条投递记录，由生成记录的节点负责投递
+type WebhookDelivery struct {
+	Model
+	DeliveryId string         `gorm:"index" json:"deliveryId"`
+	EventId    string         `gorm:"index" json:"eventId"`
+	Event      string         `gorm:"index" json:"event"`
+	Webhook    string         `gorm:"index" json:"webhook"`
+	MachineId  string         `gorm:"index" json:"machineId"`
+	Payload    string         `gorm:"type:text" json:"payload"`
+	Status     DeliveryStatus `gorm:"index" json:"status"`
+	Attempts   int            `json:"attempts"`
+	// 最近一次投递的 HTTP 状态码，请求失败时为 0
+	ResponseStatus int        `json:"responseStatus"`
+	LastError      string     `gorm:"type:text" json:"lastError,omitempty"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"nextAttemptAt"`
+}
+
+func (d *WebhookDelivery) GetUniqKey() string {
+	return d.DeliveryId
+}
+
+type WebhookDeliveryQuery struct {
+	PageQuery
+	Webhook string
+	Event   string
+	EventId string
+	Status  DeliveryStatus
+}
+
+func (query *WebhookDeliveryQuery) getWebhookDeliveryDB(db *gorm.DB) *gorm.DB {
+	q := db
+	if query.Webhook != "" {
+		q = q.Where("webhook = ?", query.Webhook)
+	}
+
+	if query.Event != "" {
+		q = q.Where("event = ?", query.Event)
+	}
+
+	if query.EventId != "" {
+		q = q.Where("event_id = ?", query.EventId)
+	}
+
+	if query.Status != "" {
+		q = q.Where("status = ?", query.Status)
+	}
+
+	return q
+}
+
+func (d *Data) CreateWebhookDeliveries(deliveries []*WebhookDelivery) error {
+	if len(deliveries) <= 0 {
+		return nil
+	}
+
+	return d.db.Create(deliveries).Error
+}
+
+func (d *Data) FindWebhookDelivery(deliveryId string) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	result := d.db.Where("delivery_id = ?", deliveryId).First(delivery)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return delivery, result.Error
+}
+
+// FindDueWebhookDeliveries 查询本节点上一个 webhook 到达重试时间的投递
+func (d *Data) FindDueWebhookDeliveries(machineId string, webhook string, now time.Time, size int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	result := d.db.
+		Where("machine_id = ?", machineId).
+		Where("webhook = ?", webhook).
+		Where("status = ?", DeliveryPending).
+		Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at asc").
+		Limit(size).
+		Find(&deliveries)
+	return deliveries, result.Error
+}
+
+func (d *Data) FindWebhookDeliveries(query *WebhookDeliveryQuery) (*Page[*WebhookDelivery], error) {
+	if query.Size <= 0 {
+		return nil, fmt.Errorf("size should be greater than 0")
+	}
+
+	if query.Page <= 0 {
+		return nil, fmt.Errorf("page should be greater than 0")
+	}
+
+	var deliveries []*WebhookDelivery
+	result := query.getWebhookDeliveryDB(d.db).
+		Order("created_at desc").
+		Offset(query.GetOffset()).
+		Limit(query.Size).
+		Find(&deliveries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var total int64
+	result = query.getWebhookDeliveryDB(d.db).Model(&WebhookDelivery{}).Count(&total)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &Page[*WebhookDelivery]{
+		Data:  deliveries,
+		Total: total,
+	}, nil
+}
+
+func (d *Data) UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	return d.db.Save(delivery).Error
+}
+
+// FailRemovedWebhookDeliveries 把已经从配置中移除的 webhook 上等待投递的记录标记为失败
+func (d *Data) FailRemovedWebhookDeliveries(machineId string, webhooks []string) error {
+	q := d.db.Model(&WebhookDelivery{}).
+		Where("machine_id = ?", machineId).
+		Where("status = ?", DeliveryPending)
+	if len(webhooks) > 0 {
+		q = q.Where("webhook NOT IN ?", webhooks)
+	}
+
+	return q.Updates(map[string]interface{}{
+		"status":     DeliveryFailed,
+		"last_error": "webhook is removed from config",
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// PurgeWebhookDeliveries 删除已经结束的投递记录，等待重试的记录不受影响
+func (d *Data) PurgeWebhookDeliveries(machineId string, before time.Time) error {
+	return d.db.Unscoped().
+		Where("machine_id = ?", machineId).
+		Where("status <> ?", DeliveryPending).
+		Where("updated_at < ?", before).
+		Delete(&WebhookDelivery{}).Error
+}
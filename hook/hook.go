@@ -0,0 +1,62 @@
+package hook
+
+import "time"
+
+const (
+	LogUploaded = "log.uploaded"
+	RoomCreated = "room.created"
+	RoomUpdated = "room.updated"
+	RoomJoined  = "room.joined"
+	RoomLeft    = "room.left"
+	RoomClosed  = "room.closed"
+)
+
+var EventTypes = []string{LogUploaded, RoomCreated, RoomUpdated, RoomJoined, RoomLeft, RoomClosed}
+
+// DefaultEventTypes 未指定事件时订阅的事件，room.updated 需要显式订阅
+var DefaultEventTypes = []string{LogUploaded, RoomCreated, RoomJoined, RoomLeft, RoomClosed}
+
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Event struct {
+	Type      string            `json:"type"`
+	Tags      map[string]string `json:"tags"`
+	Data      any               `json:"data"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+var hooks []Hook
+
+// AddHook 注册事件的接收方，需要在服务启动前调用
+func AddHook(injectHook Hook) {
+	hooks = append(hooks, injectHook)
+}
+
+// Emit 触发事件，实现方不能阻塞调用方
+func Emit(eventType string, tags map[string]string, data any) {
+	if len(hooks) <= 0 {
+		return
+	}
+
+	event := &Event{
+		Type:      eventType,
+		Tags:      tags,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+	for _, h := range hooks {
+		h.Emit(event)
+	}
+}
+
+type Hook interface {
+	Emit(event *Event)
+}
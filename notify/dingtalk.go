@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dingTalkSign 钉钉以 secret 为密钥对 timestamp\nsecret 签名，时间戳单位毫秒
+func dingTalkSign(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func dingTalkFormat(webhookUrl string, secret string, msg *Message, now time.Time) (string, any, error) {
+	text := []string{"### " + msg.Title}
+	text = append(text, msg.Lines...)
+	if msg.Link != "" {
+		text = append(text, fmt.Sprintf("[%s](%s)", msg.LinkText, msg.Link))
+	}
+
+	if secret != "" {
+		u, err := url.Parse(webhookUrl)
+		if err != nil {
+			return "", nil, err
+		}
+
+		timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+		query := u.Query()
+		query.Set("timestamp", timestamp)
+		query.Set("sign", dingTalkSign(secret, timestamp))
+		u.RawQuery = query.Encode()
+		webhookUrl = u.String()
+	}
+
+	return webhookUrl, map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]any{
+			"title": msg.Title,
+			"text":  strings.Join(text, "\n\n"),
+		},
+	}, nil
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+type feishuElement struct {
+	Tag  string `json:"tag"`
+	Text string `json:"text"`
+	Href string `json:"href,omitempty"`
+}
+
+// feishuSign 飞书以 timestamp\nsecret 为密钥对空字符串签名
+func feishuSign(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func feishuFormat(url string, secret string, msg *Message, now time.Time) (string, any, error) {
+	content := [][]*feishuElement{}
+	for _, line := range msg.Lines {
+		content = append(content, []*feishuElement{{Tag: "text", Text: line}})
+	}
+
+	if msg.Link != "" {
+		content = append(content, []*feishuElement{{Tag: "a", Text: msg.LinkText, Href: msg.Link}})
+	}
+
+	body := map[string]any{
+		"msg_type": "post",
+		"content": map[string]any{
+			"post": map[string]any{
+				"zh_cn": map[string]any{
+					"title":   msg.Title,
+					"content": content,
+				},
+			},
+		},
+	}
+	if secret != "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		body["timestamp"] = timestamp
+		body["sign"] = feishuSign(secret, timestamp)
+	}
+
+	return url, body, nil
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	Feishu   = "feishu"
+	DingTalk = "dingtalk"
+	WeCom    = "wecom"
+	Slack    = "slack"
+
+	// 请求失败时记录的响应内容长度
+	responseErrorSize = 512
+)
+
+// Message 与平台无关的消息内容，由各平台的格式转换成请求体
+type Message struct {
+	Title    string
+	Lines    []string
+	Link     string
+	LinkText string
+}
+
+// format 返回实际请求的地址和请求体，签名需要放在地址中的平台会修改地址
+type format func(url string, secret string, msg *Message, now time.Time) (string, any, error)
+
+var formats = map[string]format{
+	Feishu:   feishuFormat,
+	DingTalk: dingTalkFormat,
+	WeCom:    weComFormat,
+	Slack:    slackFormat,
+}
+
+func IsSupported(channelType string) bool {
+	_, ok := formats[channelType]
+	return ok
+}
+
+type Sender struct {
+	client *http.Client
+}
+
+func NewSender(timeout time.Duration) *Sender {
+	return &Sender{
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *Sender) Send(channelType string, url string, secret string, msg *Message) error {
+	f, ok := formats[channelType]
+	if !ok {
+		return fmt.Errorf("notify channel type %s is not supported", channelType)
+	}
+
+	url, body, err := f(url, secret, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	resContent, _ := io.ReadAll(io.LimitReader(res.Body, responseErrorSize))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("response status %d, %s", res.StatusCode, strings.TrimSpace(string(resContent)))
+	}
+
+	return checkResponse(resContent)
+}
+
+// botResponse 飞书使用 code 或 StatusCode，钉钉和企业微信使用 errcode，Slack 成功时返回纯文本 ok
+type botResponse struct {
+	Code          *int   `json:"code"`
+	Msg           string `json:"msg"`
+	StatusCode    *int   `json:"StatusCode"`
+	StatusMessage string `json:"StatusMessage"`
+	ErrCode       *int   `json:"errcode"`
+	ErrMsg        string `json:"errmsg"`
+}
+
+// checkResponse 机器人接口出错时 HTTP 状态码仍然是 200，需要检查响应中的错误码
+func checkResponse(content []byte) error {
+	res := &botResponse{}
+	if json.Unmarshal(content, res) != nil {
+		return nil
+	}
+
+	if res.Code != nil && *res.Code != 0 {
+		return fmt.Errorf("bot error %d, %s", *res.Code, res.Msg)
+	}
+
+	if res.StatusCode != nil && *res.StatusCode != 0 {
+		return fmt.Errorf("bot error %d, %s", *res.StatusCode, res.StatusMessage)
+	}
+
+	if res.ErrCode != nil && *res.ErrCode != 0 {
+		return fmt.Errorf("bot error %d, %s", *res.ErrCode, res.ErrMsg)
+	}
+
+	return nil
+}
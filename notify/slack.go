@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// slackFormat Slack incoming webhook 的地址本身就是凭据，secret 会被忽略
+func slackFormat(url string, secret string, msg *Message, now time.Time) (string, any, error) {
+	text := []string{"*" + msg.Title + "*"}
+	text = append(text, msg.Lines...)
+	if msg.Link != "" {
+		text = append(text, fmt.Sprintf("<%s|%s>", msg.Link, msg.LinkText))
+	}
+
+	return url, map[string]any{
+		"text": strings.Join(text, "\n"),
+	}, nil
+}
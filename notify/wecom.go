@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weComFormat 企业微信机器人不支持签名，secret 会被忽略
+func weComFormat(url string, secret string, msg *Message, now time.Time) (string, any, error) {
+	text := []string{"**" + msg.Title + "**"}
+	for _, line := range msg.Lines {
+		text = append(text, "> "+line)
+	}
+
+	if msg.Link != "" {
+		text = append(text, fmt.Sprintf("[%s](%s)", msg.LinkText, msg.Link))
+	}
+
+	return url, map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]any{
+			"content": strings.Join(text, "\n"),
+		},
+	}, nil
+}
@@ -0,0 +1,35 @@
+package room
+
+import (
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/event"
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/hook"
+)
+
+// RoomHookData 房间事件的数据，不包含房间密码
+type RoomHookData struct {
+	Address     *event.Address   `json:"address"`
+	Name        string           `json:"name"`
+	Group       string           `json:"group"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	Connections int              `json:"connections"`
+	Connection  *room.Connection `json:"connection,omitempty"`
+	CloseCode   string           `json:"closeCode,omitempty"`
+	CloseReason string           `json:"closeReason,omitempty"`
+}
+
+func newRoomHookData(info *room.Info, connections int) *RoomHookData {
+	return &RoomHookData{
+		Address:     info.Address,
+		Name:        info.Name,
+		Group:       info.Group,
+		CreatedAt:   info.CreatedAt,
+		Connections: connections,
+	}
+}
+
+func emitRoomHook(eventType string, info *room.Info, data *RoomHookData) {
+	hook.Emit(eventType, info.Tags, data)
+}
@@ -9,18 +9,33 @@ import (
 	"github.com/HuolalaTech/page-spy-api/api/event"
 	"github.com/HuolalaTech/page-spy-api/api/room"
 	roomApi "github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/hook"
 	"github.com/HuolalaTech/page-spy-api/logger"
 	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/state"
 	"github.com/sirupsen/logrus"
 )
 
-func NewLocalRoomManager(event event.EventEmitter, addressManager *rpc.AddressManager, maxRoomSize int64) *LocalRoomManager {
+// RoomStore 持久化本机的房间信息，服务重启后恢复
+type RoomStore interface {
+	SaveRoom(info *room.Info) error
+	DeleteRoom(address string) error
+	FindRooms(machineId string) ([]*room.Info, error)
+}
+
+func NewLocalRoomManager(event event.EventEmitter, addressManager *rpc.AddressManager, maxRoomSize int64, store RoomStore, reconnectGrace time.Duration, timeouts *TimeoutConfig, replay *ReplayConfig, record *RecordConfig, roles *RoleConfig) *LocalRoomManager {
 	return &LocalRoomManager{
 		BasicManager:   *NewBasicManager(),
 		event:          event,
 		log:            logger.Log().WithField("module", "LocalRoomManager"),
 		maxRoomSize:    maxRoomSize,
 		AddressManager: addressManager,
+		store:          store,
+		reconnectGrace: reconnectGrace,
+		timeouts:       timeouts,
+		replay:         replay,
+		record:         record,
+		roles:          roles,
 	}
 }
 
@@ -30,6 +45,52 @@ type LocalRoomManager struct {
 	event          event.EventEmitter
 	log            *logrus.Entry
 	maxRoomSize    int64
+	store          RoomStore
+	reconnectGrace time.Duration
+	timeouts       *TimeoutConfig
+	replay         *ReplayConfig
+	record         *RecordConfig
+	roles          *RoleConfig
+}
+
+// Restore 恢复重启前的房间，房间处于等待重连状态，reconnectGrace 内没有连接加入时关闭
+func (r *LocalRoomManager) Restore(ctx context.Context) error {
+	infos, err := r.store.FindRooms(r.AddressManager.GetSelfMachineID())
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		createdAt := info.CreatedAt
+		// 上限调低后，已有房间的超时设置改用默认值
+		timeouts, err := r.timeouts.Resolve(info.Timeouts)
+		if err != nil {
+			r.log.WithError(err).Warnf("room %s timeouts exceed the limits, use the default", info.Address.ID)
+			timeouts, _ = r.timeouts.Resolve(nil)
+		}
+
+		info.Timeouts = timeouts
+		rm, err := NewLocalRoom(info, r.event, r.AddressManager, r.store, r.replay, r.record, r.roles)
+		if err != nil {
+			r.log.WithError(err).Errorf("restore room %s failed", info.Address.ID)
+			continue
+		}
+
+		localRoom := rm.(*localRoom)
+		info.CreatedAt = createdAt
+		localRoom.reconnectDeadline = time.Now().Add(r.reconnectGrace)
+		localRoom.SetStatus(state.ReconnectStatus)
+		err = localRoom.Start(ctx)
+		if err != nil {
+			r.log.WithError(err).Errorf("restore room %s failed", info.Address.ID)
+			continue
+		}
+
+		r.addRoom(localRoom)
+	}
+
+	r.log.Infof("restored %d rooms", len(infos))
+	return nil
 }
 
 func (r *LocalRoomManager) Start() {
@@ -81,6 +142,12 @@ func (r *LocalRoomManager) UpdateRoomOption(ctx context.Context, info *room.Info
 	}
 
 	findRoom.Info.Update(info)
+	err := r.store.SaveRoom(findRoom.Info)
+	if err != nil {
+		r.log.WithError(err).Errorf("save room %s failed", info.Address.ID)
+	}
+
+	emitRoomHook(hook.RoomUpdated, findRoom.Info, newRoomHookData(findRoom.Info, len(findRoom.getConnectionsWithLock())))
 	return findRoom, nil
 }
 
@@ -98,7 +165,36 @@ func (r *LocalRoomManager) CreateRoom(ctx context.Context, info *room.Info) (roo
 		return findRoom, nil
 	}
 
-	room, err := NewLocalRoom(info, r.event, r.AddressManager)
+	timeouts, err := r.timeouts.Resolve(info.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Timeouts = timeouts
+	if info.Replay == nil {
+		enabled := r.replay.Enabled
+		info.Replay = &enabled
+	}
+
+	if info.Record == nil {
+		matched := r.record.match(info.Tags)
+		info.Record = &matched
+	}
+
+	if info.ClientToken == "" {
+		info.ClientToken = r.AddressManager.GeneratorLocalID()
+	}
+
+	if info.UseSecret && info.SecretHash == "" {
+		hash, err := roomApi.HashSecret(info.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		info.SecretHash = hash
+	}
+
+	room, err := NewLocalRoom(info, r.event, r.AddressManager, r.store, r.replay, r.record, r.roles)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +205,13 @@ func (r *LocalRoomManager) CreateRoom(ctx context.Context, info *room.Info) (roo
 	}
 
 	r.addRoom(room)
+	room.(*localRoom).refreshExpireAt()
+	err = r.store.SaveRoom(info)
+	if err != nil {
+		r.log.WithError(err).Errorf("save room %s failed", info.Address.ID)
+	}
+
+	emitRoomHook(hook.RoomCreated, info, newRoomHookData(info, 0))
 	return room, nil
 }
 
@@ -121,6 +224,21 @@ func (r *LocalRoomManager) GetRoom(ctx context.Context, opt *room.Info) (room.Ro
 	return room, nil
 }
 
+// SetRecordingStore 由 CoreApi 启动后设置，在此之前关闭的房间保留录制文件
+func (r *LocalRoomManager) SetRecordingStore(store RecordingStore) {
+	r.record.SetStore(store)
+}
+
+// GetReplayMessages 返回连接加入时需要补发的消息，未开启回放时为空
+func (r *LocalRoomManager) GetReplayMessages(ctx context.Context, opt *room.Info, connection *room.Connection) ([]*room.Message, error) {
+	room, exist := r.getLocalRoom(opt)
+	if !exist {
+		return nil, roomApi.NewRoomNotFoundError(fmt.Sprintf("room %s not found", opt.Address.ID))
+	}
+
+	return room.takeReplay(connection), nil
+}
+
 func (r *LocalRoomManager) RemoveRoom(ctx context.Context, opt *room.Info) error {
 	room, exist := r.getRoom(opt)
 	if !exist {
@@ -131,6 +249,50 @@ func (r *LocalRoomManager) RemoveRoom(ctx context.Context, opt *room.Info) error
 	return room.Close(ctx, "remove")
 }
 
+// GetRoomDetail 返回房间的连接、消息数和活跃时间
+func (r *LocalRoomManager) GetRoomDetail(ctx context.Context, opt *room.Info) (*room.Detail, error) {
+	room, exist := r.getLocalRoom(opt)
+	if !exist {
+		return nil, roomApi.NewRoomNotFoundError(fmt.Sprintf("room %s not found", opt.Address.ID))
+	}
+
+	room.refreshExpireAt()
+	return room.detail(), nil
+}
+
+// CloseRoom 管理员关闭房间，所有连接收到带有 reason 的 close 消息
+func (r *LocalRoomManager) CloseRoom(ctx context.Context, opt *room.Info, reason string) error {
+	room, exist := r.getLocalRoom(opt)
+	if !exist || room.IsClose() {
+		return roomApi.NewRoomNotFoundError(fmt.Sprintf("room %s not found", opt.Address.ID))
+	}
+
+	room.setCloseReason("admin", reason)
+	r.removeRoom(room)
+	return room.Close(ctx, "admin")
+}
+
+// KickConnection 被踢出的连接收到 close 消息，房间内其他连接收到 leave 消息
+func (r *LocalRoomManager) KickConnection(ctx context.Context, opt *room.Info, connectionId string, reason string) error {
+	room, exist := r.getLocalRoom(opt)
+	if !exist || room.IsClose() {
+		return roomApi.NewRoomNotFoundError(fmt.Sprintf("room %s not found", opt.Address.ID))
+	}
+
+	connection := room.findConnection(connectionId)
+	if connection == nil {
+		return roomApi.NewClientError("connection %s not found in room %s", connectionId, opt.Address.ID)
+	}
+
+	// 连接所在节点不可用时也要移出房间
+	err := room.kick(ctx, connection, reason)
+	if err != nil {
+		r.log.WithError(err).Errorf("send close message to kicked connection %s failed", connectionId)
+	}
+
+	return r.LeaveRoom(ctx, opt, connection)
+}
+
 func (r *LocalRoomManager) getLocalRoom(opt *room.Info) (*localRoom, bool) {
 	room, exist := r.getRoom(opt)
 	if !exist {
@@ -155,6 +317,9 @@ func (r *LocalRoomManager) JoinRoom(ctx context.Context, opt *room.Info, connect
 		return err
 	}
 
+	data := newRoomHookData(room.Info, len(room.getConnectionsWithLock()))
+	data.Connection = connection
+	emitRoomHook(hook.RoomJoined, room.Info, data)
 	return nil
 }
 
@@ -164,13 +329,18 @@ func (r *LocalRoomManager) LeaveRoom(ctx context.Context, opt *room.Info, connec
 		return roomApi.NewRoomNotFoundError(fmt.Sprintf("room %s not found, leave failed", opt.Address.ID))
 	}
 
-	if room.IsClose() {
+	// 被踢出的连接断开时已经不在房间中，不再重复发送 leave 消息
+	if room.IsClose() || !room.hasConnection(connection) {
 		return nil
 	}
 
 	err := room.Leave(ctx, connection, opt)
 	if err != nil {
 		r.log.WithError(err).Errorf("room manager leave room %s error", opt.Address.ID)
+	} else {
+		data := newRoomHookData(room.Info, len(room.getConnectionsWithLock()))
+		data.Connection = connection
+		emitRoomHook(hook.RoomLeft, room.Info, data)
 	}
 
 	code, ok := room.ShouldRemove()
@@ -8,17 +8,22 @@ import (
 
 	"github.com/HuolalaTech/page-spy-api/api/event"
 	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/hook"
 	"github.com/HuolalaTech/page-spy-api/metric"
 	"github.com/HuolalaTech/page-spy-api/rpc"
 	"github.com/HuolalaTech/page-spy-api/state"
 	"github.com/sirupsen/logrus"
 )
 
-func NewLocalRoom(opt *room.Info, event event.EventEmitter, addressManager *rpc.AddressManager) (room.Room, error) {
-	if opt.UseSecret && opt.Secret == "" {
+func NewLocalRoom(opt *room.Info, event event.EventEmitter, addressManager *rpc.AddressManager, store RoomStore, replay *ReplayConfig, record *RecordConfig, roles *RoleConfig) (room.Room, error) {
+	if opt.UseSecret && opt.Secret == "" && opt.SecretHash == "" {
 		return nil, fmt.Errorf("room %s use secret but secret is empty", opt.Address.ID)
 	}
 
+	if opt.Timeouts == nil {
+		return nil, fmt.Errorf("room %s timeouts is empty", opt.Address.ID)
+	}
+
 	opt.Connections = make([]*room.Connection, 0)
 	opt.CreatedAt = time.Now()
 	opt.ActiveAt = time.Now()
@@ -26,15 +31,38 @@ func NewLocalRoom(opt *room.Info, event event.EventEmitter, addressManager *rpc.
 	logger := log.WithField("room", opt.Address.ID)
 	logger.Infof("local room created")
 
-	return &localRoom{
+	r := &localRoom{
 		basicRoom:   newBasicRoom(),
 		closeCode:   "unknown",
 		closeReason: "unknown",
 		log:         logger,
 		Info:        opt,
 		event:       event,
+		store:       store,
+		roles:       roles,
 		messages:    make(chan *room.Message, 2000),
-	}, nil
+
+		messageCounts:      map[string]int64{},
+		connectionActiveAt: map[string]time.Time{},
+	}
+
+	if opt.Replay != nil && *opt.Replay {
+		r.replayConfig = replay
+		r.replay = newReplayBuffer(replay)
+		r.pendingReplays = map[string][]*room.Message{}
+	}
+
+	if opt.Record != nil && *opt.Record {
+		recorder, err := openRecorder(opt.Address.ID, record.MaxSize)
+		if err != nil {
+			logger.WithError(err).Error("open recording failed, the room is not recorded")
+		} else {
+			r.recordConfig = record
+			r.recorder = recorder
+		}
+	}
+
+	return r, nil
 }
 
 type localRoom struct {
@@ -45,7 +73,21 @@ type localRoom struct {
 	rwLock      sync.RWMutex
 	Info        *room.Info
 	event       event.EventEmitter
+	store       RoomStore
+	roles       *RoleConfig
 	messages    chan *room.Message
+	// reconnectDeadline 重启恢复的房间在该时间前没有连接加入时关闭
+	reconnectDeadline time.Time
+	// replay 未开启回放时为空，pendingReplays 保存连接加入时待补发的消息
+	replayConfig   *ReplayConfig
+	replay         *replayBuffer
+	pendingReplays map[string][]*room.Message
+	// recorder 未开启录制或打开文件失败时为空
+	recordConfig *RecordConfig
+	recorder     *recorder
+	// messageCounts 经过房间的各类型消息数，connectionActiveAt 连接最后一次发送广播的时间
+	messageCounts      map[string]int64
+	connectionActiveAt map[string]time.Time
 }
 
 func (r *localRoom) GetRoomAddress() *event.Address {
@@ -97,10 +139,15 @@ func (r *localRoom) Start(ctx context.Context) error {
 	return nil
 }
 
+// addConnectionWithLock 与广播共用锁，加入前的消息进入待补发列表，之后的消息直接推送，不会重复或丢失
 func (r *localRoom) addConnectionWithLock(connection *room.Connection) {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 	r.Info.Connections = append(r.Info.Connections, connection)
+	r.connectionActiveAt[connection.Address.ID] = time.Now()
+	if r.replay != nil && !r.replayConfig.isSource(connection) {
+		r.pendingReplays[connection.Address.ID] = r.replay.snapshot(connection.Role)
+	}
 }
 
 func (r *localRoom) removeConnectionWithLock(connection *room.Connection) {
@@ -113,15 +160,124 @@ func (r *localRoom) removeConnectionWithLock(connection *room.Connection) {
 		}
 	}
 
+	if r.replay != nil {
+		delete(r.pendingReplays, connection.Address.ID)
+	}
+
+	delete(r.connectionActiveAt, connection.Address.ID)
 	r.Info.Connections = newConnections
 }
 
+func (r *localRoom) hasConnection(connection *room.Connection) bool {
+	return r.findConnection(connection.Address.ID) != nil
+}
+
+func (r *localRoom) findConnection(id string) *room.Connection {
+	for _, c := range r.getConnectionsWithLock() {
+		if c.Address.ID == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// trackMessageWithLock 记录消息数和发送者的活跃时间，单播消息不经过房间
+func (r *localRoom) trackMessageWithLock(msg *room.Message) {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+	r.messageCounts[msg.Type]++
+
+	var from string
+	switch content := msg.Content.(type) {
+	case *room.BroadcastMessageContent:
+		if content.From != nil && content.From.Address != nil {
+			from = content.From.Address.ID
+		}
+	case *room.PingContent:
+		from = content.From.ID
+	}
+
+	_, ok := r.connectionActiveAt[from]
+	if ok {
+		r.connectionActiveAt[from] = time.Now()
+	}
+}
+
+func (r *localRoom) detail() *room.Detail {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+	info := *r.Info
+	detail := &room.Detail{
+		Info:          &info,
+		Connections:   make([]*room.ConnectionDetail, 0, len(r.Info.Connections)),
+		MessageCounts: make(map[string]int64, len(r.messageCounts)),
+	}
+
+	for _, c := range r.Info.Connections {
+		detail.Connections = append(detail.Connections, &room.ConnectionDetail{
+			Connection: c,
+			ActiveAt:   r.connectionActiveAt[c.Address.ID],
+		})
+	}
+
+	for t, count := range r.messageCounts {
+		detail.MessageCounts[t] = count
+	}
+
+	return detail
+}
+
+// kick 只给被踢出的连接发送 close 消息，连接随后断开
+func (r *localRoom) kick(ctx context.Context, connection *room.Connection, reason string) error {
+	eventMsg, err := roomMessageToPackage(room.NewCloseMessage(*r.Info.Address, reason), r.Info.Address)
+	if err != nil {
+		return err
+	}
+
+	r.log.Infof("connection %s kicked, %s", connection.Address.ID, reason)
+	return r.event.Emit(ctx, connection.Address, eventMsg)
+}
+
+func (r *localRoom) setCloseReason(code string, reason string) {
+	r.closeCode = code
+	r.closeReason = reason
+}
+
 func (r *localRoom) getConnectionsWithLock() []*room.Connection {
 	r.rwLock.RLock()
 	defer r.rwLock.RUnlock()
 	return r.Info.Connections
 }
 
+// bufferBroadcastWithLock 缓存 SDK 的广播消息，并返回此刻需要推送的连接
+func (r *localRoom) bufferBroadcastWithLock(msg *room.Message, from *room.Connection) []*room.Connection {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+	if r.replay != nil && r.replayConfig.isSource(from) {
+		r.replay.push(msg)
+	}
+
+	return r.Info.Connections
+}
+
+// takeReplay 取出连接加入时待补发的消息，每个连接只能取一次
+func (r *localRoom) takeReplay(connection *room.Connection) []*room.Message {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+	if r.replay == nil {
+		return []*room.Message{}
+	}
+
+	messages, ok := r.pendingReplays[connection.Address.ID]
+	if !ok {
+		return []*room.Message{}
+	}
+
+	delete(r.pendingReplays, connection.Address.ID)
+	return messages
+}
+
 func (r *localRoom) Join(ctx context.Context, connection *room.Connection, opt *room.Info) error {
 	if opt == nil {
 		return nil
@@ -131,10 +287,23 @@ func (r *localRoom) Join(ctx context.Context, connection *room.Connection, opt *
 		return fmt.Errorf("connection %s join room %s failed", connection.Address.ID, opt.Address.ID)
 	}
 
-	if r.Info.UseSecret && r.Info.Secret != opt.Secret {
+	if connection.Role != "" && !room.IsRole(connection.Role) {
+		return fmt.Errorf("connection %s join room %s failed, role %s is not supported", connection.Address.ID, opt.Address.ID, connection.Role)
+	}
+
+	if connection.Role == room.ClientRole && opt.ClientToken != "" && !r.Info.CheckClientToken(opt.ClientToken) {
+		return room.NewPermissionDeniedError("clientToken from connection %s of room %s is invalid", connection.Address.ID, opt.Address.ID)
+	}
+
+	if r.Info.UseSecret && !r.Info.CheckSecret(opt.Secret) {
 		return fmt.Errorf("join failed, password from connection %s of room %s is invalid", connection.Address.ID, opt.Address.ID)
 	}
 
+	// 恢复的房间校验通过后记下明文，后续校验不再计算哈希
+	if r.Info.UseSecret && r.Info.Secret == "" {
+		r.Info.Secret = opt.Secret
+	}
+
 	r.log.Infof("connection %s joined room", connection.Address.ID)
 	r.addConnectionWithLock(connection)
 	r.SendMessageWithTimeout(room.NewJoinMessage(connection), 5*time.Second)
@@ -191,7 +360,7 @@ func (r *localRoom) broadcastMessage(ctx context.Context, msg *room.Message) err
 		return fmt.Errorf("message format is invalid")
 	}
 
-	connections := r.getConnectionsWithLock()
+	connections := r.bufferBroadcastWithLock(msg, content.From)
 	eventMsg, err := roomMessageToPackage(msg, r.Info.Address)
 	if err != nil {
 		return err
@@ -199,6 +368,10 @@ func (r *localRoom) broadcastMessage(ctx context.Context, msg *room.Message) err
 
 	r.Info.ActiveAt = time.Now()
 	for _, c := range connections {
+		if content.ToRole != "" && c.Role != content.ToRole {
+			continue
+		}
+
 		if !(c.Address.Equal(content.From.Address) && !content.IncludeSelf) {
 			e := r.event.Emit(ctx, c.Address, eventMsg)
 			if e != nil {
@@ -246,7 +419,14 @@ func (r *localRoom) SendMessage(ctx context.Context, msg *room.Message) error {
 		return fmt.Errorf("message type %s not found", msg.Type)
 	}
 
+	err := r.checkPermission(msg)
+	if err != nil {
+		return err
+	}
+
+	r.trackMessageWithLock(msg)
 	r.Info.ActiveAt = time.Now()
+	r.record(msg)
 	switch msg.Type {
 	case room.MessageType:
 		return r.messageMessage(ctx, msg)
@@ -263,6 +443,55 @@ func (r *localRoom) SendMessage(ctx context.Context, msg *room.Message) error {
 	return fmt.Errorf("message type %s is not supported to be sent by normal user", msg.Type)
 }
 
+// checkPermission 校验发送者的角色，房间自身发出的消息没有发送者
+func (r *localRoom) checkPermission(msg *room.Message) error {
+	switch content := msg.Content.(type) {
+	case *room.BroadcastMessageContent:
+		return r.roles.CheckSend(content.From, msg.Type)
+	case *room.MessageMessageContent:
+		return r.roles.CheckSend(content.From, msg.Type)
+	}
+
+	return nil
+}
+
+// record 录制除 ping 以外经过房间的消息
+func (r *localRoom) record(msg *room.Message) {
+	if r.recorder == nil || msg.Type == room.PingType {
+		return
+	}
+
+	err := r.recorder.write(msg)
+	if err != nil {
+		r.log.WithError(err).Error("record message failed")
+	}
+}
+
+// saveRecording 房间关闭后在后台保存录制文件，保存失败时保留文件
+func (r *localRoom) saveRecording() {
+	if r.recorder == nil {
+		return
+	}
+
+	err := r.recorder.close()
+	if err != nil {
+		r.log.WithError(err).Error("close recording failed")
+	}
+
+	store := r.recordConfig.getStore()
+	if store == nil {
+		r.log.Errorf("recording store is not ready, keep %s", r.recorder.path)
+		return
+	}
+
+	go func() {
+		err := store.SaveRecording(r.Info, r.recorder.path)
+		if err != nil {
+			r.log.WithError(err).Errorf("save recording failed, keep %s", r.recorder.path)
+		}
+	}()
+}
+
 func (r *localRoom) SendMessageWithTimeout(msg *room.Message, timeout time.Duration) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -293,7 +522,17 @@ func (r *localRoom) Close(ctx context.Context, closeCode string) error {
 
 	r.event.RemoveListener(r.Info.Address, r)
 	r.log.Infof("room closed, %s", r.closeReason)
+	err = r.store.DeleteRoom(r.Info.Address.ID)
+	if err != nil {
+		r.log.WithError(err).Error("delete persisted room failed")
+	}
+
+	data := newRoomHookData(r.Info, len(r.getConnectionsWithLock()))
+	data.CloseCode = closeCode
+	data.CloseReason = r.closeReason
+	emitRoomHook(hook.RoomClosed, r.Info, data)
 	r.SendMessageWithTimeout(room.NewCloseMessage(*r.Info.Address, r.closeReason), 5*time.Second)
+	r.saveRecording()
 	return nil
 }
 
@@ -303,26 +542,61 @@ func (r *localRoom) ShouldRemove() (string, bool) {
 	}
 
 	now := time.Now()
-	noUseInitRoom := r.IsStatus(state.InitStatus) && r.isEmpty() && now.Sub(r.Info.CreatedAt) > 1*time.Minute
-	noUserRoom := r.IsStatus(state.RunningStatus) && r.isEmpty() && now.Sub(r.Info.ActiveAt) > 1*time.Minute
-	noUseRoom := r.IsStatus(state.RunningStatus) && now.Sub(r.Info.ActiveAt) > 5*time.Minute
-	maxTimeRoom := now.Sub(r.Info.CreatedAt) > 1*time.Hour
+	timeouts := r.Info.Timeouts
+	noUseInitRoom := r.IsStatus(state.InitStatus) && r.isEmpty() && now.Sub(r.Info.CreatedAt) > timeouts.EmptyTimeout()
+	noUserRoom := r.IsStatus(state.RunningStatus) && r.isEmpty() && now.Sub(r.Info.ActiveAt) > timeouts.EmptyTimeout()
+	noUseRoom := r.IsStatus(state.RunningStatus) && now.Sub(r.Info.ActiveAt) > timeouts.IdleTimeout()
+	maxTimeRoom := now.Sub(r.Info.CreatedAt) > timeouts.LifeTime()
+	noReconnectRoom := r.IsStatus(state.ReconnectStatus) && r.isEmpty() && now.After(r.reconnectDeadline)
 	switch true {
+	case noReconnectRoom:
+		r.closeReason = "no user reconnected after server restart"
+		r.closeCode = "noReconnectRoom"
 	case noUseInitRoom:
-		r.closeReason = "no user connection for more than 1 minute after room setup"
+		r.closeReason = fmt.Sprintf("no user connection for more than %s after room setup", formatTimeout(timeouts.EmptyTimeout()))
 		r.closeCode = "noUseInitRoom"
 	case noUserRoom:
-		r.closeReason = "all the user of room left over 1 minutes"
+		r.closeReason = fmt.Sprintf("all the user of room left over %s", formatTimeout(timeouts.EmptyTimeout()))
 		r.closeCode = "noUserRoom"
 	case noUseRoom:
-		r.closeReason = "room idle over 5 minutes"
+		r.closeReason = fmt.Sprintf("room idle over %s", formatTimeout(timeouts.IdleTimeout()))
 		r.closeCode = "noUseRoom"
 	case maxTimeRoom:
-		r.closeReason = "room exceeded the maximum time 1 hour"
+		r.closeReason = fmt.Sprintf("room exceeded the maximum time %s", formatTimeout(timeouts.LifeTime()))
 		r.closeCode = "maxTimeRoom"
 	}
 
-	return r.closeCode, noUseInitRoom || noUserRoom || noUseRoom || maxTimeRoom
+	return r.closeCode, noReconnectRoom || noUseInitRoom || noUserRoom || noUseRoom || maxTimeRoom
+}
+
+// refreshExpireAt 按 ShouldRemove 的规则推算房间最早的关闭时间
+func (r *localRoom) refreshExpireAt() {
+	timeouts := r.Info.Timeouts
+	expireAt := r.Info.CreatedAt.Add(timeouts.LifeTime())
+	earlier := func(t time.Time) {
+		if t.Before(expireAt) {
+			expireAt = t
+		}
+	}
+
+	empty := r.isEmpty()
+	switch {
+	case r.IsStatus(state.ReconnectStatus):
+		if empty {
+			earlier(r.reconnectDeadline)
+		}
+	case r.IsStatus(state.InitStatus):
+		if empty {
+			earlier(r.Info.CreatedAt.Add(timeouts.EmptyTimeout()))
+		}
+	case r.IsStatus(state.RunningStatus):
+		earlier(r.Info.ActiveAt.Add(timeouts.IdleTimeout()))
+		if empty {
+			earlier(r.Info.ActiveAt.Add(timeouts.EmptyTimeout()))
+		}
+	}
+
+	r.Info.ExpireAt = expireAt
 }
 
 func (r *localRoom) isEmpty() bool {
@@ -0,0 +1,93 @@
+package room
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/metric"
+)
+
+const (
+	DropOldestPolicy = "dropOldest"
+	DropTypePolicy   = "dropType"
+	DisconnectPolicy = "disconnect"
+)
+
+// QueueConfig 每个连接的发送队列设置
+type QueueConfig struct {
+	Size      int
+	Policy    string
+	DropTypes map[string]bool
+}
+
+func CheckQueuePolicy(policy string) error {
+	switch policy {
+	case DropOldestPolicy, DropTypePolicy, DisconnectPolicy:
+		return nil
+	}
+
+	return fmt.Errorf("room queue policy %s is not supported, use %s, %s or %s", policy, DropOldestPolicy, DropTypePolicy, DisconnectPolicy)
+}
+
+// connectionQueue 连接的发送队列，写入不阻塞，慢连接不会拖住房间和其他连接
+type connectionQueue struct {
+	lock     sync.Mutex
+	config   *QueueConfig
+	messages chan *room.Message
+}
+
+func newConnectionQueue(config *QueueConfig) *connectionQueue {
+	return &connectionQueue{
+		config:   config,
+		messages: make(chan *room.Message, config.Size),
+	}
+}
+
+func (q *connectionQueue) drop(msg *room.Message) {
+	metric.Count("page_spy_connection_queue_drop", map[string]string{
+		"policy": q.config.Policy,
+		"type":   msg.Type,
+	}, 1)
+}
+
+// push 队列满时按策略处理，返回 false 表示需要断开连接
+// dropType 策略优先丢弃新到的指定类型消息，其他类型的消息挤掉队列中最早的消息
+func (q *connectionQueue) push(msg *room.Message) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	defer func() {
+		metric.Summary("page_spy_connection_queue_depth", map[string]string{}, float64(len(q.messages)))
+	}()
+
+	select {
+	case q.messages <- msg:
+		return true
+	default:
+	}
+
+	switch q.config.Policy {
+	case DisconnectPolicy:
+		q.drop(msg)
+		return false
+	case DropTypePolicy:
+		if q.config.DropTypes[msg.Type] {
+			q.drop(msg)
+			return true
+		}
+	}
+
+	select {
+	case old := <-q.messages:
+		q.drop(old)
+	default:
+	}
+
+	select {
+	case q.messages <- msg:
+	default:
+		q.drop(msg)
+	}
+
+	return true
+}
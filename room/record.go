@@ -0,0 +1,136 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+)
+
+const recordDirPath = "./data/recording"
+
+// RecordingStore 房间关闭后保存录制文件，由 CoreApi 实现
+type RecordingStore interface {
+	SaveRecording(info *room.Info, path string) error
+}
+
+type RecordTag struct {
+	Key   string
+	Value string
+}
+
+// RecordConfig 房间录制的设置，带有 Tags 中任一标签的房间默认录制
+type RecordConfig struct {
+	Tags    []*RecordTag
+	MaxSize int64
+	store   atomic.Value
+}
+
+func (c *RecordConfig) SetStore(store RecordingStore) {
+	c.store.Store(store)
+}
+
+func (c *RecordConfig) getStore() RecordingStore {
+	store, _ := c.store.Load().(RecordingStore)
+	return store
+}
+
+func (c *RecordConfig) match(tags map[string]string) bool {
+	for _, t := range c.Tags {
+		value, ok := tags[t.Key]
+		if ok && value == t.Value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func recordPath(address string) string {
+	return filepath.Join(recordDirPath, address+".ndjson")
+}
+
+// recorder 把房间消息逐行追加到 NDJSON 文件，服务重启后恢复的房间继续追加到同一个文件
+type recorder struct {
+	lock    sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	maxSize int64
+	full    bool
+}
+
+func openRecorder(address string, maxSize int64) (*recorder, error) {
+	err := os.MkdirAll(recordDirPath, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	path := recordPath(address)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &recorder{
+		path:    path,
+		file:    file,
+		size:    stat.Size(),
+		maxSize: maxSize,
+	}, nil
+}
+
+var errRecordingFull = errors.New("recording exceeds the max size, the rest of the room is not recorded")
+
+// write 超过大小上限后不再写入，只在第一次超出时返回 errRecordingFull
+// SDK 发送的消息没有 createdAt，使用写入时间，作为转换成日志后的时间戳
+func (r *recorder) write(msg *room.Message) error {
+	if msg.CreatedAt == 0 {
+		stamped := *msg
+		stamped.CreatedAt = time.Now().UnixNano() / int64(time.Millisecond)
+		msg = &stamped
+	}
+
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil || r.full {
+		return nil
+	}
+
+	if r.size+int64(len(bs))+1 > r.maxSize {
+		r.full = true
+		return errRecordingFull
+	}
+
+	n, err := r.file.Write(append(bs, '\n'))
+	r.size += int64(n)
+	return err
+}
+
+func (r *recorder) close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
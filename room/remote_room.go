@@ -12,7 +12,13 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func NewRemoteRoom(connection *room.Connection, opt *room.Info, eventEmitter event.EventEmitter, rpcRoom room.RpcRoom) (room.RemoteRoom, error) {
+func NewRemoteRoom(connection *room.Connection, opt *room.Info, eventEmitter event.EventEmitter, rpcRoom room.RpcRoom, timeouts *TimeoutConfig, queue *QueueConfig) (room.RemoteRoom, error) {
+	// 远端房间的存活时间由所在节点决定，旧版本节点没有返回时使用本机默认值
+	lifeTime := timeouts.Default.LifeTime()
+	if info := rpcRoom.GetInfo(); info != nil && info.Timeouts != nil {
+		lifeTime = info.Timeouts.LifeTime()
+	}
+
 	r := &remoteRoom{
 		basicRoom:    newBasicRoom(),
 		connection:   connection,
@@ -20,9 +26,11 @@ func NewRemoteRoom(connection *room.Connection, opt *room.Info, eventEmitter eve
 		log:          log.WithField("remote_room", connection.Address.ID).WithField("local_room", opt.Address.ID),
 		eventEmitter: eventEmitter,
 		rpcRoom:      rpcRoom,
-		messages:     make(chan *room.Message, 2000),
+		queue:        newConnectionQueue(queue),
 		createdAt:    time.Now(),
 		activeAt:     time.Now(),
+		lifeTime:     lifeTime,
+		idleTimeout:  timeouts.RemoteIdle,
 	}
 	r.log.Infof("remote room %s created", opt.Address.ID)
 	return r, nil
@@ -35,9 +43,11 @@ type remoteRoom struct {
 	opt          *room.Info
 	eventEmitter event.EventEmitter
 	rpcRoom      room.RpcRoom
-	messages     chan *room.Message
+	queue        *connectionQueue
 	createdAt    time.Time
 	activeAt     time.Time
+	lifeTime     time.Duration
+	idleTimeout  time.Duration
 }
 
 func (r *remoteRoom) GetRoomAddress() *event.Address {
@@ -126,7 +136,7 @@ func (r *remoteRoom) SendMessage(ctx context.Context, msg *room.Message) error {
 }
 
 func (r *remoteRoom) OnMessage() chan *room.Message {
-	return r.messages
+	return r.queue.messages
 }
 
 func (r *remoteRoom) Close(ctx context.Context, code string) error {
@@ -150,7 +160,7 @@ func (r *remoteRoom) ShouldRemove() (string, bool) {
 	}
 
 	now := time.Now()
-	return "timeout", now.Sub(r.createdAt) > 1*time.Hour || now.Sub(r.activeAt) > 20*time.Second
+	return "timeout", now.Sub(r.createdAt) > r.lifeTime || now.Sub(r.activeAt) > r.idleTimeout
 }
 
 func (r *remoteRoom) Listen(ctx context.Context, msg *event.Package) {
@@ -168,17 +178,15 @@ func (r *remoteRoom) Listen(ctx context.Context, msg *event.Package) {
 		}, float64(time.Since(start).Milliseconds()))
 	}()
 
-	select {
-	case r.messages <- roomMsg:
-		if roomMsg.Type == room.CloseType {
-			r.log.Infof("received close message")
-			r.Close(ctx, "remote_close")
-		}
-
-		return
-	case <-ctx.Done():
-		status = "timeout"
-		r.log.Errorf("consume message %s timeout", msg.Content)
+	if !r.queue.push(roomMsg) {
+		status = "slow_consumer"
+		r.log.Errorf("message queue of connection is full, disconnect")
+		r.Close(ctx, "slow_consumer")
 		return
 	}
+
+	if roomMsg.Type == room.CloseType {
+		r.log.Infof("received close message")
+		r.Close(ctx, "remote_close")
+	}
 }
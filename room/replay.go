@@ -0,0 +1,97 @@
+package room
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+)
+
+// ReplayConfig 房间消息回放的设置，UserIds 为 SDK 连接的 userId
+type ReplayConfig struct {
+	Enabled     bool
+	MaxMessages int
+	MaxSize     int64
+	MaxAge      time.Duration
+	UserIds     map[string]bool
+}
+
+func (c *ReplayConfig) isSource(connection *room.Connection) bool {
+	return connection != nil && c.UserIds[connection.UserID]
+}
+
+type replayMessage struct {
+	message   *room.Message
+	size      int64
+	createdAt time.Time
+}
+
+// replayBuffer 缓存 SDK 广播的消息，超过条数、大小或时间限制时淘汰最早的消息，调用方负责加锁
+type replayBuffer struct {
+	config   *ReplayConfig
+	messages []*replayMessage
+	size     int64
+}
+
+func newReplayBuffer(config *ReplayConfig) *replayBuffer {
+	return &replayBuffer{
+		config:   config,
+		messages: make([]*replayMessage, 0),
+	}
+}
+
+func (b *replayBuffer) push(msg *room.Message) {
+	replayed := *msg
+	replayed.Replayed = true
+	bs, err := json.Marshal(&replayed)
+	if err != nil {
+		return
+	}
+
+	size := int64(len(bs))
+	if size > b.config.MaxSize {
+		return
+	}
+
+	b.messages = append(b.messages, &replayMessage{
+		message:   &replayed,
+		size:      size,
+		createdAt: time.Now(),
+	})
+	b.size += size
+	b.evict()
+}
+
+func (b *replayBuffer) evict() {
+	deadline := time.Now().Add(-b.config.MaxAge)
+	n := 0
+	for n < len(b.messages) {
+		m := b.messages[n]
+		if len(b.messages)-n <= b.config.MaxMessages && b.size <= b.config.MaxSize && m.createdAt.After(deadline) {
+			break
+		}
+
+		b.size -= m.size
+		n++
+	}
+
+	if n > 0 {
+		b.messages = append(make([]*replayMessage, 0, len(b.messages)-n), b.messages[n:]...)
+	}
+}
+
+// snapshot 指定了接收角色的消息只补发给该角色
+func (b *replayBuffer) snapshot(role string) []*room.Message {
+	b.evict()
+	messages := make([]*room.Message, 0, len(b.messages))
+	for _, m := range b.messages {
+		content, ok := m.message.Content.(*room.BroadcastMessageContent)
+		if ok && content.ToRole != "" && content.ToRole != role {
+			continue
+		}
+
+		messages = append(messages, m.message)
+	}
+
+	return messages
+}
@@ -0,0 +1,113 @@
+package room
+
+import (
+	"fmt"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+)
+
+// DefaultPermissions 每种角色默认可以发送的消息类型，观察者只读
+var DefaultPermissions = map[string][]string{
+	room.ClientRole:   {room.BroadcastType, room.MessageType, room.PingType, room.UpdateRoomInfoType},
+	room.DebuggerRole: {room.BroadcastType, room.MessageType, room.PingType, room.UpdateRoomInfoType},
+	room.ObserverRole: {room.PingType},
+}
+
+// RoleConfig 连接角色的设置，ClientUserIds 用于识别未指定角色的 SDK 连接
+type RoleConfig struct {
+	ClientUserIds map[string]bool
+	DebuggerAuth  bool
+	Permissions   map[string]map[string]bool
+}
+
+// Resolve 未指定角色时按 userId 推断，authorized 表示请求带有有效的登录令牌
+// 开启 debuggerAuth 后只有观察者可以匿名加入，未登录的 SDK 需要带上创建房间时返回的 clientToken，由房间所在节点校验
+func (c *RoleConfig) Resolve(role string, userId string, authorized bool, clientToken string) (string, error) {
+	if role == "" {
+		role = room.DebuggerRole
+		if c.ClientUserIds[userId] {
+			role = room.ClientRole
+		}
+	}
+
+	if !room.IsRole(role) {
+		return "", room.NewClientError("role %s is not supported, use %s, %s or %s", role, room.ClientRole, room.DebuggerRole, room.ObserverRole)
+	}
+
+	if !c.DebuggerAuth || authorized {
+		return role, nil
+	}
+
+	switch role {
+	case room.DebuggerRole:
+		return "", room.NewPermissionDeniedError("joining as %s requires a valid token", role)
+	case room.ClientRole:
+		if clientToken == "" {
+			return "", room.NewPermissionDeniedError("joining as %s requires a valid token or the clientToken of the room", role)
+		}
+	}
+
+	return role, nil
+}
+
+// CanSend 没有角色的连接来自旧版本节点，不做限制
+func (c *RoleConfig) CanSend(connection *room.Connection, messageType string) bool {
+	if connection == nil || connection.Role == "" {
+		return true
+	}
+
+	return c.Permissions[connection.Role][messageType]
+}
+
+func (c *RoleConfig) CheckSend(connection *room.Connection, messageType string) error {
+	if c.CanSend(connection, messageType) {
+		return nil
+	}
+
+	return room.NewPermissionDeniedError("role %s is not allowed to send %s messages", connection.Role, messageType)
+}
+
+// NewPermissions 配置中列出的角色替换默认权限
+func NewPermissions(permissions map[string][]string) (map[string]map[string]bool, error) {
+	res := map[string]map[string]bool{}
+	for role, types := range DefaultPermissions {
+		res[role] = map[string]bool{}
+		for _, t := range types {
+			res[role][t] = true
+		}
+	}
+
+	for role, types := range permissions {
+		if !room.IsRole(role) {
+			return nil, fmt.Errorf("room role %s in permissions is not supported", role)
+		}
+
+		res[role] = map[string]bool{}
+		for _, t := range types {
+			if !room.IsPublicMessageType(t) {
+				return nil, fmt.Errorf("message type %s in permissions of role %s can not be sent by clients", t, role)
+			}
+
+			res[role][t] = true
+		}
+	}
+
+	return res, nil
+}
+
+// CountRoles 统计房间内每种角色的连接数
+func CountRoles(connections []*room.Connection) map[string]int {
+	counts := map[string]int{
+		room.ClientRole:   0,
+		room.DebuggerRole: 0,
+		room.ObserverRole: 0,
+	}
+
+	for _, c := range connections {
+		if c.Role != "" {
+			counts[c.Role]++
+		}
+	}
+
+	return counts
+}
@@ -25,6 +25,8 @@ type RpcLocalRoomManagerResponse struct {
 	Connection *room.Connection
 	Rooms      []*localRoom
 	Room       *localRoom
+	Messages   []*room.Message
+	Detail     *room.Detail
 }
 
 func NewRpcLocalRoomManagerResponse() *RpcLocalRoomManagerResponse {
@@ -34,11 +36,20 @@ func NewRpcLocalRoomManagerResponse() *RpcLocalRoomManagerResponse {
 func (res *RpcLocalRoomManagerResponse) SetRooms(rooms []room.Room) {
 	localRooms := make([]*localRoom, 0, len(rooms))
 	for _, r := range rooms {
-		localRooms = append(localRooms, r.(*localRoom))
+		localRoom := r.(*localRoom)
+		localRoom.refreshExpireAt()
+		localRooms = append(localRooms, localRoom)
 	}
 	res.Rooms = localRooms
 }
 
+// SetRoom 房间序列化前刷新预计关闭时间
+func (res *RpcLocalRoomManagerResponse) SetRoom(r room.Room) {
+	localRoom := r.(*localRoom)
+	localRoom.refreshExpireAt()
+	res.Room = localRoom
+}
+
 func (res *RpcLocalRoomManagerResponse) GetRooms() []room.RemoteRoom {
 	if len((res.Rooms)) <= 0 {
 		return []room.RemoteRoom{}
@@ -57,6 +68,7 @@ type RpcLocalRoomManagerRequest struct {
 	Tags           map[string]string
 	Info           *room.Info
 	Connection     *room.Connection
+	Reason         string
 }
 
 func NewRpcLocalRoomManagerRequest() *RpcLocalRoomManagerRequest {
@@ -94,7 +106,7 @@ func (r *LocalRpcRoomManager) UpdateRoomOption(_ *http.Request, req *RpcLocalRoo
 		return res.SetError(err)
 	}
 
-	res.Room = room.(*localRoom)
+	res.SetRoom(room)
 	return nil
 }
 func (r *LocalRpcRoomManager) CreateRoom(_ *http.Request, req *RpcLocalRoomManagerRequest, res *RpcLocalRoomManagerResponse) error {
@@ -105,7 +117,7 @@ func (r *LocalRpcRoomManager) CreateRoom(_ *http.Request, req *RpcLocalRoomManag
 		return res.SetError(err)
 	}
 
-	res.Room = room.(*localRoom)
+	res.SetRoom(room)
 	return nil
 }
 
@@ -117,7 +129,7 @@ func (r *LocalRpcRoomManager) GetRoom(_ *http.Request, req *RpcLocalRoomManagerR
 		return res.SetError(err)
 	}
 
-	res.Room = room.(*localRoom)
+	res.SetRoom(room)
 	return nil
 }
 
@@ -133,6 +145,42 @@ func (r *LocalRpcRoomManager) LeaveRoom(_ *http.Request, req *RpcLocalRoomManage
 	return res.SetError(r.localRoomManager.LeaveRoom(ctx, req.Info, req.Connection))
 }
 
+func (r *LocalRpcRoomManager) GetReplayMessages(_ *http.Request, req *RpcLocalRoomManagerRequest, res *RpcLocalRoomManagerResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.ContextTimeout)*time.Second)
+	defer cancel()
+	messages, err := r.localRoomManager.GetReplayMessages(ctx, req.Info, req.Connection)
+	if err != nil {
+		return res.SetError(err)
+	}
+
+	res.Messages = messages
+	return nil
+}
+
+func (r *LocalRpcRoomManager) GetRoomDetail(_ *http.Request, req *RpcLocalRoomManagerRequest, res *RpcLocalRoomManagerResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.ContextTimeout)*time.Second)
+	defer cancel()
+	detail, err := r.localRoomManager.GetRoomDetail(ctx, req.Info)
+	if err != nil {
+		return res.SetError(err)
+	}
+
+	res.Detail = detail
+	return nil
+}
+
+func (r *LocalRpcRoomManager) CloseRoom(_ *http.Request, req *RpcLocalRoomManagerRequest, res *RpcLocalRoomManagerResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.ContextTimeout)*time.Second)
+	defer cancel()
+	return res.SetError(r.localRoomManager.CloseRoom(ctx, req.Info, req.Reason))
+}
+
+func (r *LocalRpcRoomManager) KickConnection(_ *http.Request, req *RpcLocalRoomManagerRequest, res *RpcLocalRoomManagerResponse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.ContextTimeout)*time.Second)
+	defer cancel()
+	return res.SetError(r.localRoomManager.KickConnection(ctx, req.Info, req.Connection.Address.ID, req.Reason))
+}
+
 func (r *LocalRpcRoomManager) JoinRoom(_ *http.Request, req *RpcLocalRoomManagerRequest, res *RpcLocalRoomManagerResponse) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.ContextTimeout)*time.Second)
 	defer cancel()
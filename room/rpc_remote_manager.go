@@ -15,23 +15,35 @@ import (
 func NewRemoteRpcRoomManager(addressManager *localRpc.AddressManager,
 	rpcManager *localRpc.RpcManager,
 	event event.EventEmitter,
-	localRoomManager *LocalRoomManager) *RemoteRpcRoomManager {
+	localRoomManager *LocalRoomManager,
+	timeouts *TimeoutConfig,
+	queue *QueueConfig,
+	roles *RoleConfig,
+	stream *RoomStream) *RemoteRpcRoomManager {
 
 	return &RemoteRpcRoomManager{
 		BasicManager:     *NewBasicManager(),
 		AddressManager:   addressManager,
+		Roles:            roles,
+		Stream:           stream,
 		rpcManager:       rpcManager,
 		event:            event,
 		localRoomManager: localRoomManager,
+		timeouts:         timeouts,
+		queue:            queue,
 	}
 }
 
 type RemoteRpcRoomManager struct {
 	BasicManager
 	AddressManager   *localRpc.AddressManager
+	Roles            *RoleConfig
+	Stream           *RoomStream
 	rpcManager       *localRpc.RpcManager
 	event            event.EventEmitter
 	localRoomManager *LocalRoomManager
+	timeouts         *TimeoutConfig
+	queue            *QueueConfig
 }
 
 func (r *RemoteRpcRoomManager) getRpcByAddress(address *event.Address) (*localRpc.RpcClient, error) {
@@ -94,6 +106,9 @@ func (r *RemoteRpcRoomManager) ListRooms(ctx context.Context, tags map[string]st
 	for _, r := range rooms {
 		i := r.GetInfo()
 		i.Secret = "-"
+		i.SecretHash = ""
+		i.ClientToken = ""
+		i.RoleCounts = CountRoles(i.Connections)
 		infos = append(infos, i)
 	}
 
@@ -111,6 +126,10 @@ func (r *RemoteRpcRoomManager) CreateConnection() *room.Connection {
 		CreatedAt: time.Now(),
 	}
 }
+func (r *RemoteRpcRoomManager) SetRecordingStore(store RecordingStore) {
+	r.localRoomManager.SetRecordingStore(store)
+}
+
 func (r *RemoteRpcRoomManager) CreateLocalRoom(ctx context.Context, info *room.Info) (room.Room, error) {
 	return r.localRoomManager.CreateRoom(ctx, info)
 }
@@ -135,6 +154,8 @@ func (r *RemoteRpcRoomManager) UpdateRoomOption(ctx context.Context, info *room.
 	if err != nil {
 		return nil, err
 	}
+
+	res.Room.Info.ClientToken = ""
 	return res.Room.Info, nil
 }
 
@@ -206,6 +227,75 @@ func (r *RemoteRpcRoomManager) LeaveRoom(ctx context.Context, info *room.Info, c
 	return rpcClient.Call(ctx, "LocalRpcRoomManager.LeaveRoom", req, res)
 }
 
+// GetReplayMessages 从房间所在节点取回连接加入时需要补发的消息
+func (r *RemoteRpcRoomManager) GetReplayMessages(ctx context.Context, info *room.Info, connection *room.Connection) ([]*room.Message, error) {
+	req := NewRpcLocalRoomManagerRequest()
+	req.Info = info
+	req.Connection = connection
+	res := NewRpcLocalRoomManagerResponse()
+	rpcClient, err := r.getRpcByAddress(info.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rpcClient.Call(ctx, "LocalRpcRoomManager.GetReplayMessages", req, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Messages, nil
+}
+
+// GetRoomDetail 从房间所在节点取回房间详情，隐藏房间密码
+func (r *RemoteRpcRoomManager) GetRoomDetail(ctx context.Context, info *room.Info) (*room.Detail, error) {
+	req := NewRpcLocalRoomManagerRequest()
+	req.Info = info
+	res := NewRpcLocalRoomManagerResponse()
+	rpcClient, err := r.getRpcByAddress(info.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rpcClient.Call(ctx, "LocalRpcRoomManager.GetRoomDetail", req, res)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := res.Detail
+	detail.Info.Secret = "-"
+	detail.Info.SecretHash = ""
+	detail.Info.ClientToken = ""
+	detail.Info.RoleCounts = CountRoles(detail.Info.Connections)
+	return detail, nil
+}
+
+func (r *RemoteRpcRoomManager) CloseRoom(ctx context.Context, info *room.Info, reason string) error {
+	req := NewRpcLocalRoomManagerRequest()
+	req.Info = info
+	req.Reason = reason
+	res := NewRpcLocalRoomManagerResponse()
+	rpcClient, err := r.getRpcByAddress(info.Address)
+	if err != nil {
+		return err
+	}
+
+	return rpcClient.Call(ctx, "LocalRpcRoomManager.CloseRoom", req, res)
+}
+
+func (r *RemoteRpcRoomManager) KickConnection(ctx context.Context, info *room.Info, connection *room.Connection, reason string) error {
+	req := NewRpcLocalRoomManagerRequest()
+	req.Info = info
+	req.Connection = connection
+	req.Reason = reason
+	res := NewRpcLocalRoomManagerResponse()
+	rpcClient, err := r.getRpcByAddress(info.Address)
+	if err != nil {
+		return err
+	}
+
+	return rpcClient.Call(ctx, "LocalRpcRoomManager.KickConnection", req, res)
+}
+
 func (r *RemoteRpcRoomManager) ForceJoinRoom(ctx context.Context, connection *room.Connection, opt *room.Info, roomOpt *room.Info) (room.RemoteRoom, error) {
 	rm, err := r.JoinRoom(ctx, connection, opt)
 	if err != nil {
@@ -234,7 +324,7 @@ func (r *RemoteRpcRoomManager) JoinRoom(ctx context.Context, connection *room.Co
 		return nil, err
 	}
 
-	remoteRoom, err := NewRemoteRoom(connection, opt, r.event, room)
+	remoteRoom, err := NewRemoteRoom(connection, opt, r.event, room, r.timeouts, r.queue)
 	if err != nil {
 		return nil, err
 	}
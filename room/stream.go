@@ -0,0 +1,217 @@
+package room
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/event"
+	"github.com/HuolalaTech/page-spy-api/hook"
+	"github.com/HuolalaTech/page-spy-api/metric"
+	localRpc "github.com/HuolalaTech/page-spy-api/rpc"
+)
+
+const (
+	streamLocalID        = "room-stream"
+	streamEventSize      = 1000
+	streamSubscriberSize = 100
+	streamEmitTimeout    = 3 * time.Second
+)
+
+// StreamEventTypes 房间事件流中可以订阅的事件
+var StreamEventTypes = []string{hook.RoomCreated, hook.RoomUpdated, hook.RoomJoined, hook.RoomLeft, hook.RoomClosed}
+
+func IsStreamEventType(eventType string) bool {
+	for _, t := range StreamEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoomEvent 房间事件流中的一条事件
+type RoomEvent struct {
+	Type      string            `json:"type"`
+	Tags      map[string]string `json:"tags"`
+	Data      *RoomHookData     `json:"data"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func streamAddress(machineId string) *event.Address {
+	return &event.Address{
+		ID:        fmt.Sprintf("%s.%s", streamLocalID, machineId),
+		MachineID: machineId,
+		LocalID:   streamLocalID,
+	}
+}
+
+// RoomStream 房间事件只在房间所在节点触发，通过事件总线转发到所有节点，
+// 每个节点在固定地址上监听并推送给本节点的订阅者
+type RoomStream struct {
+	event          event.EventEmitter
+	addressManager *localRpc.AddressManager
+	events         chan *RoomEvent
+	rwLock         sync.RWMutex
+	subscribers    map[*RoomSubscriber]bool
+}
+
+func NewRoomStream(eventEmitter event.EventEmitter, addressManager *localRpc.AddressManager) *RoomStream {
+	return &RoomStream{
+		event:          eventEmitter,
+		addressManager: addressManager,
+		events:         make(chan *RoomEvent, streamEventSize),
+		subscribers:    map[*RoomSubscriber]bool{},
+	}
+}
+
+func (s *RoomStream) Start() {
+	s.event.Listen(streamAddress(s.addressManager.GetSelfMachineID()), s)
+	go s.loop()
+}
+
+// Emit 实现 hook.Hook，队列满时丢弃事件
+func (s *RoomStream) Emit(e *hook.Event) {
+	if !IsStreamEventType(e.Type) {
+		return
+	}
+
+	data, ok := e.Data.(*RoomHookData)
+	if !ok {
+		return
+	}
+
+	select {
+	case s.events <- &RoomEvent{Type: e.Type, Tags: e.Tags, Data: data, CreatedAt: e.CreatedAt}:
+	default:
+		log.Errorf("room stream queue is full, event %s of room %s dropped", e.Type, data.Address.ID)
+	}
+}
+
+func (s *RoomStream) loop() {
+	for e := range s.events {
+		s.broadcast(e)
+	}
+}
+
+func (s *RoomStream) broadcast(e *RoomEvent) {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		log.WithError(err).Errorf("room stream event %s encode failed", e.Type)
+		return
+	}
+
+	self := streamAddress(s.addressManager.GetSelfMachineID())
+	pkg := &event.Package{
+		From:       self,
+		CreatedAt:  e.CreatedAt.UnixNano() / int64(time.Millisecond),
+		RoutingKey: e.Type,
+		Content:    bs,
+	}
+
+	for machineId := range s.addressManager.GetMachineIpInfo() {
+		ctx, cancel := context.WithTimeout(context.Background(), streamEmitTimeout)
+		err := s.event.Emit(ctx, streamAddress(machineId), pkg)
+		cancel()
+		if err != nil {
+			log.WithError(err).Errorf("room stream event %s emit to %s failed", e.Type, machineId)
+		}
+	}
+}
+
+// Listen 收到所在节点转发的事件，推送给本节点的订阅者
+func (s *RoomStream) Listen(ctx context.Context, pkg *event.Package) {
+	e := &RoomEvent{}
+	err := json.Unmarshal(pkg.Content, e)
+	if err != nil {
+		log.WithError(err).Error("room stream event decode failed")
+		return
+	}
+
+	s.rwLock.RLock()
+	defer s.rwLock.RUnlock()
+	for sub := range s.subscribers {
+		if sub.match(e) {
+			sub.push(e)
+		}
+	}
+}
+
+func (s *RoomStream) IsClose() bool {
+	return false
+}
+
+func (s *RoomStream) Close(ctx context.Context, code string) error {
+	return nil
+}
+
+// Subscribe tags 按房间标签模糊匹配，types 为空时订阅所有事件
+func (s *RoomStream) Subscribe(tags map[string]string, types []string) *RoomSubscriber {
+	sub := &RoomSubscriber{
+		tags:   tags,
+		types:  map[string]bool{},
+		events: make(chan *RoomEvent, streamSubscriberSize),
+		done:   make(chan struct{}),
+	}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	s.rwLock.Lock()
+	defer s.rwLock.Unlock()
+	s.subscribers[sub] = true
+	metric.Summary("page_spy_room_stream_subscribers", map[string]string{}, float64(len(s.subscribers)))
+	return sub
+}
+
+func (s *RoomStream) Unsubscribe(sub *RoomSubscriber) {
+	s.rwLock.Lock()
+	defer s.rwLock.Unlock()
+	delete(s.subscribers, sub)
+	sub.close()
+	metric.Summary("page_spy_room_stream_subscribers", map[string]string{}, float64(len(s.subscribers)))
+}
+
+// RoomSubscriber 一个事件流连接，消费太慢时断开，由客户端重连后重新拉取房间列表
+type RoomSubscriber struct {
+	tags      map[string]string
+	types     map[string]bool
+	events    chan *RoomEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *RoomSubscriber) Events() <-chan *RoomEvent {
+	return s.events
+}
+
+func (s *RoomSubscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *RoomSubscriber) match(e *RoomEvent) bool {
+	if len(s.types) > 0 && !s.types[e.Type] {
+		return false
+	}
+
+	return len(s.tags) <= 0 || likeTags(e.Tags, s.tags)
+}
+
+func (s *RoomSubscriber) push(e *RoomEvent) {
+	select {
+	case <-s.done:
+	case s.events <- e:
+	default:
+		metric.Count("page_spy_room_stream_drop", map[string]string{"type": e.Type}, 1)
+		s.close()
+	}
+}
+
+func (s *RoomSubscriber) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,74 @@
+package room
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+)
+
+// TimeoutConfig 房间默认的超时设置，以及创建房间时允许设置的上限
+type TimeoutConfig struct {
+	Default    room.Timeouts
+	Max        room.Timeouts
+	RemoteIdle time.Duration
+}
+
+func resolveTimeout(name string, value int64, defaultValue int64, maxValue int64) (int64, error) {
+	if value == 0 {
+		return defaultValue, nil
+	}
+
+	if value < 0 {
+		return 0, fmt.Errorf("room %s should be greater than 0", name)
+	}
+
+	if value > maxValue {
+		return 0, fmt.Errorf("room %s should not be greater than %d seconds", name, maxValue)
+	}
+
+	return value, nil
+}
+
+// Resolve 未设置的字段使用默认值，超过上限时返回错误
+func (c *TimeoutConfig) Resolve(t *room.Timeouts) (*room.Timeouts, error) {
+	res := c.Default
+	if t == nil {
+		return &res, nil
+	}
+
+	var err error
+	res.EmptyTimeoutOfSecond, err = resolveTimeout("emptyTimeoutOfSecond", t.EmptyTimeoutOfSecond, c.Default.EmptyTimeoutOfSecond, c.Max.EmptyTimeoutOfSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	res.IdleTimeoutOfSecond, err = resolveTimeout("idleTimeoutOfSecond", t.IdleTimeoutOfSecond, c.Default.IdleTimeoutOfSecond, c.Max.IdleTimeoutOfSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	res.LifeTimeOfSecond, err = resolveTimeout("lifeTimeOfSecond", t.LifeTimeOfSecond, c.Default.LifeTimeOfSecond, c.Max.LifeTimeOfSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// formatTimeout 用于关闭原因，例如 1 minute、90 seconds
+func formatTimeout(d time.Duration) string {
+	value, unit := int64(d/time.Second), "second"
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		value, unit = int64(d/time.Hour), "hour"
+	case d >= time.Minute && d%time.Minute == 0:
+		value, unit = int64(d/time.Minute), "minute"
+	}
+
+	if value == 1 {
+		return fmt.Sprintf("%d %s", value, unit)
+	}
+
+	return fmt.Sprintf("%d %ss", value, unit)
+}
@@ -3,6 +3,7 @@ package rpc
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/HuolalaTech/page-spy-api/api/event"
 	"github.com/gorilla/mux"
@@ -14,6 +15,8 @@ type RpcManager struct {
 	addressManager *AddressManager
 	rpcList        map[string]*RpcClient
 	server         *hRpc.Server
+	streams        map[string]http.HandlerFunc
+	streamLock     sync.RWMutex
 }
 
 func NewRpcManager(addressManager *AddressManager) *RpcManager {
@@ -27,6 +30,7 @@ func NewRpcManager(addressManager *AddressManager) *RpcManager {
 		addressManager: addressManager,
 		rpcList:        rpcList,
 		server:         server,
+		streams:        make(map[string]http.HandlerFunc),
 	}
 
 	rpcManager.Run()
@@ -37,6 +41,10 @@ func (r *RpcManager) GetRpcByAddress(address *event.Address) *RpcClient {
 	return r.rpcList[address.MachineID]
 }
 
+func (r *RpcManager) GetRpcByMachineID(machineID string) *RpcClient {
+	return r.rpcList[machineID]
+}
+
 func (r *RpcManager) GetRpcList() []*RpcClient {
 	list := make([]*RpcClient, 0, len(r.rpcList))
 	for _, l := range r.rpcList {
@@ -50,9 +58,30 @@ func (r *RpcManager) Regist(name string, api interface{}) error {
 	return r.server.RegisterService(api, name)
 }
 
+// RegistStream 注册流式接口，用于在节点间传输日志文件等 JSON-RPC 不适合承载的数据
+func (r *RpcManager) RegistStream(name string, handler http.HandlerFunc) {
+	r.streamLock.Lock()
+	defer r.streamLock.Unlock()
+	r.streams[name] = handler
+}
+
+func (r *RpcManager) serveStream(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	r.streamLock.RLock()
+	handler, ok := r.streams[name]
+	r.streamLock.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("stream %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	handler(w, req)
+}
+
 func (r *RpcManager) listen() error {
 	route := mux.NewRouter()
 	route.Handle("/rpc", r.server)
+	route.HandleFunc("/stream/{name}", r.serveStream)
 	err := http.ListenAndServe(":"+r.addressManager.GetSelfAddress().Port, route)
 	if err != nil {
 		return fmt.Errorf("RPC Server start failed, %w", err)
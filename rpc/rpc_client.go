@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"net/rpc"
+	"net/url"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -135,3 +139,25 @@ func (r *RpcClient) Call(ctx context.Context, serviceMethod string, args interfa
 	log.Debugf("rpc call %s method %s", r.address, serviceMethod)
 	return err
 }
+
+// Stream 请求远端节点注册的流式接口，调用方负责关闭返回的数据流
+func (r *RpcClient) Stream(ctx context.Context, name string, query url.Values) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/stream/%s?%s", r.address, name, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Errorf("rpc_stream_error %s stream %s error %s", r.address, name, err)
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("stream %s status %s error %s", name, resp.Status, strings.TrimSpace(string(bs)))
+	}
+
+	return resp.Body, nil
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -51,6 +52,50 @@ func Auth(cfg *config.Config) echo.MiddlewareFunc {
 	}
 }
 
+// GetClaims 获取当前请求的JWT声明，无密码模式下返回 nil
+func GetClaims(c echo.Context) *Claims {
+	claims, ok := c.Get("jwtClaims").(*Claims)
+	if !ok {
+		return nil
+	}
+
+	return claims
+}
+
+// GetOperator 获取当前操作者，登录后为JWT中的 subject 加客户端IP，否则为客户端IP
+func GetOperator(c echo.Context) string {
+	claims := GetClaims(c)
+	if claims != nil && claims.Subject != "" {
+		return fmt.Sprintf("%s@%s", claims.Subject, c.RealIP())
+	}
+
+	return c.RealIP()
+}
+
+// IsAuthorized 检查请求是否带有有效的登录令牌，浏览器的 WebSocket 无法设置请求头，可以通过 token 参数传递
+func IsAuthorized(cfg *config.Config, r *http.Request) bool {
+	if !IsPasswordSet(cfg) {
+		return true
+	}
+
+	if len(jwtSecret) == 0 {
+		InitJWTSecret(cfg)
+	}
+
+	token := r.URL.Query().Get("token")
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		token = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+
+	if token == "" {
+		return false
+	}
+
+	_, err := ParseToken(token)
+	return err == nil
+}
+
 // IsPasswordSet 检查是否已设置密码
 func IsPasswordSet(cfg *config.Config) bool {
 	return cfg.AuthConfig != nil && cfg.AuthConfig.Password != ""
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"net/http"
+
 	"github.com/HuolalaTech/page-spy-api/config"
 	echo "github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -12,10 +14,15 @@ func isEmptyArray(a []string) bool {
 
 func CORS(c *config.Config) echo.MiddlewareFunc {
 	config := middleware.CORSConfig{
+		// 没有 Access-Control-Request-Method 的 OPTIONS 不是预检请求，交给路由处理，例如 tus 的能力查询
+		Skipper: func(ctx echo.Context) bool {
+			req := ctx.Request()
+			return req.Method == http.MethodOptions && req.Header.Get(echo.HeaderAccessControlRequestMethod) == ""
+		},
 		AllowOrigins:     []string{},
 		AllowMethods:     []string{"HEAD", "POST", "GET", "OPTIONS", "PUT", "DELETE", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Length", "X-Request-Id", "Content-Type", "Referer", "User-Agent", "Host"},
-		ExposeHeaders:    []string{"X-Request-Id"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Length", "X-Request-Id", "Content-Type", "Referer", "User-Agent", "Host", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length", "X-Upload-Key"},
+		ExposeHeaders:    []string{"X-Request-Id", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "X-File-Id"},
 		AllowCredentials: true,
 		MaxAge:           12 * 60 * 60,
 		AllowOriginFunc: func(origin string) (bool, error) {
@@ -14,8 +14,15 @@ func Error() echo.MiddlewareFunc {
 			err := next(c)
 			if err != nil {
 				res := common.NewErrorResponse(err)
-				if res.Code == room.ServeError {
+				switch res.Code {
+				case room.ServeError:
 					return c.JSON(http.StatusInternalServerError, res)
+				case room.QuotaExceededError:
+					return c.JSON(http.StatusRequestEntityTooLarge, res)
+				case room.TooManyRequestError:
+					return c.JSON(http.StatusTooManyRequests, res)
+				case room.UnsupportedEncodingError:
+					return c.JSON(http.StatusUnsupportedMediaType, res)
 				}
 
 				return c.JSON(http.StatusBadRequest, res)
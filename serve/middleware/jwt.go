@@ -12,6 +12,8 @@ import (
 // 用于签名JWT的密钥
 var jwtSecret []byte
 
+const tokenIssuer = "page-spy"
+
 // Claims JWT声明结构
 type Claims struct {
 	jwt.RegisteredClaims
@@ -53,8 +55,8 @@ func GetJWTExpirationHours(cfg *config.Config) int {
 	return 24
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(cfg *config.Config) (string, int, error) {
+// GenerateToken 生成JWT令牌，subject 记录操作者名称
+func GenerateToken(cfg *config.Config, subject string) (string, int, error) {
 	// 确保JWT密钥已初始化
 	if len(jwtSecret) == 0 {
 		InitJWTSecret(cfg)
@@ -70,7 +72,8 @@ func GenerateToken(cfg *config.Config) (string, int, error) {
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "page-spy",
+			Issuer:    tokenIssuer,
+			Subject:   subject,
 		},
 	}
 
@@ -100,7 +103,7 @@ func ParseToken(tokenString string) (*Claims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return jwtSecret, nil
-	})
+	}, jwt.WithIssuer(tokenIssuer))
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/metric"
+	echo "github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+const (
+	RateLimitKeyByIP        = "ip"
+	RateLimitKeyByUploadKey = "uploadKey"
+	RateLimitKeyByRoom      = "room"
+
+	// ContextUploadKeyID 上传密钥校验通过后写入的密钥 ID
+	ContextUploadKeyID = "uploadKeyId"
+
+	// 超过该时间没有请求的令牌桶会被清理
+	rateLimitIdleTime  = 10 * time.Minute
+	rateLimitCleanTime = time.Minute
+)
+
+// 各策略默认的令牌桶 key，房间密码校验按房间限流，防止换 IP 猜测密码
+var defaultRateLimitKeyBy = map[string]string{
+	"room":   RateLimitKeyByIP,
+	"check":  RateLimitKeyByRoom,
+	"join":   RateLimitKeyByIP,
+	"upload": RateLimitKeyByUploadKey,
+}
+
+type rateLimitEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type rateLimitStore struct {
+	lock      sync.Mutex
+	limit     rate.Limit
+	burst     int
+	entries   map[string]*rateLimitEntry
+	lastClean time.Time
+}
+
+// reserve 消耗一个令牌，令牌不足时返回需要等待的时间
+func (s *rateLimitStore) reserve(key string) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastClean) > rateLimitCleanTime {
+		for k, e := range s.entries {
+			if now.Sub(e.lastSeen) > rateLimitIdleTime {
+				delete(s.entries, k)
+			}
+		}
+
+		s.lastClean = now
+	}
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{limiter: rate.NewLimiter(s.limit, s.burst)}
+		s.entries[key] = entry
+	}
+
+	entry.lastSeen = now
+	reservation := entry.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+
+	return delay
+}
+
+func rateLimitIP(c echo.Context, trustProxy bool) string {
+	if trustProxy {
+		return c.RealIP()
+	}
+
+	return echo.ExtractIPDirect()(c.Request())
+}
+
+func rateLimitKey(c echo.Context, keyBy string, trustProxy bool) string {
+	switch keyBy {
+	case RateLimitKeyByUploadKey:
+		// 只使用校验过的密钥，随机密钥不会产生新的令牌桶
+		keyId, _ := c.Get(ContextUploadKeyID).(string)
+		if keyId != "" {
+			return "uploadKey:" + keyId
+		}
+	case RateLimitKeyByRoom:
+		address := c.QueryParam("address")
+		if address != "" {
+			return "room:" + address
+		}
+	}
+
+	// 没有有效的上传密钥或房间地址时按 IP 限流
+	return "ip:" + rateLimitIP(c, trustProxy)
+}
+
+// RateLimit 按策略名创建限流中间件，nodes 为集群节点数，开启 clusterAware 时每个节点只分到 1/nodes 的额度
+func RateLimit(cfg *config.Config, policy string, nodes int) (echo.MiddlewareFunc, error) {
+	limit := cfg.RateLimitConfig.GetPolicy(policy)
+	if limit == nil || limit.RequestsPerMinute <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}, nil
+	}
+
+	keyBy := limit.KeyBy
+	if keyBy == "" {
+		keyBy = defaultRateLimitKeyBy[policy]
+	}
+
+	if keyBy != RateLimitKeyByIP && keyBy != RateLimitKeyByUploadKey && keyBy != RateLimitKeyByRoom {
+		return nil, fmt.Errorf("rate limit %s keyBy %s is not supported, use ip, uploadKey or room", policy, keyBy)
+	}
+
+	perMinute := limit.RequestsPerMinute
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(perMinute))
+	}
+
+	if cfg.RateLimitConfig.ClusterAware && nodes > 1 {
+		perMinute = perMinute / float64(nodes)
+		burst = max(1, burst/nodes)
+	}
+
+	store := &rateLimitStore{
+		limit:   rate.Limit(perMinute / 60),
+		burst:   burst,
+		entries: map[string]*rateLimitEntry{},
+	}
+	trustProxy := cfg.RateLimitConfig.TrustProxy
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			delay := store.reserve(rateLimitKey(c, keyBy, trustProxy))
+			if delay <= 0 {
+				return next(c)
+			}
+
+			metric.Count("rate_limit", map[string]string{
+				"policy": policy,
+			}, 1)
+
+			retryAfter := int64(math.Ceil(delay.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			return room.NewTooManyRequestError("too many requests, retry after %d seconds", retryAfter)
+		}
+	}, nil
+}
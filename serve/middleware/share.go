@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 分享令牌使用独立的签发者，避免被当作登录令牌使用
+const shareTokenIssuer = "page-spy-share"
+
+// ShareClaims 分享令牌声明，ID 为分享记录的 shareId
+type ShareClaims struct {
+	jwt.RegisteredClaims
+	FileId  string `json:"fileId,omitempty"`
+	GroupId string `json:"groupId,omitempty"`
+}
+
+// GenerateShareToken 生成只读分享令牌，相同参数生成的令牌相同
+func GenerateShareToken(cfg *config.Config, shareId string, fileId string, groupId string, issuedAt time.Time, expiresAt time.Time) (string, error) {
+	if len(jwtSecret) == 0 {
+		InitJWTSecret(cfg)
+	}
+
+	claims := &ShareClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        shareId,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			Issuer:    shareTokenIssuer,
+		},
+		FileId:  fileId,
+		GroupId: groupId,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+// ParseShareToken 校验分享令牌的签名和有效期，是否已撤销需要调用方另行检查
+func ParseShareToken(cfg *config.Config, tokenString string) (*ShareClaims, error) {
+	if len(jwtSecret) == 0 {
+		InitJWTSecret(cfg)
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &ShareClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	}, jwt.WithIssuer(shareTokenIssuer), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*ShareClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid share token")
+}
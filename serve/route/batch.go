@@ -0,0 +1,227 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type FileError struct {
+	FileId string `json:"fileId"`
+	Error  string `json:"error"`
+}
+
+type BatchFileRequest struct {
+	FileIds  []string
+	Operator string
+}
+
+type BatchFileResponse struct {
+	Errors []*FileError
+}
+
+// batchFiles 按 machineId 将 fileId 分组，本机文件直接处理，其它节点的文件通过 RPC 批量处理
+func (c *CoreApi) batchFiles(method string, req *BatchFileRequest, local func(fileId string) error) []*FileError {
+	errs := []*FileError{}
+	machineFileIds := map[string][]string{}
+	for _, fileId := range req.FileIds {
+		machine, err := c.GetMachineIdByFileName(fileId)
+		if err != nil {
+			errs = append(errs, &FileError{FileId: fileId, Error: err.Error()})
+			continue
+		}
+
+		machineFileIds[machine] = append(machineFileIds[machine], fileId)
+	}
+
+	for machine, fileIds := range machineFileIds {
+		if c.IsSelfMachine(machine) {
+			for _, fileId := range fileIds {
+				err := local(fileId)
+				if err != nil {
+					errs = append(errs, &FileError{FileId: fileId, Error: err.Error()})
+				}
+			}
+
+			continue
+		}
+
+		client := c.rpcManager.GetRpcByMachineID(machine)
+		if client == nil {
+			for _, fileId := range fileIds {
+				errs = append(errs, &FileError{FileId: fileId, Error: fmt.Sprintf("rpc client %s not found", machine)})
+			}
+
+			continue
+		}
+
+		res := &BatchFileResponse{}
+		err := client.Call(context.Background(), method, &BatchFileRequest{FileIds: fileIds, Operator: req.Operator}, res)
+		if err != nil {
+			for _, fileId := range fileIds {
+				errs = append(errs, &FileError{FileId: fileId, Error: err.Error()})
+			}
+
+			continue
+		}
+
+		errs = append(errs, res.Errors...)
+	}
+
+	return errs
+}
+
+func batchError(errs []*FileError) error {
+	if len(errs) <= 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d files failed, %s: %s", len(errs), errs[0].FileId, errs[0].Error)
+}
+
+func (c *CoreApi) TrashFiles(fileIds []string, operator string) []*FileError {
+	return c.batchFiles("CoreApi.TrashFiles", &BatchFileRequest{FileIds: fileIds, Operator: operator}, func(fileId string) error {
+		return c.TrashFile(fileId, operator)
+	})
+}
+
+func (c *CoreApi) RestoreFiles(fileIds []string) []*FileError {
+	return c.batchFiles("CoreApi.RestoreFiles", &BatchFileRequest{FileIds: fileIds}, c.RestoreFile)
+}
+
+func (c *CoreApi) PurgeFiles(fileIds []string) []*FileError {
+	return c.batchFiles("CoreApi.PurgeFiles", &BatchFileRequest{FileIds: fileIds}, c.PurgeFile)
+}
+
+func (r *RcpCoreApi) TrashFiles(_ *http.Request, req *BatchFileRequest, res *BatchFileResponse) error {
+	res.Errors = r.core.TrashFiles(req.FileIds, req.Operator)
+	return nil
+}
+
+func (r *RcpCoreApi) RestoreFiles(_ *http.Request, req *BatchFileRequest, res *BatchFileResponse) error {
+	res.Errors = r.core.RestoreFiles(req.FileIds)
+	return nil
+}
+
+func (r *RcpCoreApi) PurgeFiles(_ *http.Request, req *BatchFileRequest, res *BatchFileResponse) error {
+	res.Errors = r.core.PurgeFiles(req.FileIds)
+	return nil
+}
+
+type LogGroupError struct {
+	GroupId string `json:"groupId"`
+	Error   string `json:"error"`
+}
+
+type BatchLogGroupRequest struct {
+	GroupIds []string
+	Operator string
+	// Meta 更新日志组名称和标签时使用
+	Meta *MetaRequest
+}
+
+type BatchLogGroupResponse struct {
+	Found  []string
+	Errors []*LogGroupError
+}
+
+// localLogGroups 处理本机的日志组，local 返回 false 表示本机没有该日志组
+func localLogGroups(groupIds []string, local func(groupId string) (bool, error)) *BatchLogGroupResponse {
+	res := &BatchLogGroupResponse{Found: []string{}, Errors: []*LogGroupError{}}
+	for _, groupId := range groupIds {
+		found, err := local(groupId)
+		if found {
+			res.Found = append(res.Found, groupId)
+		}
+
+		if err != nil {
+			res.Errors = append(res.Errors, &LogGroupError{GroupId: groupId, Error: err.Error()})
+		}
+	}
+
+	return res
+}
+
+// batchLogGroups 同一个日志组的文件可能上传到不同节点，每个节点处理本机的部分，所有节点都没有时返回 notFound，为空时忽略
+func (c *CoreApi) batchLogGroups(method string, req *BatchLogGroupRequest, local func(groupId string) (bool, error), notFound string) []*LogGroupError {
+	errs := []*LogGroupError{}
+	found := map[string]bool{}
+	for machine := range c.addressManager.GetMachineIpInfo() {
+		var res *BatchLogGroupResponse
+		if c.IsSelfMachine(machine) {
+			res = localLogGroups(req.GroupIds, local)
+		} else {
+			client := c.rpcManager.GetRpcByMachineID(machine)
+			if client == nil {
+				for _, groupId := range req.GroupIds {
+					errs = append(errs, &LogGroupError{GroupId: groupId, Error: fmt.Sprintf("rpc client %s not found", machine)})
+				}
+
+				continue
+			}
+
+			res = &BatchLogGroupResponse{}
+			err := client.Call(context.Background(), method, req, res)
+			if err != nil {
+				for _, groupId := range req.GroupIds {
+					errs = append(errs, &LogGroupError{GroupId: groupId, Error: fmt.Sprintf("machine %s: %s", machine, err.Error())})
+				}
+
+				continue
+			}
+		}
+
+		for _, groupId := range res.Found {
+			found[groupId] = true
+		}
+
+		errs = append(errs, res.Errors...)
+	}
+
+	for _, groupId := range req.GroupIds {
+		if notFound != "" && !found[groupId] {
+			errs = append(errs, &LogGroupError{GroupId: groupId, Error: fmt.Sprintf(notFound, groupId)})
+		}
+	}
+
+	return errs
+}
+
+func batchLogGroupError(errs []*LogGroupError) error {
+	if len(errs) <= 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d log groups failed, %s: %s", len(errs), errs[0].GroupId, errs[0].Error)
+}
+
+func (c *CoreApi) TrashLogGroups(groupIds []string, operator string) []*LogGroupError {
+	return c.batchLogGroups("CoreApi.TrashLogGroups", &BatchLogGroupRequest{GroupIds: groupIds, Operator: operator}, func(groupId string) (bool, error) {
+		return c.TrashLogGroup(groupId, operator)
+	}, "")
+}
+
+func (c *CoreApi) RestoreLogGroups(groupIds []string) []*LogGroupError {
+	return c.batchLogGroups("CoreApi.RestoreLogGroups", &BatchLogGroupRequest{GroupIds: groupIds}, c.RestoreLogGroup, "log group %s not found in trash")
+}
+
+func (c *CoreApi) PurgeLogGroups(groupIds []string) []*LogGroupError {
+	return c.batchLogGroups("CoreApi.PurgeLogGroups", &BatchLogGroupRequest{GroupIds: groupIds}, c.PurgeLogGroup, "log group %s not found in trash")
+}
+
+func (r *RcpCoreApi) TrashLogGroups(_ *http.Request, req *BatchLogGroupRequest, res *BatchLogGroupResponse) error {
+	*res = *localLogGroups(req.GroupIds, func(groupId string) (bool, error) {
+		return r.core.TrashLogGroup(groupId, req.Operator)
+	})
+	return nil
+}
+
+func (r *RcpCoreApi) RestoreLogGroups(_ *http.Request, req *BatchLogGroupRequest, res *BatchLogGroupResponse) error {
+	*res = *localLogGroups(req.GroupIds, r.core.RestoreLogGroup)
+	return nil
+}
+
+func (r *RcpCoreApi) PurgeLogGroups(_ *http.Request, req *BatchLogGroupRequest, res *BatchLogGroupResponse) error {
+	*res = *localLogGroups(req.GroupIds, r.core.PurgeLogGroup)
+	return nil
+}
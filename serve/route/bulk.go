@@ -0,0 +1,177 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+)
+
+const (
+	// maxBulkFiles 单次批量操作最多处理的日志数量
+	maxBulkFiles  = 10000
+	bulkBatchSize = 100
+	jobLifeTime   = 24 * time.Hour
+	exportDirPath = "./data/export"
+)
+
+func (c *CoreApi) PreviewBulk(query *data.FileListQuery) (*data.LogSummary, error) {
+	res := &data.LogSummary{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.SummaryLogs", query, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *CoreApi) findBulkLogs(query *data.FileListQuery) ([]*data.LogData, error) {
+	summary, err := c.PreviewBulk(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if summary.Total > maxBulkFiles {
+		return nil, fmt.Errorf("query matched %d files, more than %d, please narrow the query", summary.Total, maxBulkFiles)
+	}
+
+	res := &data.LogList{}
+	err = rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindAllLogs", query, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Logs, nil
+}
+
+func (c *CoreApi) GetJob(jobId string) (*Job, error) {
+	job := c.jobManager.Get(jobId)
+	if job == nil {
+		return nil, fmt.Errorf("job %s not found", jobId)
+	}
+
+	return job, nil
+}
+
+func (c *CoreApi) StartBulkDelete(query *data.FileListQuery, operator string) (*JobInfo, error) {
+	logs, err := c.findBulkLogs(query)
+	if err != nil {
+		return nil, err
+	}
+
+	job := NewJob(c.CreateRecordId(), DeleteJob, operator, len(logs))
+	c.jobManager.Add(job)
+	go c.runBulkDelete(job, logs, operator)
+	return job.Info(), nil
+}
+
+func (c *CoreApi) runBulkDelete(job *Job, logs []*data.LogData, operator string) {
+	for start := 0; start < len(logs); start += bulkBatchSize {
+		end := min(start+bulkBatchSize, len(logs))
+		fileIds := make([]string, 0, end-start)
+		for _, l := range logs[start:end] {
+			fileIds = append(fileIds, l.FileId)
+		}
+
+		job.progress(len(fileIds), c.TrashFiles(fileIds, operator))
+	}
+
+	job.finish(nil)
+	info := job.Info()
+	log.Infof("bulk delete job %s by %s finished, total %d failed %d", info.JobId, info.CreatedBy, info.Total, info.Failed)
+}
+
+func (c *CoreApi) StartBulkExport(query *data.FileListQuery, operator string) (*JobInfo, error) {
+	logs, err := c.findBulkLogs(query)
+	if err != nil {
+		return nil, err
+	}
+
+	job := NewJob(c.CreateRecordId(), ExportJob, operator, len(logs))
+	job.filePath = filepath.Join(exportDirPath, job.info.JobId+".zip")
+	c.jobManager.Add(job)
+	go func() {
+		err := c.runBulkExport(job, logs)
+		if err != nil {
+			log.Errorf("bulk export job %s error %s", job.info.JobId, err.Error())
+			os.Remove(job.filePath)
+		}
+
+		job.finish(err)
+	}()
+
+	return job.Info(), nil
+}
+
+func (c *CoreApi) runBulkExport(job *Job, logs []*data.LogData) error {
+	err := os.MkdirAll(exportDirPath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(job.filePath)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	manifest := &ExportManifest{
+		ExportedAt: time.Now(),
+	}
+	err = c.writeLogsZip(context.Background(), file, manifest, logs, func(l *data.LogData, err error) {
+		if err != nil {
+			job.progress(1, []*FileError{{FileId: l.FileId, Error: err.Error()}})
+			return
+		}
+
+		job.progress(1, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func (c *CoreApi) CleanJob() error {
+	for _, job := range c.jobManager.RemoveFinished(time.Now().Add(-jobLifeTime)) {
+		if job.FilePath() == "" {
+			continue
+		}
+
+		err := os.Remove(job.FilePath())
+		if err != nil && !os.IsNotExist(err) {
+			log.Errorf("remove job %s file error %s", job.Info().JobId, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (r *RcpCoreApi) SummaryLogs(_ *http.Request, req *data.FileListQuery, res *data.LogSummary) error {
+	req.MachineId = r.core.addressManager.GetSelfMachineID()
+	summary, err := r.core.data.SummaryLogs(req)
+	if err != nil {
+		return err
+	}
+
+	res.Total = summary.Total
+	res.Size = summary.Size
+	return nil
+}
+
+func (r *RcpCoreApi) FindAllLogs(_ *http.Request, req *data.FileListQuery, res *data.LogList) error {
+	req.MachineId = r.core.addressManager.GetSelfMachineID()
+	logs, err := r.core.data.FindAllLogs(req, maxBulkFiles)
+	if err != nil {
+		return err
+	}
+
+	res.Logs = logs
+	return nil
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/HuolalaTech/page-spy-api/config"
 	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/hook"
 	"github.com/HuolalaTech/page-spy-api/logger"
+	"github.com/HuolalaTech/page-spy-api/room"
 	"github.com/HuolalaTech/page-spy-api/rpc"
 	"github.com/HuolalaTech/page-spy-api/storage"
 	"github.com/HuolalaTech/page-spy-api/task"
@@ -20,12 +22,18 @@ import (
 var log = logger.Log().WithField("module", "core")
 
 type CoreApi struct {
-	rpcManager     *rpc.RpcManager
-	storage        storage.StorageApi
-	data           data.DataApi
-	maxSizeOfByte  int64 // unit byte
-	maxLifeOfHour  int64 // unit Hour
-	addressManager *rpc.AddressManager
+	config          *config.Config
+	rpcManager      *rpc.RpcManager
+	storage         storage.StorageApi
+	data            data.DataApi
+	retentionRules  []*retentionRule
+	trashLifeOfHour int64 // unit Hour
+	addressManager  *rpc.AddressManager
+	jobManager      *JobManager
+	statsCache      *statsCache
+	tusManager      *TusManager
+	uploadKeyCache  *uploadKeyCache
+	webhookManager  *WebhookManager
 }
 
 type RcpCoreApi struct {
@@ -36,6 +44,11 @@ func (c *CoreApi) CreateFileId(md5 string) string {
 	return fmt.Sprintf("%s.%s", c.addressManager.GetSelfMachineID(), md5)
 }
 
+// CreateRecordId 生成带本机 machineId 前缀的记录 ID，格式与 fileId 相同
+func (c *CoreApi) CreateRecordId() string {
+	return fmt.Sprintf("%s.%s", c.addressManager.GetSelfMachineID(), c.addressManager.GeneratorLocalID())
+}
+
 func (c *CoreApi) IsSelfMachine(machineId string) bool {
 	return c.addressManager.GetSelfMachineID() == machineId
 }
@@ -48,6 +61,66 @@ func (c *CoreApi) GetMachineIdByFileName(name string) (string, error) {
 	return names[0], nil
 }
 
+// GetLogGroupMachineId 查找日志组所在的节点，本机存在时优先返回本机
+func (c *CoreApi) GetLogGroupMachineId(groupId string) (string, error) {
+	logGroup, err := c.data.FindLogGroup(groupId)
+	if err != nil {
+		return "", err
+	}
+
+	if logGroup != nil {
+		return c.addressManager.GetSelfMachineID(), nil
+	}
+
+	for machineId := range c.addressManager.GetMachineIpInfo() {
+		if c.IsSelfMachine(machineId) {
+			continue
+		}
+
+		client := c.rpcManager.GetRpcByMachineID(machineId)
+		if client == nil {
+			continue
+		}
+
+		res := &LogGroupExistResponse{}
+		err := client.Call(context.Background(), "CoreApi.ExistLogGroup", &LogGroupRequest{GroupId: groupId}, res)
+		if err != nil {
+			log.Errorf("find log group %s from machine %s error %s", groupId, machineId, err.Error())
+			continue
+		}
+
+		if res.Exist {
+			return machineId, nil
+		}
+	}
+
+	return "", fmt.Errorf("log group %s not found", groupId)
+}
+
+type LogHookData struct {
+	FileId        string `json:"fileId"`
+	GroupId       string `json:"groupId,omitempty"`
+	Name          string `json:"name"`
+	Size          int64  `json:"size"`
+	FormatVersion int    `json:"formatVersion"`
+}
+
+// emitLogUploaded 日志保存成功后触发，标签同名时取最后一个
+func emitLogUploaded(file *storage.LogFile, groupId string) {
+	tags := map[string]string{}
+	for _, t := range file.Tags {
+		tags[t.Key] = t.Value
+	}
+
+	hook.Emit(hook.LogUploaded, tags, &LogHookData{
+		FileId:        file.FileId,
+		GroupId:       groupId,
+		Name:          file.Name,
+		Size:          file.Size,
+		FormatVersion: file.FormatVersion,
+	})
+}
+
 type EmptyReaderClose struct {
 	reader io.Reader
 }
@@ -80,17 +153,19 @@ func (c *CoreApi) CreateFile(file *storage.LogFile) (*storage.LogFile, error) {
 			UpdatedAt: time.Now(),
 			CreatedAt: time.Now(),
 		},
-		Tags:   ts,
-		FileId: file.FileId,
-		Status: data.Saved,
-		Size:   file.Size,
-		Name:   file.Name,
+		Tags:          ts,
+		FileId:        file.FileId,
+		Status:        data.Saved,
+		Size:          file.Size,
+		Name:          file.Name,
+		FormatVersion: file.FormatVersion,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	emitLogUploaded(file, "")
 	return file, err
 }
 
@@ -115,11 +190,12 @@ func (c *CoreApi) CreateLogGroupFile(file *storage.LogGroupFile) (*storage.LogGr
 			UpdatedAt: time.Now(),
 			CreatedAt: time.Now(),
 		},
-		Tags:   ts,
-		FileId: file.FileId,
-		Status: data.Saved,
-		Size:   file.Size,
-		Name:   file.Name,
+		Tags:          ts,
+		FileId:        file.FileId,
+		Status:        data.Saved,
+		Size:          file.Size,
+		Name:          file.Name,
+		FormatVersion: file.FormatVersion,
 	}
 
 	logGroup, err := c.data.FindLogGroup(file.GroupId)
@@ -140,7 +216,12 @@ func (c *CoreApi) CreateLogGroupFile(file *storage.LogGroupFile) (*storage.LogGr
 			Name:    file.Name,
 		}
 		err = c.data.CreateLogGroup(logGroup)
-		return file, err
+		if err != nil {
+			return file, err
+		}
+
+		emitLogUploaded(&file.LogFile, file.GroupId)
+		return file, nil
 	}
 
 	logGroup.Size = logGroup.Size + file.Size
@@ -152,6 +233,12 @@ func (c *CoreApi) CreateLogGroupFile(file *storage.LogGroupFile) (*storage.LogGr
 		return nil, err
 	}
 
+	err = c.data.RefreshLogGroupTags(logGroup.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	emitLogUploaded(&file.LogFile, file.GroupId)
 	return file, err
 }
 
@@ -172,6 +259,11 @@ func (c *CoreApi) DeleteLogGroup(groupId string) error {
 		}
 	}
 
+	err = c.data.DeleteNotesByGroupId(groupId)
+	if err != nil {
+		return err
+	}
+
 	return c.data.DeleteLogGroupByGroupId(groupId)
 }
 
@@ -191,6 +283,11 @@ func (c *CoreApi) GetLogGroupList(query *data.FileListQuery) (*data.Page[*data.L
 		return nil, err
 	}
 
+	err = c.fillLogGroupsNoteCount(res.Data)
+	if err != nil {
+		return nil, err
+	}
+
 	res.Desc()
 	return res, nil
 }
@@ -201,6 +298,10 @@ func (c *CoreApi) ListFilesInGroup(groupId string) ([]*data.LogData, error) {
 		return nil, err
 	}
 
+	if logGroup == nil {
+		return nil, fmt.Errorf("log group %s not found", groupId)
+	}
+
 	return logGroup.Logs, nil
 }
 
@@ -241,101 +342,82 @@ func (c *CoreApi) DeleteFile(fileId string) error {
 		return err
 	}
 
-	return c.data.DeleteLogByFileId(fileId)
-}
-
-func (c *CoreApi) CleanFileByTime() error {
-	before := time.Now().Add(-time.Duration(c.maxLifeOfHour) * time.Hour)
-	logs, err := c.data.FindTimeoutLogs(before, 1000)
+	err = c.data.DeleteNotesByFileId(fileId)
 	if err != nil {
 		return err
 	}
 
-	if logs == nil || len(logs) <= 0 {
-		return nil
-	}
-
-	log.Infof("clean file by time %d file timeout before %s", len(logs), before.String())
-	for _, l := range logs {
-		err := c.DeleteFile(l.FileId)
-		if err != nil {
-			log.Errorf("delete file %s error %s", l.FileId, err.Error())
-		}
-		log.Infof("clean file %s name %s by time createdAt %s", l.FileId, l.Name, l.CreatedAt.String())
-	}
-
-	return nil
+	return c.data.DeleteLogByFileId(fileId)
 }
 
-func (c *CoreApi) CleanFileBySize() error {
-	size, err := c.data.CountLogsSize()
+func NewCore(config *config.Config, storage storage.StorageApi, taskManager *task.TaskManager, data data.DataApi, addressManager *rpc.AddressManager, rpcManager *rpc.RpcManager, roomManager *room.RemoteRpcRoomManager) (*CoreApi, error) {
+	retentionRules, err := newRetentionRules(config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if size < c.maxSizeOfByte {
-		return nil
+	webhookManager, err := NewWebhookManager(config, data, addressManager)
+	if err != nil {
+		return nil, err
 	}
 
-	deleteSize := size - c.maxSizeOfByte
-
-	log.Infof("clean file by size %dmb > max size %dmb", size/(1024*1024), c.maxSizeOfByte/(1024*1024))
-	logs, err := c.data.FindOldestLogs(1000)
+	notifyManager, err := NewNotifyManager(config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, l := range logs {
-		if deleteSize <= 0 {
-			return nil
-		}
-
-		err := c.DeleteFile(l.FileId)
-		if err != nil {
-			log.Errorf("delete file %s error %s", l.FileId, err.Error())
-		} else {
-			deleteSize = deleteSize - l.Size
-			log.Infof("clean file %s name %s by size", l.FileId, l.Name)
-		}
-
+	coreApi := &CoreApi{
+		config:          config,
+		storage:         storage,
+		rpcManager:      rpcManager,
+		data:            data,
+		addressManager:  addressManager,
+		retentionRules:  retentionRules,
+		trashLifeOfHour: config.GetTrashLifeTimeOfHour(),
+		jobManager:      NewJobManager(),
+		statsCache:      newStatsCache(),
+		tusManager:      NewTusManager(),
+		uploadKeyCache:  newUploadKeyCache(),
+		webhookManager:  webhookManager,
+	}
+	err = taskManager.AddTask(task.NewTask("clean_file", 10*time.Minute, coreApi.CleanFile))
+	if err != nil {
+		log.Errorf("add clean file task error %s", err.Error())
 	}
 
-	return nil
-}
-
-func (c *CoreApi) CleanFile() error {
-	err := c.CleanFileBySize()
+	err = taskManager.AddTask(task.NewTask("clean_trash", 10*time.Minute, coreApi.CleanTrash))
 	if err != nil {
-		log.Errorf("clean file by size error %s", err.Error())
+		log.Errorf("add clean trash task error %s", err.Error())
 	}
-	err = c.CleanFileByTime()
+
+	err = taskManager.AddTask(task.NewTask("clean_job", 10*time.Minute, coreApi.CleanJob))
 	if err != nil {
-		log.Errorf("clean file by time error %s", err.Error())
+		log.Errorf("add clean job task error %s", err.Error())
 	}
 
-	return nil
-}
+	err = taskManager.AddTask(task.NewTask("clean_tus", 10*time.Minute, coreApi.CleanTusUpload))
+	if err != nil {
+		log.Errorf("add clean tus task error %s", err.Error())
+	}
 
-func NewCore(config *config.Config, storage storage.StorageApi, taskManager *task.TaskManager, data data.DataApi, addressManager *rpc.AddressManager, rpcManager *rpc.RpcManager) (*CoreApi, error) {
-	maxLogFileSizeOfMb := config.GetMaxLogFileSizeOfMB()
+	err = taskManager.AddTask(task.NewTask("clean_webhook", 10*time.Minute, coreApi.CleanWebhookDelivery))
+	if err != nil {
+		log.Errorf("add clean webhook task error %s", err.Error())
+	}
 
-	maxLifeOfHour := config.GetMaxLogLifeTimeOfHour()
+	if webhookManager.Enabled() {
+		hook.AddHook(webhookManager)
+		webhookManager.Start()
+	}
 
-	coreApi := &CoreApi{
-		storage:        storage,
-		rpcManager:     rpcManager,
-		data:           data,
-		addressManager: addressManager,
-		maxSizeOfByte:  maxLogFileSizeOfMb * 1024 * 1024,
-		maxLifeOfHour:  maxLifeOfHour,
-	}
-	if !config.IsRemoteStorage() {
-		err := taskManager.AddTask(task.NewTask("clean_file", 10*time.Minute, coreApi.CleanFile))
-		if err != nil {
-			log.Errorf("add clean file task error %s", err.Error())
-		}
+	if notifyManager.Enabled() {
+		hook.AddHook(notifyManager)
+		notifyManager.Start()
 	}
 
+	roomManager.SetRecordingStore(coreApi)
+	rpcManager.RegistStream("log", coreApi.streamLog)
+
 	return coreApi, rpcManager.Regist("CoreApi", NewRpcCore(coreApi))
 }
 
@@ -364,3 +446,21 @@ func (r *RcpCoreApi) FindLogGroups(_ *http.Request, req *data.FileListQuery, res
 	res.Total = page.Total
 	return nil
 }
+
+type LogGroupRequest struct {
+	GroupId string
+}
+
+type LogGroupExistResponse struct {
+	Exist bool
+}
+
+func (r *RcpCoreApi) ExistLogGroup(_ *http.Request, req *LogGroupRequest, res *LogGroupExistResponse) error {
+	logGroup, err := r.core.data.FindLogGroup(req.GroupId)
+	if err != nil {
+		return err
+	}
+
+	res.Exist = logGroup != nil
+	return nil
+}
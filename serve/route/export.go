@@ -0,0 +1,335 @@
+package route
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+// OpenFile 读取日志内容，文件不在本机时通过所属节点的流式接口读取
+func (c *CoreApi) OpenFile(ctx context.Context, fileId string) (io.ReadCloser, error) {
+	machine, err := c.GetMachineIdByFileName(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.IsSelfMachine(machine) {
+		file, err := c.GetFile(fileId)
+		if err != nil {
+			return nil, err
+		}
+
+		return file.FileSteam, nil
+	}
+
+	client := c.rpcManager.GetRpcByMachineID(machine)
+	if client == nil {
+		return nil, fmt.Errorf("rpc client %s not found", machine)
+	}
+
+	return client.Stream(ctx, "log", url.Values{"fileId": []string{fileId}})
+}
+
+func (c *CoreApi) streamLog(w http.ResponseWriter, r *http.Request) {
+	file, err := c.GetFile(r.URL.Query().Get("fileId"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	defer file.FileSteam.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	_, err = io.Copy(w, file.FileSteam)
+	if err != nil {
+		log.Errorf("stream file %s error %s", file.FileId, err.Error())
+	}
+}
+
+// zipEntryName 以 fileId 作为目录，避免同名日志互相覆盖
+func zipEntryName(l *data.LogData) string {
+	name := path.Base(strings.ReplaceAll(l.Name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		name = "log"
+	}
+
+	return l.FileId + "/" + name
+}
+
+func (c *CoreApi) writeZipEntry(ctx context.Context, zw *zip.Writer, l *data.LogData) error {
+	reader, err := c.OpenFile(ctx, l.FileId)
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     zipEntryName(l),
+		Method:   zip.Deflate,
+		Modified: l.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, reader)
+	return err
+}
+
+type ManifestFile struct {
+	FileId    string         `json:"fileId"`
+	Name      string         `json:"name"`
+	Path      string         `json:"path,omitempty"`
+	Size      int64          `json:"size"`
+	Tags      []*storage.Tag `json:"tags"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// ExportManifest 导出 ZIP 中的 manifest.json，记录每个日志的元数据和导出结果
+type ExportManifest struct {
+	ExportedAt time.Time       `json:"exportedAt"`
+	GroupId    string          `json:"groupId,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	Tags       []*storage.Tag  `json:"tags,omitempty"`
+	Files      []*ManifestFile `json:"files"`
+}
+
+func toStorageTags(tags []*data.Tag) []*storage.Tag {
+	result := make([]*storage.Tag, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, &storage.Tag{
+			Key:   t.Key,
+			Value: t.Value,
+		})
+	}
+
+	return result
+}
+
+// writeLogsZip 边读取边写入 zip，单个文件失败不会中断导出，失败原因记录在 manifest.json 中
+func (c *CoreApi) writeLogsZip(ctx context.Context, w io.Writer, manifest *ExportManifest, logs []*data.LogData, onFile func(l *data.LogData, err error)) error {
+	zw := zip.NewWriter(w)
+	for _, l := range logs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file := &ManifestFile{
+			FileId:    l.FileId,
+			Name:      l.Name,
+			Size:      l.Size,
+			Tags:      toStorageTags(l.Tags),
+			CreatedAt: l.CreatedAt,
+		}
+
+		err := c.writeZipEntry(ctx, zw, l)
+		if err != nil {
+			file.Error = err.Error()
+		} else {
+			file.Path = zipEntryName(l)
+		}
+
+		manifest.Files = append(manifest.Files, file)
+		onFile(l, err)
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "manifest.json",
+		Method:   zip.Deflate,
+		Modified: manifest.ExportedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+type FileIdsRequest struct {
+	FileIds []string
+}
+
+// FindLogsByFileIds 按 fileId 所属节点查询日志元数据，返回顺序与 fileIds 一致
+func (c *CoreApi) FindLogsByFileIds(fileIds []string) ([]*data.LogData, error) {
+	machineFileIds := map[string][]string{}
+	for _, fileId := range fileIds {
+		machine, err := c.GetMachineIdByFileName(fileId)
+		if err != nil {
+			return nil, err
+		}
+
+		machineFileIds[machine] = append(machineFileIds[machine], fileId)
+	}
+
+	logMap := map[string]*data.LogData{}
+	for machine, ids := range machineFileIds {
+		var logs []*data.LogData
+		if c.IsSelfMachine(machine) {
+			var err error
+			logs, err = c.findLocalLogs(ids)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			client := c.rpcManager.GetRpcByMachineID(machine)
+			if client == nil {
+				return nil, fmt.Errorf("rpc client %s not found", machine)
+			}
+
+			res := &data.LogList{}
+			err := client.Call(context.Background(), "CoreApi.FindLogsByFileIds", &FileIdsRequest{FileIds: ids}, res)
+			if err != nil {
+				return nil, err
+			}
+
+			logs = res.Logs
+		}
+
+		for _, l := range logs {
+			logMap[l.FileId] = l
+		}
+	}
+
+	result := []*data.LogData{}
+	for _, fileId := range fileIds {
+		l, ok := logMap[fileId]
+		if !ok {
+			continue
+		}
+
+		result = append(result, l)
+		delete(logMap, fileId)
+	}
+
+	return result, nil
+}
+
+func (c *CoreApi) findLocalLogs(fileIds []string) ([]*data.LogData, error) {
+	logs := make([]*data.LogData, 0, len(fileIds))
+	for _, fileId := range fileIds {
+		l, err := c.data.FindLogByFileId(fileId)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == nil {
+			return nil, fmt.Errorf("file %s not found", fileId)
+		}
+
+		logs = append(logs, l)
+	}
+
+	return logs, nil
+}
+
+func (r *RcpCoreApi) FindLogsByFileIds(_ *http.Request, req *FileIdsRequest, res *data.LogList) error {
+	logs, err := r.core.findLocalLogs(req.FileIds)
+	if err != nil {
+		return err
+	}
+
+	res.Logs = logs
+	return nil
+}
+
+func (c *CoreApi) FindLogGroup(groupId string) (*data.LogGroup, error) {
+	logGroup, err := c.data.FindLogGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	if logGroup == nil {
+		return nil, fmt.Errorf("log group %s not found", groupId)
+	}
+
+	return logGroup, nil
+}
+
+// FindLogGroupLogs 同一个日志组的文件可能上传到不同节点，从所有节点收集组内的日志
+func (c *CoreApi) FindLogGroupLogs(groupId string) ([]*data.LogData, error) {
+	res := &data.LogList{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindLogGroupLogs", &LogGroupRequest{GroupId: groupId}, res)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]*data.LogData, 0, len(res.Logs))
+	exist := map[string]bool{}
+	for _, l := range res.Logs {
+		if exist[l.FileId] {
+			continue
+		}
+
+		exist[l.FileId] = true
+		logs = append(logs, l)
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].CreatedAt.Before(logs[j].CreatedAt)
+	})
+
+	return logs, nil
+}
+
+func (r *RcpCoreApi) FindLogGroupLogs(_ *http.Request, req *LogGroupRequest, res *data.LogList) error {
+	logGroup, err := r.core.data.FindLogGroup(req.GroupId)
+	if err != nil {
+		return err
+	}
+
+	res.Logs = []*data.LogData{}
+	if logGroup != nil {
+		res.Logs = logGroup.Logs
+	}
+
+	return nil
+}
+
+// ExportLogGroup logs 为 FindLogGroupLogs 从所有节点收集的组内日志
+func (c *CoreApi) ExportLogGroup(ctx context.Context, w io.Writer, logGroup *data.LogGroup, logs []*data.LogData) error {
+	manifest := &ExportManifest{
+		ExportedAt: time.Now(),
+		GroupId:    logGroup.GroupId,
+		Name:       logGroup.Name,
+		Tags:       toStorageTags(logGroup.Tags),
+	}
+
+	return c.writeLogsZip(ctx, w, manifest, logs, func(l *data.LogData, err error) {
+		if err != nil {
+			log.Errorf("export log group %s file %s error %s", logGroup.GroupId, l.FileId, err.Error())
+		}
+	})
+}
+
+func (c *CoreApi) ExportFiles(ctx context.Context, w io.Writer, logs []*data.LogData) error {
+	manifest := &ExportManifest{
+		ExportedAt: time.Now(),
+	}
+
+	return c.writeLogsZip(ctx, w, manifest, logs, func(l *data.LogData, err error) {
+		if err != nil {
+			log.Errorf("export file %s error %s", l.FileId, err.Error())
+		}
+	})
+}
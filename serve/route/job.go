@@ -0,0 +1,136 @@
+package route
+
+import (
+	"sync"
+	"time"
+)
+
+type JobType string
+
+const (
+	DeleteJob JobType = "delete"
+	ExportJob JobType = "export"
+)
+
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "Running"
+	JobSuccess JobStatus = "Success"
+	JobFailed  JobStatus = "Failed"
+)
+
+type JobInfo struct {
+	JobId      string       `json:"jobId"`
+	Type       JobType      `json:"type"`
+	Status     JobStatus    `json:"status"`
+	Total      int          `json:"total"`
+	Processed  int          `json:"processed"`
+	Failed     int          `json:"failed"`
+	Errors     []*FileError `json:"errors"`
+	Error      string       `json:"error,omitempty"`
+	CreatedBy  string       `json:"createdBy"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
+
+// Job 后台批量任务，只保存在创建任务的节点内存中
+type Job struct {
+	lock     sync.RWMutex
+	info     JobInfo
+	filePath string
+}
+
+func NewJob(jobId string, jobType JobType, operator string, total int) *Job {
+	return &Job{
+		info: JobInfo{
+			JobId:     jobId,
+			Type:      jobType,
+			Status:    JobRunning,
+			Total:     total,
+			Errors:    []*FileError{},
+			CreatedBy: operator,
+			CreatedAt: time.Now(),
+		},
+	}
+}
+
+func (j *Job) Info() *JobInfo {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	info := j.info
+	info.Errors = append([]*FileError{}, j.info.Errors...)
+	return &info
+}
+
+func (j *Job) FilePath() string {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.filePath
+}
+
+func (j *Job) progress(processed int, errs []*FileError) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.Processed += processed
+	j.info.Failed += len(errs)
+	j.info.Errors = append(j.info.Errors, errs...)
+}
+
+func (j *Job) finish(err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	now := time.Now()
+	j.info.FinishedAt = &now
+	if err != nil {
+		j.info.Status = JobFailed
+		j.info.Error = err.Error()
+		return
+	}
+
+	j.info.Status = JobSuccess
+}
+
+func (j *Job) finishedBefore(before time.Time) bool {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.info.FinishedAt != nil && j.info.FinishedAt.Before(before)
+}
+
+type JobManager struct {
+	lock sync.RWMutex
+	jobs map[string]*Job
+}
+
+func NewJobManager() *JobManager {
+	return &JobManager{
+		jobs: make(map[string]*Job),
+	}
+}
+
+func (m *JobManager) Add(job *Job) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.jobs[job.info.JobId] = job
+}
+
+func (m *JobManager) Get(jobId string) *Job {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.jobs[jobId]
+}
+
+// RemoveFinished 移除在 before 之前结束的任务并返回，由调用方清理任务产生的文件
+func (m *JobManager) RemoveFinished(before time.Time) []*Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	removed := []*Job{}
+	for jobId, job := range m.jobs {
+		if job.finishedBefore(before) {
+			delete(m.jobs, jobId)
+			removed = append(removed, job)
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,268 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+type MetaRequest struct {
+	Name       *string        `json:"name"`
+	AddTags    []*storage.Tag `json:"addTags"`
+	RemoveTags []*storage.Tag `json:"removeTags"`
+}
+
+func (m *MetaRequest) validate() error {
+	if m.Name != nil && strings.TrimSpace(*m.Name) == "" {
+		return fmt.Errorf("name should not be empty")
+	}
+
+	for _, t := range m.AddTags {
+		if t == nil || t.Key == "" {
+			return fmt.Errorf("tag key is required")
+		}
+
+		if include(blackTagName, t.Key) {
+			return fmt.Errorf("tag key %s is reserved", t.Key)
+		}
+	}
+
+	for _, t := range m.RemoveTags {
+		if t == nil || t.Key == "" {
+			return fmt.Errorf("tag key is required")
+		}
+	}
+
+	return nil
+}
+
+func (m *MetaRequest) hasTagChange() bool {
+	return len(m.AddTags) > 0 || len(m.RemoveTags) > 0
+}
+
+// applyTags 先删除再添加标签，删除时 value 为空表示删除该 key 下的所有标签
+func (m *MetaRequest) applyTags(tags []*data.Tag) []*data.Tag {
+	result := []*data.Tag{}
+	for _, t := range tags {
+		removed := false
+		for _, r := range m.RemoveTags {
+			if r.Key == t.Key && (r.Value == "" || r.Value == t.Value) {
+				removed = true
+				break
+			}
+		}
+
+		if !removed {
+			result = append(result, t)
+		}
+	}
+
+	for _, a := range m.AddTags {
+		exist := false
+		for _, t := range result {
+			if t.Key == a.Key && t.Value == a.Value {
+				exist = true
+				break
+			}
+		}
+
+		if !exist {
+			result = append(result, &data.Tag{
+				Key:   a.Key,
+				Value: a.Value,
+			})
+		}
+	}
+
+	return result
+}
+
+func (c *CoreApi) UpdateFileMeta(fileId string, req *MetaRequest) (*data.LogData, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	logData, err := c.data.FindLogByFileId(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if logData == nil {
+		return nil, fmt.Errorf("file %s not found", fileId)
+	}
+
+	if req.Name != nil {
+		logData.Name = *req.Name
+	}
+
+	logData.Tags = req.applyTags(logData.Tags)
+	err = c.data.UpdateLogMeta(logData)
+	if err != nil {
+		return nil, err
+	}
+
+	if logData.LogGroupID != nil && req.hasTagChange() {
+		err = c.data.RefreshLogGroupTags(*logData.LogGroupID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.data.FindLogByFileId(fileId)
+}
+
+// UpdateLogGroupMeta 同一个日志组的文件可能上传到不同节点，每个节点更新本机的部分，返回合并后的日志组
+func (c *CoreApi) UpdateLogGroupMeta(groupId string, req *MetaRequest) (*data.LogGroup, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	errs := c.batchLogGroups("CoreApi.UpdateLogGroupsMeta", &BatchLogGroupRequest{GroupIds: []string{groupId}, Meta: req}, func(groupId string) (bool, error) {
+		return c.updateLocalLogGroupMeta(groupId, req)
+	}, "log group %s not found")
+	if len(errs) > 0 {
+		return nil, errors.New(errs[0].Error)
+	}
+
+	return c.FindClusterLogGroup(groupId)
+}
+
+// updateLocalLogGroupMeta 日志组标签为组内日志标签的并集，因此标签变更会作用到组内每个日志
+func (c *CoreApi) updateLocalLogGroupMeta(groupId string, req *MetaRequest) (bool, error) {
+	logGroup, err := c.data.FindLogGroup(groupId)
+	if err != nil {
+		return false, err
+	}
+
+	if logGroup == nil {
+		return false, nil
+	}
+
+	if req.hasTagChange() {
+		for _, l := range logGroup.Logs {
+			l.Tags = req.applyTags(l.Tags)
+			err = c.data.UpdateLogMeta(l)
+			if err != nil {
+				return true, err
+			}
+		}
+
+		err = c.data.RefreshLogGroupTags(logGroup.ID)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if req.Name != nil {
+		logGroup.Name = *req.Name
+		err = c.data.UpdateLogGroupName(logGroup)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func (r *RcpCoreApi) UpdateLogGroupsMeta(_ *http.Request, req *BatchLogGroupRequest, res *BatchLogGroupResponse) error {
+	if req.Meta == nil {
+		return fmt.Errorf("meta is required")
+	}
+
+	*res = *localLogGroups(req.GroupIds, func(groupId string) (bool, error) {
+		return r.core.updateLocalLogGroupMeta(groupId, req.Meta)
+	})
+	return nil
+}
+
+// LogGroupList 各节点上同一个日志组的部分
+type LogGroupList struct {
+	Groups []*data.LogGroup
+}
+
+func (l *LogGroupList) Merge(result rpc.MergeResult) error {
+	list, ok := result.(*LogGroupList)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	l.Groups = append(l.Groups, list.Groups...)
+	return nil
+}
+
+func (l *LogGroupList) New() rpc.MergeResult {
+	return &LogGroupList{}
+}
+
+// FindClusterLogGroup 合并各节点上的日志组，日志和标签取并集，大小相加
+func (c *CoreApi) FindClusterLogGroup(groupId string) (*data.LogGroup, error) {
+	res := &LogGroupList{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindLogGroupParts", &LogGroupRequest{GroupId: groupId}, res)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Groups) <= 0 {
+		return nil, fmt.Errorf("log group %s not found", groupId)
+	}
+
+	sort.SliceStable(res.Groups, func(i, j int) bool {
+		return res.Groups[i].CreatedAt.Before(res.Groups[j].CreatedAt)
+	})
+
+	merged := *res.Groups[0]
+	merged.Size = 0
+	merged.Logs = []*data.LogData{}
+	merged.Tags = []*data.Tag{}
+	fileIds := map[string]bool{}
+	tags := map[data.Tag]bool{}
+	for _, g := range res.Groups {
+		merged.Size += g.Size
+		if g.UpdatedAt.After(merged.UpdatedAt) {
+			merged.UpdatedAt = g.UpdatedAt
+		}
+
+		for _, l := range g.Logs {
+			if !fileIds[l.FileId] {
+				fileIds[l.FileId] = true
+				merged.Logs = append(merged.Logs, l)
+			}
+		}
+
+		for _, t := range g.Tags {
+			key := data.Tag{Key: t.Key, Value: t.Value}
+			if !tags[key] {
+				tags[key] = true
+				merged.Tags = append(merged.Tags, t)
+			}
+		}
+	}
+
+	err = c.fillLogGroupsNoteCount([]*data.LogGroup{&merged})
+	if err != nil {
+		return nil, err
+	}
+
+	return &merged, nil
+}
+
+func (r *RcpCoreApi) FindLogGroupParts(_ *http.Request, req *LogGroupRequest, res *LogGroupList) error {
+	logGroup, err := r.core.data.FindLogGroup(req.GroupId)
+	if err != nil {
+		return err
+	}
+
+	res.Groups = []*data.LogGroup{}
+	if logGroup != nil {
+		res.Groups = append(res.Groups, logGroup)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+)
+
+type NoteRequest struct {
+	Content    string `json:"content"`
+	AnchorTime *int64 `json:"anchorTime"`
+}
+
+func (n *NoteRequest) validate() error {
+	if strings.TrimSpace(n.Content) == "" {
+		return fmt.Errorf("note content is required")
+	}
+
+	if n.AnchorTime != nil && *n.AnchorTime < 0 {
+		return fmt.Errorf("note anchorTime should not be negative")
+	}
+
+	return nil
+}
+
+func (c *CoreApi) newNote(author string, req *NoteRequest) *data.LogNote {
+	return &data.LogNote{
+		Model: data.Model{
+			UpdatedAt: time.Now(),
+			CreatedAt: time.Now(),
+		},
+		NoteId:     c.CreateRecordId(),
+		Author:     author,
+		Content:    req.Content,
+		AnchorTime: req.AnchorTime,
+	}
+}
+
+func (c *CoreApi) CreateFileNote(fileId string, author string, req *NoteRequest) (*data.LogNote, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	logData, err := c.data.FindLogByFileId(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if logData == nil {
+		return nil, fmt.Errorf("file %s not found", fileId)
+	}
+
+	note := c.newNote(author, req)
+	note.FileId = fileId
+	note.LogDataID = &logData.ID
+	return note, c.data.CreateNote(note)
+}
+
+func (c *CoreApi) CreateLogGroupNote(groupId string, author string, req *NoteRequest) (*data.LogNote, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	logGroup, err := c.data.FindLogGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	if logGroup == nil {
+		return nil, fmt.Errorf("log group %s not found", groupId)
+	}
+
+	note := c.newNote(author, req)
+	note.GroupId = groupId
+	note.LogGroupID = &logGroup.ID
+	return note, c.data.CreateNote(note)
+}
+
+func (c *CoreApi) ListFileNotes(fileId string) ([]*data.LogNote, error) {
+	return c.data.FindNotesByFileId(fileId)
+}
+
+type LogGroupNotesRequest struct {
+	GroupIds []string
+}
+
+type NoteList struct {
+	Notes []*data.LogNote
+}
+
+func (l *NoteList) Merge(result rpc.MergeResult) error {
+	list, ok := result.(*NoteList)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	l.Notes = append(l.Notes, list.Notes...)
+	return nil
+}
+
+func (l *NoteList) New() rpc.MergeResult {
+	return &NoteList{}
+}
+
+// uniqNotes 共享数据库时各节点会返回相同的批注，按 noteId 去重
+func uniqNotes(list []*data.LogNote) []*data.LogNote {
+	notes := make([]*data.LogNote, 0, len(list))
+	exist := map[string]bool{}
+	for _, n := range list {
+		if exist[n.NoteId] {
+			continue
+		}
+
+		exist[n.NoteId] = true
+		notes = append(notes, n)
+	}
+
+	return notes
+}
+
+// ListLogGroupNotes 日志组批注保存在创建时处理请求的节点上，从所有节点收集
+func (c *CoreApi) ListLogGroupNotes(groupId string) ([]*data.LogNote, error) {
+	res := &NoteList{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindLogGroupNotes", &LogGroupNotesRequest{GroupIds: []string{groupId}}, res)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := uniqNotes(res.Notes)
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+	})
+
+	return notes, nil
+}
+
+// fillLogGroupsNoteCount 用所有节点上的批注数量覆盖日志组在单个节点上统计的数量
+func (c *CoreApi) fillLogGroupsNoteCount(logGroups []*data.LogGroup) error {
+	if len(logGroups) <= 0 {
+		return nil
+	}
+
+	groupIds := make([]string, 0, len(logGroups))
+	for _, g := range logGroups {
+		groupIds = append(groupIds, g.GroupId)
+	}
+
+	res := &NoteList{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindLogGroupNoteIds", &LogGroupNotesRequest{GroupIds: groupIds}, res)
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int64{}
+	for _, n := range uniqNotes(res.Notes) {
+		counts[n.GroupId]++
+	}
+
+	for _, g := range logGroups {
+		g.NoteCount = counts[g.GroupId]
+	}
+
+	return nil
+}
+
+func (r *RcpCoreApi) FindLogGroupNotes(_ *http.Request, req *LogGroupNotesRequest, res *NoteList) error {
+	res.Notes = []*data.LogNote{}
+	for _, groupId := range req.GroupIds {
+		notes, err := r.core.data.FindNotesByGroupId(groupId)
+		if err != nil {
+			return err
+		}
+
+		res.Notes = append(res.Notes, notes...)
+	}
+
+	return nil
+}
+
+func (r *RcpCoreApi) FindLogGroupNoteIds(_ *http.Request, req *LogGroupNotesRequest, res *NoteList) error {
+	notes, err := r.core.data.FindNoteIdsByGroupIds(req.GroupIds)
+	if err != nil {
+		return err
+	}
+
+	res.Notes = notes
+	return nil
+}
+
+func (c *CoreApi) UpdateNote(noteId string, req *NoteRequest) (*data.LogNote, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	note, err := c.data.FindNote(noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	if note == nil {
+		return nil, fmt.Errorf("note %s not found", noteId)
+	}
+
+	note.Content = req.Content
+	note.AnchorTime = req.AnchorTime
+	return note, c.data.UpdateNote(note)
+}
+
+func (c *CoreApi) DeleteNote(noteId string) error {
+	note, err := c.data.FindNote(noteId)
+	if err != nil {
+		return err
+	}
+
+	if note == nil {
+		return fmt.Errorf("note %s not found", noteId)
+	}
+
+	return c.data.DeleteNote(noteId)
+}
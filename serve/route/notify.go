@@ -0,0 +1,396 @@
+package route
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/hook"
+	"github.com/HuolalaTech/page-spy-api/metric"
+	"github.com/HuolalaTech/page-spy-api/notify"
+	"github.com/HuolalaTech/page-spy-api/room"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+const (
+	// notifyQueueSize 每个渠道的消息队列长度
+	notifyQueueSize  = 256
+	notifyAttempts   = 3
+	notifyRetryDelay = 2 * time.Second
+	notifyTimeout    = 10 * time.Second
+
+	defaultRoomLink = `{{if .BaseUrl}}{{.BaseUrl}}/#/devtools?address={{query .Address}}{{end}}`
+	defaultLogLink  = `{{if .BaseUrl}}{{.BaseUrl}}/#/replay?url={{query (print .BaseUrl "/api/v1/log/download?fileId=" .FileId)}}{{end}}`
+)
+
+var defaultNotifyEvents = []string{hook.RoomCreated, hook.LogUploaded}
+
+// NotifyData 链接和标题模板中可以使用的字段
+type NotifyData struct {
+	Event       string
+	BaseUrl     string
+	Name        string
+	Group       string
+	Tags        map[string]string
+	Address     string
+	User        string
+	CloseReason string
+	FileId      string
+	GroupId     string
+	Size        int64
+}
+
+func newNotifyData(event *hook.Event, baseUrl string) (*NotifyData, bool) {
+	data := &NotifyData{
+		Event:   event.Type,
+		BaseUrl: baseUrl,
+		Tags:    event.Tags,
+	}
+
+	switch d := event.Data.(type) {
+	case *room.RoomHookData:
+		data.Name = d.Name
+		data.Group = d.Group
+		data.Address = d.Address.ID
+		data.CloseReason = d.CloseReason
+		if d.Connection != nil {
+			data.User = d.Connection.Name
+			if data.User == "" {
+				data.User = d.Connection.UserID
+			}
+		}
+	case *LogHookData:
+		data.Name = d.Name
+		data.FileId = d.FileId
+		data.GroupId = d.GroupId
+		data.Size = d.Size
+	default:
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (d *NotifyData) isRoom() bool {
+	return d.Address != ""
+}
+
+func (d *NotifyData) title() string {
+	switch d.Event {
+	case hook.RoomCreated:
+		return fmt.Sprintf("New room from %s", d.Name)
+	case hook.RoomUpdated:
+		return fmt.Sprintf("Room %s updated", d.Name)
+	case hook.RoomJoined:
+		return fmt.Sprintf("%s joined room %s", d.User, d.Name)
+	case hook.RoomLeft:
+		return fmt.Sprintf("%s left room %s", d.User, d.Name)
+	case hook.RoomClosed:
+		return fmt.Sprintf("Room %s closed", d.Name)
+	case hook.LogUploaded:
+		return fmt.Sprintf("New log %s", d.Name)
+	}
+
+	return d.Event
+}
+
+// lines 房间名称和分组已经在标题和分组行中展示，不再重复列出
+func (d *NotifyData) lines() []string {
+	lines := []string{}
+	if d.Group != "" {
+		lines = append(lines, "group: "+d.Group)
+	}
+
+	tags := []string{}
+	for k, v := range d.Tags {
+		if d.isRoom() && (k == "name" || k == "group") {
+			continue
+		}
+
+		tags = append(tags, k+"="+v)
+	}
+
+	sort.Strings(tags)
+	if len(tags) > 0 {
+		lines = append(lines, strings.Join(tags, ", "))
+	}
+
+	if d.CloseReason != "" {
+		lines = append(lines, "reason: "+d.CloseReason)
+	}
+
+	if d.Size > 0 {
+		lines = append(lines, "size: "+formatNotifySize(d.Size))
+	}
+
+	return lines
+}
+
+func formatNotifySize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+
+	return fmt.Sprintf("%.1f MB", float64(size)/1024/1024)
+}
+
+type notifyChannel struct {
+	config *config.NotifyChannel
+	events map[string]bool
+	groups map[string]bool
+	tags   []*storage.Tag
+	title  *template.Template
+	// messages 每个渠道单独排队发送，一个渠道不可用时不会阻塞其它渠道
+	messages chan *notify.Message
+}
+
+func (c *notifyChannel) match(data *NotifyData) bool {
+	if !c.events[data.Event] {
+		return false
+	}
+
+	if len(c.groups) > 0 && (!data.isRoom() || !c.groups[data.Group]) {
+		return false
+	}
+
+	for _, tag := range c.tags {
+		if data.Tags[tag.Key] != tag.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newNotifyTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(template.FuncMap{
+		"query": url.QueryEscape,
+	}).Parse(text)
+}
+
+func executeNotifyTemplate(t *template.Template, data *NotifyData) (string, error) {
+	builder := &strings.Builder{}
+	err := t.Execute(builder, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(builder.String()), nil
+}
+
+func newNotifyChannel(c *config.NotifyChannel) (*notifyChannel, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("notify channel name is required")
+	}
+
+	if !notify.IsSupported(c.Type) {
+		return nil, fmt.Errorf("notify channel %s type %s is not supported, use feishu, dingtalk, wecom or slack", c.Name, c.Type)
+	}
+
+	u, err := url.Parse(c.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("notify channel %s url %s should be http or https", c.Name, c.Url)
+	}
+
+	channel := &notifyChannel{
+		config:   c,
+		events:   map[string]bool{},
+		groups:   map[string]bool{},
+		tags:     []*storage.Tag{},
+		messages: make(chan *notify.Message, notifyQueueSize),
+	}
+
+	events := c.Events
+	if len(events) <= 0 {
+		events = defaultNotifyEvents
+	}
+
+	for _, e := range events {
+		if !hook.IsEventType(e) {
+			return nil, fmt.Errorf("notify channel %s event %s is not supported, use one of %s", c.Name, e, strings.Join(hook.EventTypes, ", "))
+		}
+
+		channel.events[e] = true
+	}
+
+	for _, g := range c.Groups {
+		channel.groups[g] = true
+	}
+
+	for _, t := range c.Tags {
+		key, value, ok := strings.Cut(t, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("notify channel %s tag %s format error, expect key=value", c.Name, t)
+		}
+
+		channel.tags = append(channel.tags, &storage.Tag{Key: key, Value: value})
+	}
+
+	if c.Title != "" {
+		channel.title, err = newNotifyTemplate(c.Name, c.Title)
+		if err != nil {
+			return nil, fmt.Errorf("notify channel %s title template error %w", c.Name, err)
+		}
+	}
+
+	return channel, nil
+}
+
+// NotifyManager 按规则把事件转成群聊消息，消息只保存在内存中，发送失败重试 notifyAttempts 次
+type NotifyManager struct {
+	baseUrl  string
+	roomLink *template.Template
+	logLink  *template.Template
+	channels []*notifyChannel
+	sender   *notify.Sender
+}
+
+func NewNotifyManager(c *config.Config) (*NotifyManager, error) {
+	m := &NotifyManager{
+		channels: []*notifyChannel{},
+		sender:   notify.NewSender(notifyTimeout),
+	}
+
+	roomLink := defaultRoomLink
+	logLink := defaultLogLink
+	if c.NotifyConfig != nil {
+		m.baseUrl = strings.TrimSuffix(c.NotifyConfig.WebBaseUrl, "/")
+		if c.NotifyConfig.RoomLink != "" {
+			roomLink = c.NotifyConfig.RoomLink
+		}
+
+		if c.NotifyConfig.LogLink != "" {
+			logLink = c.NotifyConfig.LogLink
+		}
+	}
+
+	var err error
+	m.roomLink, err = newNotifyTemplate("roomLink", roomLink)
+	if err != nil {
+		return nil, fmt.Errorf("notify room link template error %w", err)
+	}
+
+	m.logLink, err = newNotifyTemplate("logLink", logLink)
+	if err != nil {
+		return nil, fmt.Errorf("notify log link template error %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, c := range c.NotifyConfig.GetChannels() {
+		channel, err := newNotifyChannel(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[c.Name] {
+			return nil, fmt.Errorf("notify channel name %s is duplicated", c.Name)
+		}
+
+		names[c.Name] = true
+		m.channels = append(m.channels, channel)
+	}
+
+	return m, nil
+}
+
+func (m *NotifyManager) Enabled() bool {
+	return len(m.channels) > 0
+}
+
+func (m *NotifyManager) Start() {
+	for _, channel := range m.channels {
+		go m.loop(channel)
+	}
+}
+
+func (m *NotifyManager) newMessage(channel *notifyChannel, data *NotifyData) (*notify.Message, error) {
+	msg := &notify.Message{
+		Title: data.title(),
+		Lines: data.lines(),
+	}
+
+	var err error
+	if channel.title != nil {
+		msg.Title, err = executeNotifyTemplate(channel.title, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 房间关闭后链接已经没有意义
+	switch data.Event {
+	case hook.RoomCreated, hook.RoomUpdated, hook.RoomJoined, hook.RoomLeft:
+		msg.LinkText = "Click to debug"
+		msg.Link, err = executeNotifyTemplate(m.roomLink, data)
+	case hook.LogUploaded:
+		msg.LinkText = "Click to replay"
+		msg.Link, err = executeNotifyTemplate(m.logLink, data)
+	}
+
+	return msg, err
+}
+
+func (m *NotifyManager) Emit(event *hook.Event) {
+	data, ok := newNotifyData(event, m.baseUrl)
+	if !ok {
+		return
+	}
+
+	for _, channel := range m.channels {
+		if !channel.match(data) {
+			continue
+		}
+
+		msg, err := m.newMessage(channel, data)
+		if err != nil {
+			log.Errorf("notify channel %s build message error %s", channel.config.Name, err.Error())
+			continue
+		}
+
+		select {
+		case channel.messages <- msg:
+		default:
+			metric.Count("notify_drop", map[string]string{
+				"channel": channel.config.Name,
+			}, 1)
+			log.Errorf("notify queue is full, drop %s message of channel %s", event.Type, channel.config.Name)
+		}
+	}
+}
+
+func (m *NotifyManager) loop(channel *notifyChannel) {
+	for msg := range channel.messages {
+		m.send(channel, msg)
+	}
+}
+
+func (m *NotifyManager) send(channel *notifyChannel, msg *notify.Message) {
+	c := channel.config
+	delay := notifyRetryDelay
+	var err error
+	for i := 0; i < notifyAttempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay = delay * 2
+		}
+
+		err = m.sender.Send(c.Type, c.Url, c.Secret, msg)
+		if err == nil {
+			return
+		}
+	}
+
+	metric.Count("notify_error", map[string]string{
+		"channel": c.Name,
+	}, 1)
+	log.Errorf("notify channel %s send %s failed after %d attempts, %s", c.Name, msg.Title, notifyAttempts, err.Error())
+}
@@ -0,0 +1,116 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+type QuotaInfo struct {
+	*data.QuotaUsage
+	Quota *config.Quota `json:"quota"`
+}
+
+func (c *CoreApi) quotaUsageQuery(value *string) *data.QuotaUsageQuery {
+	return &data.QuotaUsageQuery{
+		TagKey: c.config.QuotaConfig.GetTagKey(),
+		Value:  value,
+		Since:  time.Now().Add(-time.Hour),
+	}
+}
+
+// GetQuotaUsage 汇总各节点上按标签值统计的用量，未开启配额时返回空列表
+func (c *CoreApi) GetQuotaUsage() ([]*QuotaInfo, error) {
+	result := []*QuotaInfo{}
+	if c.config.QuotaConfig == nil {
+		return result, nil
+	}
+
+	res := &data.QuotaUsageList{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.CountQuotaUsage", c.quotaUsageQuery(nil), res)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res.Usages, func(i, j int) bool {
+		return res.Usages[i].Size > res.Usages[j].Size
+	})
+
+	for _, usage := range res.Usages {
+		result = append(result, &QuotaInfo{
+			QuotaUsage: usage,
+			Quota:      c.config.QuotaConfig.GetQuota(usage.Value),
+		})
+	}
+
+	return result, nil
+}
+
+// CheckUploadQuota 在保存日志前检查上传所属标签值的配额，size 为本次上传的大小
+func (c *CoreApi) CheckUploadQuota(tags []*storage.Tag, size int64) error {
+	if c.config.QuotaConfig == nil {
+		return nil
+	}
+
+	tagKey := c.config.QuotaConfig.GetTagKey()
+	value := ""
+	for _, t := range tags {
+		if t.Key == tagKey {
+			value = t.Value
+			break
+		}
+	}
+
+	quota := c.config.QuotaConfig.GetQuota(value)
+	if quota == nil || (quota.MaxSizeOfMB <= 0 && quota.MaxFiles <= 0 && quota.MaxUploadsPerHour <= 0) {
+		return nil
+	}
+
+	maxSize := quota.MaxSizeOfMB * 1024 * 1024
+	if maxSize > 0 && size > maxSize {
+		return room.NewQuotaExceededError("%s %s quota exceeded, upload size %d is larger than %dmb", tagKey, value, size, quota.MaxSizeOfMB)
+	}
+
+	res := &data.QuotaUsageList{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.CountQuotaUsage", c.quotaUsageQuery(&value), res)
+	if err != nil {
+		return err
+	}
+
+	usage := &data.QuotaUsage{Value: value}
+	if len(res.Usages) > 0 {
+		usage = res.Usages[0]
+	}
+
+	if quota.MaxUploadsPerHour > 0 && usage.Uploads >= quota.MaxUploadsPerHour {
+		return room.NewTooManyRequestError("%s %s quota exceeded, %d uploads in the last hour", tagKey, value, usage.Uploads)
+	}
+
+	if quota.MaxFiles > 0 && usage.Files >= quota.MaxFiles {
+		return room.NewQuotaExceededError("%s %s quota exceeded, %d files stored", tagKey, value, usage.Files)
+	}
+
+	if maxSize > 0 && usage.Size+size > maxSize {
+		return room.NewQuotaExceededError("%s %s quota exceeded, %d bytes stored, max %dmb", tagKey, value, usage.Size, quota.MaxSizeOfMB)
+	}
+
+	return nil
+}
+
+func (r *RcpCoreApi) CountQuotaUsage(_ *http.Request, req *data.QuotaUsageQuery, res *data.QuotaUsageList) error {
+	req.MachineId = r.core.addressManager.GetSelfMachineID()
+	usages, err := r.core.data.CountQuotaUsage(req)
+	if err != nil {
+		return err
+	}
+
+	res.Usages = usages
+	return nil
+}
@@ -0,0 +1,193 @@
+package route
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	roomApi "github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+// recordedMessage 录制文件中的一行，content 中的 data 是 SDK 发送的数据
+type recordedMessage struct {
+	Type      string          `json:"type"`
+	CreatedAt int64           `json:"createdAt"`
+	Content   json.RawMessage `json:"content"`
+}
+
+type recordedContent struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// sdkData SDK 通过房间发送的数据，与离线日志中的条目格式相同
+type sdkData struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type recordingEntry struct {
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type recordingMeta struct {
+	Source    string            `json:"source"`
+	Address   string            `json:"address"`
+	Name      string            `json:"name"`
+	Group     string            `json:"group"`
+	Tags      map[string]string `json:"tags"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type recordingDocument struct {
+	Version int               `json:"version"`
+	Meta    *recordingMeta    `json:"meta"`
+	Data    []*recordingEntry `json:"data"`
+}
+
+// convertRecording 把录制的房间消息转换为 V2 离线日志，只保留 SDK 发送的数据，加入、离开等房间消息不在其中
+// 服务异常退出时最后一行可能不完整，无法解析的行会被跳过
+func convertRecording(info *roomApi.Info, content []byte) ([]byte, int, error) {
+	doc := &recordingDocument{
+		Version: LogFormatV2,
+		Meta: &recordingMeta{
+			Source:    "room-recording",
+			Address:   info.Address.ID,
+			Name:      info.Name,
+			Group:     info.Group,
+			Tags:      info.Tags,
+			CreatedAt: info.CreatedAt,
+		},
+		Data: []*recordingEntry{},
+	}
+
+	skipped := 0
+	reader := bufio.NewReader(bytes.NewReader(content))
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			entry, ok := toRecordingEntry(line)
+			if !ok {
+				skipped++
+			} else if entry != nil {
+				doc.Data = append(doc.Data, entry)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if skipped > 0 {
+		log.Warnf("room %s recording skipped %d lines", info.Address.ID, skipped)
+	}
+
+	if len(doc.Data) <= 0 {
+		return nil, 0, nil
+	}
+
+	bs, err := json.Marshal(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return bs, len(doc.Data), nil
+}
+
+// toRecordingEntry 返回 false 表示该行无法解析，不是 SDK 数据的消息返回 nil
+func toRecordingEntry(line []byte) (*recordingEntry, bool) {
+	msg := &recordedMessage{}
+	err := json.Unmarshal(line, msg)
+	if err != nil {
+		return nil, false
+	}
+
+	if msg.Type != roomApi.BroadcastType && msg.Type != roomApi.MessageType {
+		return nil, true
+	}
+
+	content := &recordedContent{}
+	err = json.Unmarshal(msg.Content, content)
+	if err != nil {
+		return nil, false
+	}
+
+	data := &sdkData{}
+	if json.Unmarshal(content.Data, data) != nil || data.Type == "" {
+		return nil, true
+	}
+
+	return &recordingEntry{
+		Type:      data.Type,
+		Timestamp: msg.CreatedAt,
+		Data:      data.Data,
+	}, true
+}
+
+// SaveRecording 把房间录制转换为离线日志保存，房间地址作为日志组 ID，不计入上传配额
+func (c *CoreApi) SaveRecording(info *roomApi.Info, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	doc, entries, err := convertRecording(info, content)
+	if err != nil {
+		return err
+	}
+
+	if entries <= 0 {
+		log.Infof("room %s recording has no sdk data, skipped", info.Address.ID)
+		return os.Remove(path)
+	}
+
+	version, err := detectLogFormat(doc)
+	if err != nil {
+		return fmt.Errorf("room %s recording is not a valid log, %w", info.Address.ID, err)
+	}
+
+	tags := []*storage.Tag{}
+	for k, v := range info.Tags {
+		tags = append(tags, &storage.Tag{Key: k, Value: v})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+
+	name := info.Name
+	if name == "" {
+		name = "room"
+	}
+
+	_, err = c.CreateLogGroupFile(&storage.LogGroupFile{
+		LogFile: storage.LogFile{
+			Name:          fmt.Sprintf("%s-%s.json", name, info.CreatedAt.Format("20060102150405")),
+			Size:          int64(len(doc)),
+			Tags:          tags,
+			UpdateFile:    doc,
+			FormatVersion: version,
+		},
+		GroupId: info.Address.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("room %s recording saved, %d entries, size %d", info.Address.ID, entries, len(doc))
+	return os.Remove(path)
+}
@@ -0,0 +1,288 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+const (
+	// 每条规则单次清理的最大日志数量
+	retentionBatchSize   = 1000
+	retentionPreviewSize = 100
+	defaultRetentionRule = "default"
+	totalRetentionRule   = "total"
+)
+
+type retentionRule struct {
+	name          string
+	tag           *storage.Tag
+	exclude       []*storage.Tag
+	maxLifeOfHour int64
+	maxSizeOfByte int64
+	// total 规则覆盖全部日志，需要扣除前面规则已经清理的大小
+	total bool
+}
+
+func (r *retentionRule) getScope(machineId string) *data.RetentionScope {
+	return &data.RetentionScope{
+		Tag:       r.tag,
+		Exclude:   r.exclude,
+		MachineId: machineId,
+	}
+}
+
+func parseRetentionTag(tag string) (*storage.Tag, error) {
+	key, value, ok := strings.Cut(tag, "=")
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+	if !ok || key == "" || value == "" {
+		return nil, fmt.Errorf("retention rule tag %s format error, expect key=value", tag)
+	}
+
+	return &storage.Tag{Key: key, Value: value}, nil
+}
+
+// newRetentionRules 按配置顺序生成规则，日志只归属第一条匹配的规则，
+// 未匹配任何规则的日志使用 maxLogLifeTimeOfHour，最后按 maxLogFileSizeOfMB 限制全部日志的总大小
+func newRetentionRules(c *config.Config) ([]*retentionRule, error) {
+	rules := []*retentionRule{}
+	exclude := []*storage.Tag{}
+	for _, r := range c.RetentionRules {
+		tag, err := parseRetentionTag(r.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, &retentionRule{
+			name:          tag.Key + "=" + tag.Value,
+			tag:           tag,
+			exclude:       exclude,
+			maxLifeOfHour: r.MaxLifeTimeOfHour,
+			maxSizeOfByte: r.MaxSizeOfMB * 1024 * 1024,
+		})
+		exclude = append(exclude[:len(exclude):len(exclude)], tag)
+	}
+
+	return append(rules, &retentionRule{
+		name:          defaultRetentionRule,
+		exclude:       exclude,
+		maxLifeOfHour: c.GetMaxLogLifeTimeOfHour(),
+	}, &retentionRule{
+		name:          totalRetentionRule,
+		maxSizeOfByte: c.GetMaxLogFileSizeOfMB() * 1024 * 1024,
+		total:         true,
+	}), nil
+}
+
+type RetentionPlan struct {
+	Rule              string          `json:"rule"`
+	MaxLifeTimeOfHour int64           `json:"maxLifeTimeOfHour"`
+	MaxSizeOfMB       int64           `json:"maxSizeOfMB"`
+	Total             int64           `json:"total"`
+	Size              int64           `json:"size"`
+	RemoveTotal       int64           `json:"removeTotal"`
+	RemoveSize        int64           `json:"removeSize"`
+	Logs              []*data.LogData `json:"logs"`
+}
+
+func (p *RetentionPlan) remove(l *data.LogData) {
+	p.RemoveTotal++
+	p.RemoveSize += savedSize(l)
+	p.Logs = append(p.Logs, l)
+}
+
+type RetentionPreview struct {
+	Plans []*RetentionPlan `json:"plans"`
+}
+
+func (r *RetentionPreview) Merge(result rpc.MergeResult) error {
+	preview, ok := result.(*RetentionPreview)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	for i, plan := range preview.Plans {
+		if i >= len(r.Plans) || r.Plans[i].Rule != plan.Rule {
+			return fmt.Errorf("retention rules are different between nodes")
+		}
+
+		r.Plans[i].Total += plan.Total
+		r.Plans[i].Size += plan.Size
+		r.Plans[i].RemoveTotal += plan.RemoveTotal
+		r.Plans[i].RemoveSize += plan.RemoveSize
+		r.Plans[i].Logs = append(r.Plans[i].Logs, plan.Logs...)
+	}
+
+	return nil
+}
+
+func (r *RetentionPreview) New() rpc.MergeResult {
+	plans := make([]*RetentionPlan, 0, len(r.Plans))
+	for _, plan := range r.Plans {
+		plans = append(plans, &RetentionPlan{
+			Rule:              plan.Rule,
+			MaxLifeTimeOfHour: plan.MaxLifeTimeOfHour,
+			MaxSizeOfMB:       plan.MaxSizeOfMB,
+			Logs:              []*data.LogData{},
+		})
+	}
+
+	return &RetentionPreview{Plans: plans}
+}
+
+func savedSize(l *data.LogData) int64 {
+	if l.Status != data.Saved {
+		return 0
+	}
+
+	return l.Size
+}
+
+// planRetention 计算本机下一次清理任务会删除的日志，清理任务和预览共用
+func (c *CoreApi) planRetention() ([]*RetentionPlan, error) {
+	machineId := c.addressManager.GetSelfMachineID()
+	removed := map[string]struct{}{}
+	var removedSize int64
+	plans := make([]*RetentionPlan, 0, len(c.retentionRules))
+	for _, rule := range c.retentionRules {
+		scope := rule.getScope(machineId)
+		summary, err := c.data.SummaryRetentionLogs(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		plan := &RetentionPlan{
+			Rule:              rule.name,
+			MaxLifeTimeOfHour: rule.maxLifeOfHour,
+			MaxSizeOfMB:       rule.maxSizeOfByte / (1024 * 1024),
+			Total:             summary.Total,
+			Size:              summary.Size,
+			Logs:              []*data.LogData{},
+		}
+		plans = append(plans, plan)
+
+		size := summary.Size
+		if rule.total {
+			size -= removedSize
+		}
+
+		overSize := rule.maxSizeOfByte > 0 && size > rule.maxSizeOfByte
+		if rule.maxLifeOfHour <= 0 && !overSize {
+			continue
+		}
+
+		logs, err := c.data.FindRetentionLogs(scope, retentionBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		before := time.Now().Add(-time.Duration(rule.maxLifeOfHour) * time.Hour)
+		for _, l := range logs {
+			if _, ok := removed[l.FileId]; ok {
+				continue
+			}
+
+			// 日志按创建时间从旧到新排列，遇到未过期且未超出大小的日志即可停止
+			expired := rule.maxLifeOfHour > 0 && l.CreatedAt.Before(before)
+			overSize := rule.maxSizeOfByte > 0 && size > rule.maxSizeOfByte
+			if !expired && !overSize {
+				break
+			}
+
+			removed[l.FileId] = struct{}{}
+			removedSize += savedSize(l)
+			size -= savedSize(l)
+			plan.remove(l)
+		}
+	}
+
+	return plans, nil
+}
+
+func (c *CoreApi) CleanFile() error {
+	plans, err := c.planRetention()
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
+		if len(plan.Logs) <= 0 {
+			continue
+		}
+
+		log.Infof("clean %d files %dmb by retention rule %s", plan.RemoveTotal, plan.RemoveSize/(1024*1024), plan.Rule)
+		for _, l := range plan.Logs {
+			err := c.DeleteFile(l.FileId)
+			if err != nil {
+				log.Errorf("delete file %s error %s", l.FileId, err.Error())
+				continue
+			}
+
+			log.Infof("clean file %s name %s by retention rule %s createdAt %s", l.FileId, l.Name, plan.Rule, l.CreatedAt.String())
+		}
+	}
+
+	return nil
+}
+
+func (c *CoreApi) previewLocalRetention() (*RetentionPreview, error) {
+	plans, err := c.planRetention()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		if len(plan.Logs) > retentionPreviewSize {
+			plan.Logs = plan.Logs[:retentionPreviewSize]
+		}
+	}
+
+	return &RetentionPreview{Plans: plans}, nil
+}
+
+// PreviewRetention 汇总各节点下一次清理任务会删除的日志，每条规则最多返回 retentionPreviewSize 条日志
+func (c *CoreApi) PreviewRetention() (*RetentionPreview, error) {
+	plans := make([]*RetentionPlan, 0, len(c.retentionRules))
+	for _, rule := range c.retentionRules {
+		plans = append(plans, &RetentionPlan{
+			Rule:              rule.name,
+			MaxLifeTimeOfHour: rule.maxLifeOfHour,
+			MaxSizeOfMB:       rule.maxSizeOfByte / (1024 * 1024),
+			Logs:              []*data.LogData{},
+		})
+	}
+
+	res := &RetentionPreview{Plans: plans}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.PreviewRetention", &RetentionPreviewRequest{}, res)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range res.Plans {
+		if len(plan.Logs) > retentionPreviewSize {
+			plan.Logs = plan.Logs[:retentionPreviewSize]
+		}
+	}
+
+	return res, nil
+}
+
+type RetentionPreviewRequest struct{}
+
+func (r *RcpCoreApi) PreviewRetention(_ *http.Request, _ *RetentionPreviewRequest, res *RetentionPreview) error {
+	preview, err := r.core.previewLocalRetention()
+	if err != nil {
+		return err
+	}
+
+	res.Plans = preview.Plans
+	return nil
+}
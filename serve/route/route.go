@@ -1,13 +1,16 @@
 package route
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/HuolalaTech/page-spy-api/config"
 	"github.com/HuolalaTech/page-spy-api/data"
@@ -20,7 +23,7 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var blackTagName = []string{"page", "size", "from", "to"}
+var blackTagName = []string{"page", "size", "from", "to", "uploadKey"}
 
 func include(arr []string, value string) bool {
 	for _, v := range arr {
@@ -45,7 +48,59 @@ func getTags(params url.Values) []*storage.Tag {
 	return tags
 }
 
-func getQueryList(c echo.Context) (*data.FileListQuery, error) {
+// newUploadLog 解压并校验上传的日志，检查配额后生成待保存的文件，limit 为解压后的大小上限
+func newUploadLog(core *CoreApi, name string, tags []*storage.Tag, content []byte, limit int64) (*storage.LogFile, error) {
+	// 保存的是解压后的内容，去掉文件名中的 .gz 后缀
+	if bytes.HasPrefix(content, gzipMagic) {
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	content, version, err := core.ParseLogContent(content, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = core.CheckUploadQuota(tags, int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.LogFile{
+		Tags:          tags,
+		Name:          name,
+		Size:          int64(len(content)),
+		UpdateFile:    content,
+		FormatVersion: version,
+	}, nil
+}
+
+// readFormLog 读取表单中 log 字段的文件
+func readFormLog(c echo.Context, core *CoreApi) (*storage.LogFile, error) {
+	err := core.decodeRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := c.FormFile("log")
+	if err != nil {
+		return nil, unwrapRoomError(err)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open upload file error: %w", err)
+	}
+
+	defer src.Close()
+	fileBs, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("read upload file error: %w", err)
+	}
+
+	return newUploadLog(core, file.Filename, getUploadTags(c, core), fileBs, core.maxUploadSize())
+}
+
+func getPageQuery(c echo.Context) (*data.PageQuery, error) {
 	page := c.QueryParam("page")
 	size := c.QueryParam("size")
 	if page == "" || size == "" {
@@ -62,34 +117,95 @@ func getQueryList(c echo.Context) (*data.FileListQuery, error) {
 		return nil, err
 	}
 
+	return &data.PageQuery{
+		Size: sizeNum,
+		Page: pageNum,
+	}, nil
+}
+
+func getQueryList(c echo.Context) (*data.FileListQuery, error) {
+	pageQuery, err := getPageQuery(c)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := getFilterQuery(c)
+	if err != nil {
+		return nil, err
+	}
+
+	query.PageQuery = *pageQuery
+	return query, nil
+}
+
+// getFilterQuery 解析标签和时间范围筛选条件，不包含分页
+func getFilterQuery(c echo.Context) (*data.FileListQuery, error) {
 	query := &data.FileListQuery{
-		PageQuery: data.PageQuery{
-			Size: sizeNum,
-			Page: pageNum,
-		},
 		Tags: getTags(c.QueryParams()),
 	}
 
-	fromString := c.QueryParam("from")
-	if fromString != "" {
-		fromStringUnix, err := strconv.ParseInt(fromString, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("from time format error %w", err)
-		}
-		query.From = &fromStringUnix
+	from, err := getUnixQuery(c, "from")
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := getUnixQuery(c, "to")
+	if err != nil {
+		return nil, err
 	}
 
-	toString := c.QueryParam("to")
+	query.From = from
+	query.To = to
+	return query, nil
+}
+
+// getUnixQuery 解析秒级时间戳参数，参数为空时返回 nil
+func getUnixQuery(c echo.Context, name string) (*int64, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
 
-	if toString != "" {
-		toStringUnix, err := strconv.ParseInt(toString, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("to time format error %w", err)
-		}
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s time format error %w", name, err)
+	}
+
+	return &unix, nil
+}
 
-		query.To = &toStringUnix
+func writeLogFile(c echo.Context, file *storage.LogFile) error {
+	defer file.FileSteam.Close()
+	c.Response().Header().Set("Content-Disposition", "attachment; filename="+file.Name)
+	c.Response().Header().Set("Content-Type", "application/octet-stream")
+	c.Response().Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	_, err := io.Copy(c.Response().Writer, file.FileSteam)
+	return err
+}
+
+// writeZipResponse 流式写入 zip，响应开始后无法再返回错误信息，只记录日志
+func writeZipResponse(c echo.Context, name string, write func(w io.Writer) error) error {
+	c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Response().Header().Set("Content-Type", "application/zip")
+	c.Response().WriteHeader(http.StatusOK)
+	err := write(c.Response())
+	if err != nil {
+		log.Errorf("write zip %s error %s", name, err.Error())
 	}
-	return query, nil
+
+	return nil
+}
+
+func getLogMachineId(core *CoreApi, fileId string, groupId string) (string, error) {
+	if fileId != "" {
+		return core.GetMachineIdByFileName(fileId)
+	}
+
+	if groupId != "" {
+		return core.GetLogGroupMachineId(groupId)
+	}
+
+	return "", fmt.Errorf("fileId or groupId is required")
 }
 
 func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, proxyManager *proxy.ProxyManager, staticConfig *config.StaticConfig) *echo.Echo {
@@ -101,6 +217,16 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 	e.HideBanner = true
 	route := e.Group("/api/v1")
 
+	// 公开接口限流，配置错误时无法启动
+	rateLimit := func(policy string) echo.MiddlewareFunc {
+		m, err := selfMiddleware.RateLimit(config, policy, len(core.addressManager.GetMachineIpInfo()))
+		if err != nil {
+			panic(err)
+		}
+
+		return m
+	}
+
 	// 公共路由 - 无需认证
 	publicRoute := route.Group("")
 
@@ -126,8 +252,8 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 			return c.JSON(http.StatusOK, common.NewErrorResponseWithCode("Incorrect password", "INVALID_PASSWORD"))
 		}
 
-		// 生成JWT令牌
-		token, expirationHours, err := selfMiddleware.GenerateToken(config)
+		// 生成JWT令牌，所有人共用一个密码，subject 不能由调用方指定
+		token, expirationHours, err := selfMiddleware.GenerateToken(config, "admin")
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, common.NewErrorResponseWithCode("Failed to generate token", "TOKEN_GENERATION_FAILED"))
 		}
@@ -143,16 +269,39 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 	publicRoute.POST("/room/create", func(c echo.Context) error {
 		socket.CreateRoom(c.Response(), c.Request())
 		return nil
-	})
+	}, rateLimit("room"))
+
+	// 携带密码加入房间与密码校验接口共用令牌桶，防止通过加入房间换 IP 猜测密码
+	checkLimit := rateLimit("check")
+	secretLimit := func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := checkLimit(next)
+		return func(c echo.Context) error {
+			if c.QueryParam("secret") == "" {
+				return next(c)
+			}
+
+			return limited(c)
+		}
+	}
 
 	publicRoute.GET("/ws/room/join", func(c echo.Context) error {
-		socket.JoinRoom(c.Response(), c.Request())
+		socket.JoinRoom(c.Response(), c.Request(), selfMiddleware.IsAuthorized(config, c.Request()))
 		return nil
-	})
+	}, rateLimit("join"), secretLimit)
 
 	publicRoute.GET("/room/check", func(c echo.Context) error {
 		socket.CheckRoomSecret(c.Response(), c.Request())
 		return nil
+	}, checkLimit)
+
+	// EventSource 和浏览器的 WebSocket 无法设置请求头，令牌可以通过 token 参数传递
+	publicRoute.GET("/room/stream", func(c echo.Context) error {
+		if !selfMiddleware.IsAuthorized(config, c.Request()) {
+			return c.JSON(http.StatusUnauthorized, common.NewErrorResponseWithCode("Authentication token expired or invalid", "EXPIRED_OR_INVALID_TOKEN"))
+		}
+
+		socket.StreamRooms(c.Response(), c.Request())
+		return nil
 	})
 
 	// 受保护的路由组 - 需要认证
@@ -170,6 +319,21 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 		return nil
 	})
 
+	protectedRoute.GET("/room/detail", func(c echo.Context) error {
+		socket.GetRoomDetail(c.Response(), c.Request())
+		return nil
+	})
+
+	protectedRoute.POST("/room/close", func(c echo.Context) error {
+		socket.CloseRoom(c.Response(), c.Request(), selfMiddleware.GetOperator(c))
+		return nil
+	})
+
+	protectedRoute.POST("/room/kick", func(c echo.Context) error {
+		socket.KickConnection(c.Response(), c.Request(), selfMiddleware.GetOperator(c))
+		return nil
+	})
+
 	protectedRoute.GET("/log/count", func(c echo.Context) error {
 		key := c.QueryParam("key")
 		result, err := core.data.CountLogsGroup(key)
@@ -180,6 +344,30 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 		return c.JSON(200, common.NewSuccessResponse(result))
 	})
 
+	protectedRoute.GET("/log/stats", func(c echo.Context) error {
+		from, err := getUnixQuery(c, "from")
+		if err != nil {
+			return err
+		}
+
+		to, err := getUnixQuery(c, "to")
+		if err != nil {
+			return err
+		}
+
+		query, err := NewStatsQuery(c.QueryParam("key"), c.QueryParam("interval"), from, to)
+		if err != nil {
+			return err
+		}
+
+		stats, err := core.GetStorageStats(query)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(stats))
+	})
+
 	protectedRoute.GET("/log/download", func(c echo.Context) error {
 		fileId := c.QueryParam("fileId")
 		machine, err := core.GetMachineIdByFileName(fileId)
@@ -195,16 +383,52 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 			return err
 		}
 
-		defer file.FileSteam.Close()
-		c.Response().Header().Set("Content-Disposition", "attachment; filename="+file.Name)
-		c.Response().Header().Set("Content-Type", "application/octet-stream")
-		c.Response().Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
-		_, err = io.Copy(c.Response().Writer, file.FileSteam)
+		return writeLogFile(c, file)
+	})
+
+	protectedRoute.GET("/logGroup/export", func(c echo.Context) error {
+		groupId := c.QueryParam("groupId")
+		machine, err := getLogMachineId(core, "", groupId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		logGroup, err := core.FindLogGroup(groupId)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		logs, err := core.FindLogGroupLogs(groupId)
+		if err != nil {
+			return err
+		}
+
+		return writeZipResponse(c, groupId+".zip", func(w io.Writer) error {
+			return core.ExportLogGroup(c.Request().Context(), w, logGroup, logs)
+		})
+	})
+
+	protectedRoute.GET("/log/export", func(c echo.Context) error {
+		fileIds := c.QueryParams()["fileId"]
+		if len(fileIds) <= 0 {
+			return fmt.Errorf("fileId is required")
+		}
+
+		if len(fileIds) > maxBulkFiles {
+			return fmt.Errorf("export at most %d files", maxBulkFiles)
+		}
+
+		logs, err := core.FindLogsByFileIds(fileIds)
+		if err != nil {
+			return err
+		}
+
+		return writeZipResponse(c, fmt.Sprintf("page-spy-logs-%s.zip", time.Now().Format("20060102150405")), func(w io.Writer) error {
+			return core.ExportFiles(c.Request().Context(), w, logs)
+		})
 	})
 
 	protectedRoute.GET("/logGroup/list", func(c echo.Context) error {
@@ -254,20 +478,9 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 			return fmt.Errorf("not allowed delete log")
 		}
 
-		fileIds := c.QueryParams()["fileId"]
-		for _, fileId := range fileIds {
-			machine, err := core.GetMachineIdByFileName(fileId)
-			if err != nil {
-				return err
-			}
-			if !core.IsSelfMachine(machine) {
-				return proxyManager.Proxy(machine, c)
-			}
-
-			err = core.DeleteFile(fileId)
-			if err != nil {
-				return err
-			}
+		err := batchError(core.TrashFiles(c.QueryParams()["fileId"], selfMiddleware.GetOperator(c)))
+		if err != nil {
+			return err
 		}
 
 		return c.JSON(200, common.NewSuccessResponse(true))
@@ -278,113 +491,717 @@ func NewEcho(socket *socket.WebSocket, core *CoreApi, config *config.Config, pro
 			return fmt.Errorf("not allowed delete log")
 		}
 
-		groupIds := c.QueryParams()["groupId"]
-		for _, groupId := range groupIds {
-			err := core.DeleteLogGroup(groupId)
-			if err != nil {
-				return err
-			}
+		err := batchLogGroupError(core.TrashLogGroups(c.QueryParams()["groupId"], selfMiddleware.GetOperator(c)))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
 
+	// 回收站
+	protectedRoute.GET("/log/trash/list", func(c echo.Context) error {
+		query, err := getQueryList(c)
+		if err != nil {
+			return err
+		}
+
+		query.Trashed = true
+		logs, err := core.GetFileList(query)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(logs))
+	})
+
+	protectedRoute.GET("/logGroup/trash/list", func(c echo.Context) error {
+		query, err := getQueryList(c)
+		if err != nil {
+			return err
+		}
+
+		query.Trashed = true
+		logGroups, err := core.GetLogGroupList(query)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(logGroups))
+	})
+
+	protectedRoute.POST("/log/trash/restore", func(c echo.Context) error {
+		err := batchError(core.RestoreFiles(c.QueryParams()["fileId"]))
+		if err != nil {
+			return err
 		}
 
 		return c.JSON(200, common.NewSuccessResponse(true))
 	})
 
-	// 以下是需要公开的上传接口
-	publicRoute.POST("/logGroup/upload", func(c echo.Context) error {
-		file, err := c.FormFile("log")
+	protectedRoute.DELETE("/log/trash/purge", func(c echo.Context) error {
+		if config.NotAllowedDeleteLog {
+			return fmt.Errorf("not allowed delete log")
+		}
+
+		err := batchError(core.PurgeFiles(c.QueryParams()["fileId"]))
 		if err != nil {
 			return err
 		}
 
-		src, err := file.Open()
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
+
+	protectedRoute.POST("/logGroup/trash/restore", func(c echo.Context) error {
+		err := batchLogGroupError(core.RestoreLogGroups(c.QueryParams()["groupId"]))
 		if err != nil {
-			return fmt.Errorf("open upload file error: %w", err)
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
+
+	protectedRoute.DELETE("/logGroup/trash/purge", func(c echo.Context) error {
+		if config.NotAllowedDeleteLog {
+			return fmt.Errorf("not allowed delete log")
 		}
 
-		defer src.Close()
-		fileBs, err := io.ReadAll(src)
+		err := batchLogGroupError(core.PurgeLogGroups(c.QueryParams()["groupId"]))
 		if err != nil {
-			return fmt.Errorf("read upload file error: %w", err)
+			return err
 		}
 
-		ts := getTags(c.QueryParams())
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
 
-		groupId := c.QueryParam("groupId")
-		if groupId == "" {
-			return fmt.Errorf("groupId is required")
+	// 按条件批量操作
+	protectedRoute.GET("/log/bulk/preview", func(c echo.Context) error {
+		query, err := getFilterQuery(c)
+		if err != nil {
+			return err
 		}
 
-		logFile := &storage.LogGroupFile{
-			LogFile: storage.LogFile{
-				Tags:       ts,
-				Name:       file.Filename,
-				Size:       file.Size,
-				UpdateFile: fileBs,
-			},
-			GroupId: groupId,
+		summary, err := core.PreviewBulk(query)
+		if err != nil {
+			return err
 		}
 
-		createFile, err := core.CreateLogGroupFile(logFile)
+		return c.JSON(200, common.NewSuccessResponse(summary))
+	})
+
+	protectedRoute.GET("/quota/usage", func(c echo.Context) error {
+		usages, err := core.GetQuotaUsage()
 		if err != nil {
 			return err
 		}
 
-		return c.JSON(200, common.NewSuccessResponse(createFile))
+		return c.JSON(200, common.NewSuccessResponse(usages))
 	})
 
-	publicRoute.POST("/jsonLog/upload", func(c echo.Context) error {
-		fileName := c.QueryParam("name")
-		body, err := io.ReadAll(c.Request().Body)
+	protectedRoute.GET("/log/retention/preview", func(c echo.Context) error {
+		preview, err := core.PreviewRetention()
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(preview))
+	})
+
+	protectedRoute.POST("/log/bulk/delete", func(c echo.Context) error {
+		if config.NotAllowedDeleteLog {
+			return fmt.Errorf("not allowed delete log")
+		}
+
+		query, err := getFilterQuery(c)
 		if err != nil {
-			return fmt.Errorf("open upload file error: %w", err)
+			return err
 		}
 
-		logFile := &storage.LogFile{
-			Tags:       getTags(c.QueryParams()),
-			Name:       fileName,
-			Size:       int64(len(body)),
-			UpdateFile: body,
+		if len(query.Tags) <= 0 && query.From == nil && query.To == nil {
+			return fmt.Errorf("bulk delete need at least one tag or time range")
 		}
 
-		createFile, err := core.CreateFile(logFile)
+		job, err := core.StartBulkDelete(query, selfMiddleware.GetOperator(c))
 		if err != nil {
 			return err
 		}
 
-		return c.JSON(200, common.NewSuccessResponse(createFile))
+		return c.JSON(200, common.NewSuccessResponse(job))
 	})
 
-	publicRoute.POST("/log/upload", func(c echo.Context) error {
-		file, err := c.FormFile("log")
+	protectedRoute.POST("/log/bulk/export", func(c echo.Context) error {
+		query, err := getFilterQuery(c)
+		if err != nil {
+			return err
+		}
+
+		job, err := core.StartBulkExport(query, selfMiddleware.GetOperator(c))
 		if err != nil {
 			return err
 		}
 
-		src, err := file.Open()
+		return c.JSON(200, common.NewSuccessResponse(job))
+	})
+
+	protectedRoute.GET("/log/bulk/job", func(c echo.Context) error {
+		jobId := c.QueryParam("jobId")
+		machine, err := core.GetMachineIdByFileName(jobId)
 		if err != nil {
-			return fmt.Errorf("open upload file error: %w", err)
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
 		}
 
-		defer src.Close()
-		fileBs, err := io.ReadAll(src)
+		job, err := core.GetJob(jobId)
 		if err != nil {
-			return fmt.Errorf("read upload file error: %w", err)
+			return err
 		}
 
-		logFile := &storage.LogFile{
-			Tags:       getTags(c.QueryParams()),
-			Name:       file.Filename,
-			Size:       file.Size,
-			UpdateFile: fileBs,
+		return c.JSON(200, common.NewSuccessResponse(job.Info()))
+	})
+
+	protectedRoute.GET("/log/bulk/download", func(c echo.Context) error {
+		jobId := c.QueryParam("jobId")
+		machine, err := core.GetMachineIdByFileName(jobId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
 		}
 
-		createFile, err := core.CreateFile(logFile)
+		job, err := core.GetJob(jobId)
 		if err != nil {
 			return err
 		}
 
-		return c.JSON(200, common.NewSuccessResponse(createFile))
+		info := job.Info()
+		if info.Type != ExportJob || info.Status != JobSuccess {
+			return fmt.Errorf("job %s has no export file", jobId)
+		}
+
+		return c.Attachment(job.FilePath(), fmt.Sprintf("page-spy-logs-%s.zip", info.CreatedAt.Format("20060102150405")))
+	})
+
+	// 修改日志元数据
+	protectedRoute.PATCH("/log/update", func(c echo.Context) error {
+		fileId := c.QueryParam("fileId")
+		machine, err := core.GetMachineIdByFileName(fileId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		req := &MetaRequest{}
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+
+		logData, err := core.UpdateFileMeta(fileId, req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(logData))
+	})
+
+	protectedRoute.PATCH("/logGroup/update", func(c echo.Context) error {
+		groupId := c.QueryParam("groupId")
+		if groupId == "" {
+			return fmt.Errorf("groupId is required")
+		}
+
+		req := &MetaRequest{}
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+
+		logGroup, err := core.UpdateLogGroupMeta(groupId, req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(logGroup))
+	})
+
+	// 日志批注
+	protectedRoute.GET("/log/notes", func(c echo.Context) error {
+		fileId := c.QueryParam("fileId")
+		groupId := c.QueryParam("groupId")
+		// 日志组批注可能分布在多个节点，由当前节点汇总
+		if fileId == "" && groupId != "" {
+			notes, err := core.ListLogGroupNotes(groupId)
+			if err != nil {
+				return err
+			}
+
+			return c.JSON(200, common.NewSuccessResponse(notes))
+		}
+
+		machine, err := getLogMachineId(core, fileId, groupId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		notes, err := core.ListFileNotes(fileId)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(notes))
+	})
+
+	protectedRoute.POST("/log/notes", func(c echo.Context) error {
+		fileId := c.QueryParam("fileId")
+		groupId := c.QueryParam("groupId")
+		machine, err := getLogMachineId(core, fileId, groupId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		req := &NoteRequest{}
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+
+		var note *data.LogNote
+		if fileId != "" {
+			note, err = core.CreateFileNote(fileId, selfMiddleware.GetOperator(c), req)
+		} else {
+			note, err = core.CreateLogGroupNote(groupId, selfMiddleware.GetOperator(c), req)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(note))
+	})
+
+	protectedRoute.PUT("/log/notes", func(c echo.Context) error {
+		noteId := c.QueryParam("noteId")
+		machine, err := core.GetMachineIdByFileName(noteId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		req := &NoteRequest{}
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+
+		note, err := core.UpdateNote(noteId, req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(note))
+	})
+
+	protectedRoute.DELETE("/log/notes", func(c echo.Context) error {
+		noteId := c.QueryParam("noteId")
+		machine, err := core.GetMachineIdByFileName(noteId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		err = core.DeleteNote(noteId)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
+
+	// 日志分享
+	protectedRoute.POST("/share/create", func(c echo.Context) error {
+		fileId := c.QueryParam("fileId")
+		groupId := c.QueryParam("groupId")
+		machine, err := getLogMachineId(core, fileId, groupId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		req := &ShareRequest{}
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+
+		share, err := core.CreateShare(fileId, groupId, req, selfMiddleware.GetOperator(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(share))
+	})
+
+	protectedRoute.GET("/share/list", func(c echo.Context) error {
+		pageQuery, err := getPageQuery(c)
+		if err != nil {
+			return err
+		}
+
+		query := &data.ShareListQuery{
+			PageQuery: *pageQuery,
+			FileId:    c.QueryParam("fileId"),
+			GroupId:   c.QueryParam("groupId"),
+		}
+
+		shares, err := core.GetShareList(query)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(shares))
+	})
+
+	protectedRoute.DELETE("/share/revoke", func(c echo.Context) error {
+		shareId := c.QueryParam("shareId")
+		machine, err := core.GetMachineIdByFileName(shareId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		err = core.RevokeShare(shareId)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
+
+	// 上传密钥
+	protectedRoute.POST("/uploadKey/create", func(c echo.Context) error {
+		req := &UploadKeyRequest{}
+		if err := c.Bind(req); err != nil {
+			return err
+		}
+
+		key, err := core.CreateUploadKey(req, selfMiddleware.GetOperator(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(key))
+	})
+
+	protectedRoute.GET("/uploadKey/list", func(c echo.Context) error {
+		pageQuery, err := getPageQuery(c)
+		if err != nil {
+			return err
+		}
+
+		keys, err := core.GetUploadKeyList(&data.UploadKeyListQuery{
+			PageQuery: *pageQuery,
+			Project:   c.QueryParam("project"),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(keys))
+	})
+
+	protectedRoute.DELETE("/uploadKey/revoke", func(c echo.Context) error {
+		keyId := c.QueryParam("keyId")
+		machine, err := core.GetMachineIdByFileName(keyId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		err = core.RevokeUploadKey(keyId)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(true))
+	})
+
+	protectedRoute.GET("/webhook/deliveries", func(c echo.Context) error {
+		pageQuery, err := getPageQuery(c)
+		if err != nil {
+			return err
+		}
+
+		deliveries, err := core.GetWebhookDeliveries(&data.WebhookDeliveryQuery{
+			PageQuery: *pageQuery,
+			Webhook:   c.QueryParam("webhook"),
+			Event:     c.QueryParam("event"),
+			EventId:   c.QueryParam("eventId"),
+			Status:    data.DeliveryStatus(c.QueryParam("status")),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(deliveries))
+	})
+
+	// 投递记录只能由生成它的节点重新投递
+	protectedRoute.POST("/webhook/redeliver", func(c echo.Context) error {
+		deliveryId := c.QueryParam("deliveryId")
+		machine, err := core.GetMachineIdByFileName(deliveryId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		delivery, err := core.RedeliverWebhook(deliveryId)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(delivery))
+	})
+
+	// 分享链接使用分享令牌鉴权，无需登录
+	publicRoute.GET("/share/info", func(c echo.Context) error {
+		claims, err := core.VerifyShareToken(c.QueryParam("token"))
+		if err != nil {
+			return err
+		}
+
+		machine, err := getLogMachineId(core, claims.FileId, claims.GroupId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		info, err := core.GetShareInfo(claims)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(info))
+	})
+
+	publicRoute.GET("/share/download", func(c echo.Context) error {
+		claims, err := core.VerifyShareToken(c.QueryParam("token"))
+		if err != nil {
+			return err
+		}
+
+		fileId := c.QueryParam("fileId")
+		if fileId == "" {
+			fileId = claims.FileId
+		}
+
+		if fileId == "" {
+			return fmt.Errorf("fileId is required for log group share")
+		}
+
+		machine, err := core.GetMachineIdByFileName(fileId)
+		if err != nil {
+			return err
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		err = core.CheckSharedFile(claims, fileId)
+		if err != nil {
+			return err
+		}
+
+		file, err := core.GetFile(fileId)
+		if err != nil {
+			return err
+		}
+
+		return writeLogFile(c, file)
+	})
+
+	// 以下是需要公开的上传接口，使用上传密钥或按配置允许匿名上传
+	uploadMiddleware := []echo.MiddlewareFunc{uploadKeyMiddleware(core), rateLimit("upload"), requireUploadKeyMiddleware}
+	publicRoute.POST("/logGroup/upload", func(c echo.Context) error {
+		groupId := c.QueryParam("groupId")
+		if groupId == "" {
+			return fmt.Errorf("groupId is required")
+		}
+
+		file, err := readFormLog(c, core)
+		if err != nil {
+			return err
+		}
+
+		logFile := &storage.LogGroupFile{
+			LogFile: *file,
+			GroupId: groupId,
+		}
+
+		createFile, err := core.CreateLogGroupFile(logFile)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(createFile))
+	}, uploadMiddleware...)
+
+	publicRoute.POST("/jsonLog/upload", func(c echo.Context) error {
+		err := core.decodeRequestBody(c)
+		if err != nil {
+			return err
+		}
+
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return unwrapRoomError(fmt.Errorf("open upload file error: %w", err))
+		}
+
+		file, err := newUploadLog(core, c.QueryParam("name"), getUploadTags(c, core), body, core.maxUploadSize())
+		if err != nil {
+			return err
+		}
+
+		createFile, err := core.CreateFile(file)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(createFile))
+	}, uploadMiddleware...)
+
+	publicRoute.POST("/log/upload", func(c echo.Context) error {
+		file, err := readFormLog(c, core)
+		if err != nil {
+			return err
+		}
+
+		createFile, err := core.CreateFile(file)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(200, common.NewSuccessResponse(createFile))
+	}, uploadMiddleware...)
+
+	// tus 断点续传上传
+	tusRoute := publicRoute.Group("/log/tus", tusMiddleware)
+	tusRoute.OPTIONS("", func(c echo.Context) error {
+		h := c.Response().Header()
+		h.Set(headerTusVersion, tusVersion)
+		h.Set("Tus-Extension", tusExtension)
+		h.Set("Tus-Max-Size", strconv.FormatInt(core.tusMaxSize(), 10))
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	tusRoute.POST("", func(c echo.Context) error {
+		if c.Request().Header.Get("Upload-Defer-Length") != "" {
+			return tusError(c, newTusError(http.StatusBadRequest, "Upload-Defer-Length is not supported"))
+		}
+
+		length, err := strconv.ParseInt(c.Request().Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			length = -1
+		}
+
+		metadata, err := parseTusMetadata(c.Request().Header.Get("Upload-Metadata"))
+		if err != nil {
+			return tusError(c, err)
+		}
+
+		upload, err := core.CreateTusUpload(length, metadata, getUploadTags(c, core))
+		if err != nil {
+			return tusError(c, err)
+		}
+
+		// creation-with-upload，创建时可以带上第一个分片
+		if c.Request().Header.Get(echo.HeaderContentType) == tusContentType {
+			upload, err = core.WriteTusUpload(upload.Id, 0, c.Request().Body)
+			if err != nil {
+				return tusError(c, err)
+			}
+		}
+
+		setTusHeaders(c, upload)
+		c.Response().Header().Set(echo.HeaderLocation, tusUploadPath+upload.Id)
+		return c.NoContent(http.StatusCreated)
+	}, uploadMiddleware...)
+
+	tusRoute.HEAD("/:id", func(c echo.Context) error {
+		machine, err := tusMachine(c, core)
+		if err != nil {
+			return tusError(c, err)
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		upload, err := core.GetTusUpload(c.Param("id"))
+		if err != nil {
+			return tusError(c, err)
+		}
+
+		setTusHeaders(c, upload)
+		return c.NoContent(http.StatusOK)
+	})
+
+	tusRoute.PATCH("/:id", func(c echo.Context) error {
+		machine, err := tusMachine(c, core)
+		if err != nil {
+			return tusError(c, err)
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		offset, err := getTusOffset(c)
+		if err != nil {
+			return tusError(c, err)
+		}
+
+		upload, err := core.WriteTusUpload(c.Param("id"), offset, c.Request().Body)
+		if err != nil {
+			return tusError(c, err)
+		}
+
+		setTusHeaders(c, upload)
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	tusRoute.DELETE("/:id", func(c echo.Context) error {
+		machine, err := tusMachine(c, core)
+		if err != nil {
+			return tusError(c, err)
+		}
+		if !core.IsSelfMachine(machine) {
+			return proxyManager.Proxy(machine, c)
+		}
+
+		err = core.DeleteTusUpload(c.Param("id"))
+		if err != nil {
+			return tusError(c, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
 	})
 
 	if staticConfig != nil {
@@ -0,0 +1,257 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	selfMiddleware "github.com/HuolalaTech/page-spy-api/serve/middleware"
+)
+
+const defaultShareLifeTime = 7 * 24 * time.Hour
+
+type ShareRequest struct {
+	// ExpiresIn 分享有效期，单位秒，默认 7 天
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+type ShareInfo struct {
+	Share *data.ShareLink `json:"share"`
+	File  *data.LogData   `json:"file,omitempty"`
+	Group *data.LogGroup  `json:"group,omitempty"`
+}
+
+func (c *CoreApi) shareToken(share *data.ShareLink) (string, error) {
+	return selfMiddleware.GenerateShareToken(c.config, share.ShareId, share.FileId, share.GroupId, share.CreatedAt, share.ExpiresAt)
+}
+
+func (c *CoreApi) CreateShare(fileId string, groupId string, req *ShareRequest, operator string) (*data.ShareLink, error) {
+	if (fileId == "") == (groupId == "") {
+		return nil, fmt.Errorf("one of fileId or groupId is required")
+	}
+
+	lifeTime := defaultShareLifeTime
+	if req.ExpiresIn > 0 {
+		lifeTime = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	maxLifeTime := time.Duration(c.config.GetMaxShareLifeTimeOfHour()) * time.Hour
+	if lifeTime > maxLifeTime {
+		return nil, fmt.Errorf("share expiresIn should not be greater than %d seconds", int64(maxLifeTime.Seconds()))
+	}
+
+	if fileId != "" {
+		logData, err := c.data.FindLogByFileId(fileId)
+		if err != nil {
+			return nil, err
+		}
+
+		if logData == nil {
+			return nil, fmt.Errorf("file %s not found", fileId)
+		}
+	} else {
+		logGroup, err := c.data.FindLogGroup(groupId)
+		if err != nil {
+			return nil, err
+		}
+
+		if logGroup == nil {
+			return nil, fmt.Errorf("log group %s not found", groupId)
+		}
+	}
+
+	// 令牌中的时间精确到秒，这里保持一致以便从记录重新生成相同的令牌
+	now := time.Now().Truncate(time.Second)
+	share := &data.ShareLink{
+		Model: data.Model{
+			UpdatedAt: now,
+			CreatedAt: now,
+		},
+		ShareId:   c.CreateRecordId(),
+		FileId:    fileId,
+		GroupId:   groupId,
+		ExpiresAt: now.Add(lifeTime),
+		CreatedBy: operator,
+	}
+
+	err := c.data.CreateShareLink(share)
+	if err != nil {
+		return nil, err
+	}
+
+	share.Token, err = c.shareToken(share)
+	return share, err
+}
+
+func (c *CoreApi) GetShareList(query *data.ShareListQuery) (*data.Page[*data.ShareLink], error) {
+	res := &data.Page[*data.ShareLink]{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindShareLinks", query, res)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Desc()
+	res.UniqData()
+	for _, share := range res.Data {
+		if !share.IsValid() {
+			continue
+		}
+
+		share.Token, err = c.shareToken(share)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func (c *CoreApi) RevokeShare(shareId string) error {
+	share, err := c.data.FindShareLink(shareId)
+	if err != nil {
+		return err
+	}
+
+	if share == nil {
+		return fmt.Errorf("share %s not found", shareId)
+	}
+
+	return c.data.RevokeShareLink(shareId)
+}
+
+func (c *CoreApi) findShareLink(shareId string) (*data.ShareLink, error) {
+	machine, err := c.GetMachineIdByFileName(shareId)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.IsSelfMachine(machine) {
+		return c.data.FindShareLink(shareId)
+	}
+
+	client := c.rpcManager.GetRpcByMachineID(machine)
+	if client == nil {
+		return nil, fmt.Errorf("rpc client %s not found", machine)
+	}
+
+	res := &ShareLinkResponse{}
+	err = client.Call(context.Background(), "CoreApi.FindShareLink", &ShareLinkRequest{ShareId: shareId}, res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Share, nil
+}
+
+// VerifyShareToken 校验分享令牌签名和有效期，并到创建分享的节点确认分享未被撤销
+func (c *CoreApi) VerifyShareToken(token string) (*selfMiddleware.ShareClaims, error) {
+	if token == "" {
+		return nil, fmt.Errorf("share token is required")
+	}
+
+	claims, err := selfMiddleware.ParseShareToken(c.config, token)
+	if err != nil {
+		return nil, fmt.Errorf("share token expired or invalid")
+	}
+
+	share, err := c.findShareLink(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if share == nil || !share.IsValid() {
+		return nil, fmt.Errorf("share %s has been revoked", claims.ID)
+	}
+
+	return claims, nil
+}
+
+func (c *CoreApi) GetShareInfo(claims *selfMiddleware.ShareClaims) (*ShareInfo, error) {
+	share, err := c.findShareLink(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ShareInfo{Share: share}
+	if claims.FileId != "" {
+		info.File, err = c.data.FindLogByFileId(claims.FileId)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.File == nil {
+			return nil, fmt.Errorf("file %s not found", claims.FileId)
+		}
+
+		return info, nil
+	}
+
+	info.Group, err = c.data.FindLogGroup(claims.GroupId)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Group == nil {
+		return nil, fmt.Errorf("log group %s not found", claims.GroupId)
+	}
+
+	return info, nil
+}
+
+// CheckSharedFile 检查文件是否在分享范围内，日志组分享时文件需属于该日志组
+func (c *CoreApi) CheckSharedFile(claims *selfMiddleware.ShareClaims, fileId string) error {
+	if claims.FileId != "" {
+		if claims.FileId != fileId {
+			return fmt.Errorf("file %s is not shared", fileId)
+		}
+
+		return nil
+	}
+
+	logGroup, err := c.data.FindLogGroup(claims.GroupId)
+	if err != nil {
+		return err
+	}
+
+	if logGroup != nil {
+		for _, l := range logGroup.Logs {
+			if l.FileId == fileId {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("file %s is not shared", fileId)
+}
+
+type ShareLinkRequest struct {
+	ShareId string
+}
+
+type ShareLinkResponse struct {
+	Share *data.ShareLink
+}
+
+func (r *RcpCoreApi) FindShareLink(_ *http.Request, req *ShareLinkRequest, res *ShareLinkResponse) error {
+	share, err := r.core.data.FindShareLink(req.ShareId)
+	if err != nil {
+		return err
+	}
+
+	res.Share = share
+	return nil
+}
+
+func (r *RcpCoreApi) FindShareLinks(_ *http.Request, req *data.ShareListQuery, res *data.Page[*data.ShareLink]) error {
+	page, err := r.core.data.FindShareLinks(req)
+	if err != nil {
+		return err
+	}
+
+	res.Data = page.Data
+	res.Total = page.Total
+	return nil
+}
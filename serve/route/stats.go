@@ -0,0 +1,342 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+)
+
+const (
+	statsCacheTime    = time.Minute
+	statsTagSize      = 100
+	statsLargestSize  = 10
+	maxStatsBucket    = 1000
+	defaultStatsTag   = "project"
+	defaultStatsRange = 24
+)
+
+type StatsQuery struct {
+	TagKey string
+	// Interval 上传趋势的分桶间隔，单位秒
+	Interval int64
+	From     int64
+	To       int64
+}
+
+// NewStatsQuery 按 hour 或 day 分桶，from 向下对齐到分桶边界，未指定时间时统计最近 24 个分桶
+func NewStatsQuery(tagKey string, interval string, from *int64, to *int64) (*StatsQuery, error) {
+	query := &StatsQuery{TagKey: tagKey}
+	if query.TagKey == "" {
+		query.TagKey = defaultStatsTag
+	}
+
+	switch interval {
+	case "", "hour":
+		query.Interval = int64(time.Hour / time.Second)
+	case "day":
+		query.Interval = int64(24 * time.Hour / time.Second)
+	default:
+		return nil, fmt.Errorf("interval %s is not supported, use hour or day", interval)
+	}
+
+	// 默认结束时间为当前分桶的结束，同一分桶内的请求可以命中缓存
+	query.To = (time.Now().Unix()/query.Interval + 1) * query.Interval
+	if to != nil {
+		query.To = *to
+	}
+
+	query.From = query.To - defaultStatsRange*query.Interval
+	if from != nil {
+		query.From = *from
+	}
+
+	query.From = query.From / query.Interval * query.Interval
+	if query.From >= query.To {
+		return nil, fmt.Errorf("from should be earlier than to")
+	}
+
+	if (query.To-query.From)/query.Interval > maxStatsBucket {
+		return nil, fmt.Errorf("time range is too large, at most %d buckets", maxStatsBucket)
+	}
+
+	return query, nil
+}
+
+func (q *StatsQuery) cacheKey() string {
+	return fmt.Sprintf("%s|%d|%d|%d", q.TagKey, q.Interval, q.From, q.To)
+}
+
+type UploadBucket struct {
+	Time  int64 `json:"time"`
+	Files int64 `json:"files"`
+	Size  int64 `json:"size"`
+}
+
+type StorageStats struct {
+	MachineId     string              `json:"machineId,omitempty"`
+	Files         int64               `json:"files"`
+	Size          int64               `json:"size"`
+	AvgSize       int64               `json:"avgSize"`
+	MaxSize       int64               `json:"maxSize"`
+	RemainingSize int64               `json:"remainingSize"`
+	ByStatus      []*data.StatusCount `json:"byStatus"`
+	ByTag         []*data.QuotaUsage  `json:"byTag"`
+	Uploads       []*UploadBucket     `json:"uploads"`
+	Largest       []*data.LogData     `json:"largest"`
+	GeneratedAt   time.Time           `json:"generatedAt"`
+}
+
+func (s *StorageStats) merge(stats *StorageStats) {
+	s.Files += stats.Files
+	s.Size += stats.Size
+	s.MaxSize += stats.MaxSize
+	s.RemainingSize += stats.RemainingSize
+	if stats.GeneratedAt.Before(s.GeneratedAt) || s.GeneratedAt.IsZero() {
+		s.GeneratedAt = stats.GeneratedAt
+	}
+
+	for _, count := range stats.ByStatus {
+		found := false
+		for _, c := range s.ByStatus {
+			if c.Status == count.Status {
+				c.Files += count.Files
+				c.Size += count.Size
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			s.ByStatus = append(s.ByStatus, &data.StatusCount{Status: count.Status, Files: count.Files, Size: count.Size})
+		}
+	}
+
+	for _, usage := range stats.ByTag {
+		found := false
+		for _, u := range s.ByTag {
+			if u.Value == usage.Value {
+				u.Files += usage.Files
+				u.Size += usage.Size
+				u.Uploads += usage.Uploads
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			copied := *usage
+			s.ByTag = append(s.ByTag, &copied)
+		}
+	}
+
+	// 各节点的查询条件相同，分桶一一对应
+	for i, bucket := range stats.Uploads {
+		if i >= len(s.Uploads) {
+			s.Uploads = append(s.Uploads, &UploadBucket{Time: bucket.Time})
+		}
+
+		s.Uploads[i].Files += bucket.Files
+		s.Uploads[i].Size += bucket.Size
+	}
+
+	s.Largest = append(s.Largest, stats.Largest...)
+}
+
+// finish 计算平均大小并截取排名靠前的标签值和文件
+func (s *StorageStats) finish() {
+	s.AvgSize = 0
+	if s.Files > 0 {
+		s.AvgSize = s.Size / s.Files
+	}
+
+	sort.Slice(s.ByTag, func(i, j int) bool {
+		return s.ByTag[i].Size > s.ByTag[j].Size
+	})
+	if len(s.ByTag) > statsTagSize {
+		s.ByTag = s.ByTag[:statsTagSize]
+	}
+
+	sort.Slice(s.Largest, func(i, j int) bool {
+		return s.Largest[i].Size > s.Largest[j].Size
+	})
+	if len(s.Largest) > statsLargestSize {
+		s.Largest = s.Largest[:statsLargestSize]
+	}
+}
+
+type StatsResult struct {
+	Cluster *StorageStats   `json:"cluster"`
+	Nodes   []*StorageStats `json:"nodes"`
+}
+
+func (r *StatsResult) Merge(result rpc.MergeResult) error {
+	stats, ok := result.(*StatsResult)
+	if !ok {
+		return fmt.Errorf("type error")
+	}
+
+	r.Nodes = append(r.Nodes, stats.Nodes...)
+	return nil
+}
+
+func (r *StatsResult) New() rpc.MergeResult {
+	return &StatsResult{}
+}
+
+type statsCache struct {
+	lock  sync.Mutex
+	items map[string]*StorageStats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{
+		items: map[string]*StorageStats{},
+	}
+}
+
+func (c *statsCache) get(key string) *StorageStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats, ok := c.items[key]
+	if !ok || time.Since(stats.GeneratedAt) > statsCacheTime {
+		return nil
+	}
+
+	return stats
+}
+
+func (c *statsCache) set(key string, stats *StorageStats) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k, s := range c.items {
+		if time.Since(s.GeneratedAt) > statsCacheTime {
+			delete(c.items, k)
+		}
+	}
+
+	c.items[key] = stats
+}
+
+func (c *CoreApi) countLocalStats(query *StatsQuery) (*StorageStats, error) {
+	machineId := c.addressManager.GetSelfMachineID()
+	stats := &StorageStats{
+		MachineId:   machineId,
+		MaxSize:     c.config.GetMaxLogFileSizeOfMB() * 1024 * 1024,
+		GeneratedAt: time.Now(),
+	}
+
+	var err error
+	stats.ByStatus, err = c.data.CountLogsByStatus(machineId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, count := range stats.ByStatus {
+		if count.Status == data.Saved {
+			stats.Files = count.Files
+			stats.Size = count.Size
+		}
+	}
+
+	stats.RemainingSize = stats.MaxSize - stats.Size
+	if stats.RemainingSize < 0 {
+		stats.RemainingSize = 0
+	}
+
+	from := time.Unix(query.From, 0)
+	to := time.Unix(query.To, 0)
+	stats.ByTag, err = c.data.CountQuotaUsage(&data.QuotaUsageQuery{
+		TagKey:    query.TagKey,
+		Since:     from,
+		MachineId: machineId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Largest, err = c.data.FindLargestLogs(machineId, statsLargestSize)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets, err := c.data.CountLogSizes(machineId, from, to, query.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	// 数据库只返回有日志的分桶，这里补齐空分桶
+	stats.Uploads = make([]*UploadBucket, 0, (query.To-query.From)/query.Interval+1)
+	for t := query.From; t < query.To; t += query.Interval {
+		stats.Uploads = append(stats.Uploads, &UploadBucket{Time: t})
+	}
+
+	for _, b := range buckets {
+		if b.Bucket < 0 || int(b.Bucket) >= len(stats.Uploads) {
+			continue
+		}
+
+		stats.Uploads[b.Bucket].Files += b.Files
+		stats.Uploads[b.Bucket].Size += b.Size
+	}
+
+	stats.finish()
+	return stats, nil
+}
+
+func (c *CoreApi) getLocalStats(query *StatsQuery) (*StorageStats, error) {
+	key := query.cacheKey()
+	stats := c.statsCache.get(key)
+	if stats != nil {
+		return stats, nil
+	}
+
+	stats, err := c.countLocalStats(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.statsCache.set(key, stats)
+	return stats, nil
+}
+
+// GetStorageStats 返回每个节点和整个集群的存储统计，各节点的统计会缓存 statsCacheTime
+func (c *CoreApi) GetStorageStats(query *StatsQuery) (*StatsResult, error) {
+	res := &StatsResult{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.GetStorageStats", query, res)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(res.Nodes, func(i, j int) bool {
+		return res.Nodes[i].MachineId < res.Nodes[j].MachineId
+	})
+
+	res.Cluster = &StorageStats{
+		ByStatus: []*data.StatusCount{},
+		ByTag:    []*data.QuotaUsage{},
+		Uploads:  []*UploadBucket{},
+		Largest:  []*data.LogData{},
+	}
+	for _, node := range res.Nodes {
+		res.Cluster.merge(node)
+	}
+
+	res.Cluster.finish()
+	return res, nil
+}
+
+func (r *RcpCoreApi) GetStorageStats(_ *http.Request, req *StatsQuery, res *StatsResult) error {
+	stats, err := r.core.getLocalStats(req)
+	if err != nil {
+		return err
+	}
+
+	res.Nodes = []*StorageStats{stats}
+	return nil
+}
@@ -0,0 +1,151 @@
+package route
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+)
+
+func (c *CoreApi) TrashFile(fileId string, operator string) error {
+	return c.data.TrashLog(fileId, operator)
+}
+
+// TrashLogGroup 返回 false 表示本机没有该日志组
+func (c *CoreApi) TrashLogGroup(groupId string, operator string) (bool, error) {
+	logGroup, err := c.data.FindLogGroup(groupId)
+	if err != nil || logGroup == nil {
+		return false, err
+	}
+
+	return true, c.data.TrashLogGroup(groupId, operator)
+}
+
+func (c *CoreApi) RestoreFile(fileId string) error {
+	log, err := c.data.FindTrashedLogByFileId(fileId)
+	if err != nil {
+		return err
+	}
+
+	if log == nil {
+		return fmt.Errorf("file %s not found in trash", fileId)
+	}
+
+	return c.data.RestoreLog(fileId)
+}
+
+// RestoreLogGroup 返回 false 表示本机回收站中没有该日志组
+func (c *CoreApi) RestoreLogGroup(groupId string) (bool, error) {
+	logGroup, err := c.data.FindTrashedLogGroup(groupId)
+	if err != nil || logGroup == nil {
+		return false, err
+	}
+
+	return true, c.data.RestoreLogGroup(groupId)
+}
+
+func (c *CoreApi) PurgeFile(fileId string) error {
+	log, err := c.data.FindTrashedLogByFileId(fileId)
+	if err != nil {
+		return err
+	}
+
+	if log == nil {
+		return fmt.Errorf("file %s not found in trash", fileId)
+	}
+
+	return c.purgeFile(fileId)
+}
+
+func (c *CoreApi) purgeFile(fileId string) error {
+	// 相同内容重新上传后会生成相同的 fileId，此时文件仍被使用，只删除回收站记录
+	exist, err := c.data.FindLogByFileId(fileId)
+	if err != nil {
+		return err
+	}
+
+	if exist == nil {
+		err = c.storage.RemoveLog(fileId)
+		if err != nil {
+			return err
+		}
+
+		err = c.data.DeleteNotesByFileId(fileId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.data.PurgeLogByFileId(fileId)
+}
+
+// PurgeLogGroup 返回 false 表示本机回收站中没有该日志组
+func (c *CoreApi) PurgeLogGroup(groupId string) (bool, error) {
+	logGroup, err := c.data.FindTrashedLogGroup(groupId)
+	if err != nil || logGroup == nil {
+		return false, err
+	}
+
+	return true, c.purgeLogGroup(logGroup)
+}
+
+func (c *CoreApi) purgeLogGroup(logGroup *data.LogGroup) error {
+	for _, l := range logGroup.Logs {
+		// 组内已被单独恢复的日志不随日志组一起删除
+		if l.TrashedAt == nil {
+			continue
+		}
+
+		err := c.purgeFile(l.FileId)
+		if err != nil {
+			return err
+		}
+	}
+
+	exist, err := c.data.FindLogGroup(logGroup.GroupId)
+	if err != nil {
+		return err
+	}
+
+	if exist == nil {
+		err = c.data.DeleteNotesByGroupId(logGroup.GroupId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.data.PurgeLogGroupByGroupId(logGroup.GroupId)
+}
+
+func (c *CoreApi) CleanTrash() error {
+	before := time.Now().Add(-time.Duration(c.trashLifeOfHour) * time.Hour)
+	logGroups, err := c.data.FindExpiredTrashLogGroups(before, 100)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range logGroups {
+		err := c.purgeLogGroup(g)
+		if err != nil {
+			log.Errorf("purge log group %s error %s", g.GroupId, err.Error())
+			continue
+		}
+		log.Infof("purge log group %s name %s trashed by %s at %s", g.GroupId, g.Name, g.TrashedBy, g.TrashedAt.String())
+	}
+
+	logs, err := c.data.FindExpiredTrashLogs(before, 1000)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range logs {
+		err := c.purgeFile(l.FileId)
+		if err != nil {
+			log.Errorf("purge file %s error %s", l.FileId, err.Error())
+			continue
+		}
+		log.Infof("purge file %s name %s trashed by %s at %s", l.FileId, l.Name, l.TrashedBy, l.TrashedAt.String())
+	}
+
+	return nil
+}
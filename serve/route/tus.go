@@ -0,0 +1,486 @@
+package route
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/serve/common"
+	"github.com/HuolalaTech/page-spy-api/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tusVersion       = "1.0.0"
+	tusExtension     = "creation,creation-with-upload,expiration,termination"
+	tusDirPath       = "./data/tus"
+	tusContentType   = "application/offset+octet-stream"
+	tusUploadPath    = "/api/v1/log/tus/"
+	headerFileId     = "X-File-Id"
+	headerTusVersion = "Tus-Version"
+)
+
+// TusError 断点续传接口需要按协议返回对应的状态码
+type TusError struct {
+	Status  int
+	Message string
+}
+
+func (e *TusError) Error() string {
+	return e.Message
+}
+
+func newTusError(status int, msg string, a ...any) *TusError {
+	return &TusError{
+		Status:  status,
+		Message: fmt.Sprintf(msg, a...),
+	}
+}
+
+// TusUpload 断点续传的上传状态，和分片数据一起保存在本机的暂存目录中
+type TusUpload struct {
+	Id        string         `json:"id"`
+	Length    int64          `json:"length"`
+	Offset    int64          `json:"offset"`
+	Name      string         `json:"name"`
+	GroupId   string         `json:"groupId"`
+	Tags      []*storage.Tag `json:"tags"`
+	FileId    string         `json:"fileId"`
+	CreatedAt time.Time      `json:"createdAt"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+}
+
+func (u *TusUpload) Finished() bool {
+	return u.FileId != ""
+}
+
+type TusManager struct {
+	lock sync.Mutex
+	busy map[string]bool
+}
+
+func NewTusManager() *TusManager {
+	return &TusManager{
+		busy: map[string]bool{},
+	}
+}
+
+// acquire 同一个上传同时只处理一个请求
+func (m *TusManager) acquire(id string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.busy[id] {
+		return false
+	}
+
+	m.busy[id] = true
+	return true
+}
+
+func (m *TusManager) release(id string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.busy, id)
+}
+
+func tusInfoPath(id string) string {
+	return filepath.Join(tusDirPath, id+".json")
+}
+
+func tusDataPath(id string) string {
+	return filepath.Join(tusDirPath, id+".bin")
+}
+
+func checkTusId(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return newTusError(http.StatusNotFound, "upload %s not found", id)
+	}
+
+	return nil
+}
+
+func loadTusUpload(id string) (*TusUpload, error) {
+	err := checkTusId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := os.ReadFile(tusInfoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newTusError(http.StatusNotFound, "upload %s not found", id)
+		}
+
+		return nil, err
+	}
+
+	upload := &TusUpload{}
+	err = json.Unmarshal(bs, upload)
+	if err != nil {
+		return nil, fmt.Errorf("read upload %s info error: %w", id, err)
+	}
+
+	return upload, nil
+}
+
+func saveTusUpload(upload *TusUpload) error {
+	bs, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免中断时留下不完整的状态
+	tmp := tusInfoPath(upload.Id) + ".tmp"
+	err = os.WriteFile(tmp, bs, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, tusInfoPath(upload.Id))
+}
+
+func removeTusUpload(id string) error {
+	err := os.Remove(tusDataPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Remove(tusInfoPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// parseTusMetadata 解析 Upload-Metadata，格式为逗号分隔的 key base64(value)
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, newTusError(http.StatusBadRequest, "upload metadata %s is not base64", key)
+		}
+
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func hasTag(tags []*storage.Tag, key string) bool {
+	for _, t := range tags {
+		if t.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *CoreApi) tusMaxSize() int64 {
+	return c.config.GetTusMaxSizeOfMB() * 1024 * 1024
+}
+
+func (c *CoreApi) tusExpiresAt() time.Time {
+	return time.Now().Add(time.Duration(c.config.GetTusLifeTimeOfHour()) * time.Hour)
+}
+
+// CreateTusUpload 创建上传，metadata 中的 filename 和 groupId 为文件名和日志组，其余字段与 query 一起作为标签，同名时以 query 为准
+func (c *CoreApi) CreateTusUpload(length int64, metadata map[string]string, tags []*storage.Tag) (*TusUpload, error) {
+	if length < 0 {
+		return nil, newTusError(http.StatusBadRequest, "Upload-Length is required")
+	}
+
+	if length > c.tusMaxSize() {
+		return nil, newTusError(http.StatusRequestEntityTooLarge, "upload size %d is larger than %dmb", length, c.config.GetTusMaxSizeOfMB())
+	}
+
+	upload := &TusUpload{
+		Id:        c.CreateRecordId(),
+		Length:    length,
+		Tags:      tags,
+		CreatedAt: time.Now(),
+		ExpiresAt: c.tusExpiresAt(),
+	}
+	for k, v := range metadata {
+		switch k {
+		case "filename", "name":
+			upload.Name = v
+		case "groupId":
+			upload.GroupId = v
+		case "filetype", "type":
+		default:
+			if !include(blackTagName, k) && !hasTag(tags, k) {
+				upload.Tags = append(upload.Tags, &storage.Tag{Key: k, Value: v})
+			}
+		}
+	}
+
+	// 压缩包解压后的大小只会更大，这里先按上传大小提前拒绝超出配额的上传
+	err := c.CheckUploadQuota(upload.Tags, length)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(tusDirPath, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(tusDataPath(upload.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	file.Close()
+	err = saveTusUpload(upload)
+	if err != nil {
+		removeTusUpload(upload.Id)
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// GetTusUpload 查询上传进度，已过期的上传会被删除
+func (c *CoreApi) GetTusUpload(id string) (*TusUpload, error) {
+	upload, err := loadTusUpload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.ExpiresAt.Before(time.Now()) {
+		removeTusUpload(id)
+		return nil, newTusError(http.StatusGone, "upload %s expired", id)
+	}
+
+	return upload, nil
+}
+
+// WriteTusUpload 从 offset 处追加分片，连接中断时保留已收到的数据，全部收到后保存日志
+func (c *CoreApi) WriteTusUpload(id string, offset int64, body io.Reader) (*TusUpload, error) {
+	if !c.tusManager.acquire(id) {
+		return nil, newTusError(http.StatusLocked, "upload %s is being written by another request", id)
+	}
+
+	defer c.tusManager.release(id)
+	upload, err := c.GetTusUpload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Finished() {
+		return upload, nil
+	}
+
+	if offset != upload.Offset {
+		return nil, newTusError(http.StatusConflict, "upload offset is %d, got %d", upload.Offset, offset)
+	}
+
+	file, err := os.OpenFile(tusDataPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+	_, err = file.Seek(upload.Offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多读一个字节用于判断分片是否超出 Upload-Length
+	remain := upload.Length - upload.Offset
+	n, copyErr := io.Copy(file, io.LimitReader(body, remain+1))
+	if n > remain {
+		err = file.Truncate(upload.Length)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, newTusError(http.StatusRequestEntityTooLarge, "upload data is larger than Upload-Length %d", upload.Length)
+	}
+
+	upload.Offset += n
+	upload.ExpiresAt = c.tusExpiresAt()
+	err = saveTusUpload(upload)
+	if err != nil {
+		return nil, err
+	}
+
+	if copyErr != nil {
+		return nil, fmt.Errorf("read upload %s data error: %w", id, copyErr)
+	}
+
+	if upload.Offset < upload.Length {
+		return upload, nil
+	}
+
+	return upload, c.finishTusUpload(upload)
+}
+
+// finishTusUpload 走和普通上传相同的校验和保存流程，失败时保留数据，客户端可以重新发送空的 PATCH 重试
+func (c *CoreApi) finishTusUpload(upload *TusUpload) error {
+	content, err := os.ReadFile(tusDataPath(upload.Id))
+	if err != nil {
+		return err
+	}
+
+	// 断点续传的大小由 tusMaxSizeOfMB 限制，解压后使用同样的上限
+	file, err := newUploadLog(c, upload.Name, upload.Tags, content, c.tusMaxSize())
+	if err != nil {
+		return err
+	}
+
+	if upload.GroupId != "" {
+		groupFile, err := c.CreateLogGroupFile(&storage.LogGroupFile{
+			LogFile: *file,
+			GroupId: upload.GroupId,
+		})
+		if err != nil {
+			return err
+		}
+
+		upload.FileId = groupFile.FileId
+	} else {
+		file, err = c.CreateFile(file)
+		if err != nil {
+			return err
+		}
+
+		upload.FileId = file.FileId
+	}
+
+	// 保留上传状态到过期，客户端重新查询时可以知道已经完成
+	err = saveTusUpload(upload)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(tusDataPath(upload.Id))
+}
+
+func (c *CoreApi) DeleteTusUpload(id string) error {
+	if !c.tusManager.acquire(id) {
+		return newTusError(http.StatusLocked, "upload %s is being written by another request", id)
+	}
+
+	defer c.tusManager.release(id)
+	_, err := loadTusUpload(id)
+	if err != nil {
+		return err
+	}
+
+	return removeTusUpload(id)
+}
+
+// CleanTusUpload 删除过期的上传
+func (c *CoreApi) CleanTusUpload() error {
+	entries, err := os.ReadDir(tusDirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !c.tusManager.acquire(id) {
+			continue
+		}
+
+		upload, err := loadTusUpload(id)
+		if err != nil {
+			log.Errorf("load upload %s error %s", id, err.Error())
+		} else if upload.ExpiresAt.Before(time.Now()) {
+			err = removeTusUpload(id)
+			if err != nil {
+				log.Errorf("remove upload %s error %s", id, err.Error())
+			}
+		}
+
+		c.tusManager.release(id)
+	}
+
+	return nil
+}
+
+func setTusHeaders(c echo.Context, upload *TusUpload) {
+	h := c.Response().Header()
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	h.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Finished() {
+		h.Set(headerFileId, upload.FileId)
+	}
+}
+
+// tusError 协议错误直接返回对应状态码，其余错误交给错误中间件处理
+func tusError(c echo.Context, err error) error {
+	e, ok := err.(*TusError)
+	if !ok {
+		return err
+	}
+
+	return c.JSON(e.Status, common.NewErrorResponseWithCode(e.Message, room.ClientError))
+}
+
+// tusMachine 上传保存在创建它的节点上，不在本机时清除已设置的协议头再转发，避免响应头重复
+func tusMachine(c echo.Context, core *CoreApi) (string, error) {
+	id := c.Param("id")
+	machine, err := core.GetMachineIdByFileName(id)
+	if err != nil {
+		return "", newTusError(http.StatusNotFound, "upload %s not found", id)
+	}
+
+	if !core.IsSelfMachine(machine) {
+		c.Response().Header().Del("Tus-Resumable")
+		c.Response().Header().Del("Cache-Control")
+	}
+
+	return machine, nil
+}
+
+// tusMiddleware 所有响应都带上 Tus-Resumable，除 OPTIONS 外要求客户端使用相同的协议版本
+func tusMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Tus-Resumable", tusVersion)
+		c.Response().Header().Set("Cache-Control", "no-store")
+		if c.Request().Method != http.MethodOptions && c.Request().Header.Get("Tus-Resumable") != tusVersion {
+			c.Response().Header().Set(headerTusVersion, tusVersion)
+			return tusError(c, newTusError(http.StatusPreconditionFailed, "Tus-Resumable %s is required", tusVersion))
+		}
+
+		return next(c)
+	}
+}
+
+func getTusOffset(c echo.Context) (int64, error) {
+	if c.Request().Header.Get(echo.HeaderContentType) != tusContentType {
+		return 0, newTusError(http.StatusUnsupportedMediaType, "Content-Type should be %s", tusContentType)
+	}
+
+	offset, err := strconv.ParseInt(c.Request().Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, newTusError(http.StatusBadRequest, "Upload-Offset is invalid")
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,226 @@
+package route
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// LogFormatUnknown 未校验或无法识别的日志
+	LogFormatUnknown = 0
+	// LogFormatV1 顶层为日志条目数组
+	LogFormatV1 = 1
+	// LogFormatV2 顶层为包含 meta 和 data 的对象，data 为日志条目数组
+	LogFormatV2 = 2
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// logEntry 离线日志中的单条记录，只校验 type 和 timestamp，data 按原样保留
+type logEntry struct {
+	Type      *string         `json:"type"`
+	Timestamp *float64        `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type logDocument struct {
+	Version *int            `json:"version"`
+	Meta    json.RawMessage `json:"meta"`
+	Data    *[]*logEntry    `json:"data"`
+}
+
+// limitReader 读取的内容超过 limit 时返回错误，避免过大的请求或压缩炸弹占满内存
+type limitReader struct {
+	reader io.Reader
+	read   int64
+	limit  int64
+}
+
+func newLimitReader(reader io.Reader, limit int64) *limitReader {
+	return &limitReader{
+		reader: io.LimitReader(reader, limit+1),
+		limit:  limit,
+	}
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		return n, newUploadSizeError(r.limit)
+	}
+
+	return n, err
+}
+
+func newUploadSizeError(limit int64) error {
+	return room.NewQuotaExceededError("upload content is larger than %dmb", limit/1024/1024)
+}
+
+type limitReadCloser struct {
+	*limitReader
+	io.Closer
+}
+
+// unwrapRoomError 表单解析会包装读取请求体时的错误，取出原始错误以返回对应的状态码
+func unwrapRoomError(err error) error {
+	var re *room.Error
+	if errors.As(err, &re) {
+		return re
+	}
+
+	return err
+}
+
+// decodeRequestBody 处理 Content-Encoding: gzip 的请求并限制请求体大小，需要在读取表单或请求体之前调用
+func (c *CoreApi) decodeRequestBody(ctx echo.Context) error {
+	req := ctx.Request()
+	limit := c.maxUploadSize()
+	encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+	switch encoding {
+	case "", "identity":
+		if req.ContentLength > limit {
+			return newUploadSizeError(limit)
+		}
+
+		req.Body = &limitReadCloser{
+			limitReader: newLimitReader(req.Body, limit),
+			Closer:      req.Body,
+		}
+		return nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return room.NewUnsupportedEncodingError("read gzip request body error: %s", err.Error())
+		}
+
+		req.Body = &limitReadCloser{
+			limitReader: newLimitReader(reader, limit),
+			Closer:      reader,
+		}
+		req.ContentLength = -1
+		req.Header.Del(echo.HeaderContentEncoding)
+		req.Header.Del(echo.HeaderContentLength)
+		return nil
+	default:
+		return room.NewUnsupportedEncodingError("content encoding %s is not supported, use gzip", encoding)
+	}
+}
+
+func (c *CoreApi) maxUploadSize() int64 {
+	return c.config.GetMaxUploadSizeOfMB() * 1024 * 1024
+}
+
+// decompressLog 日志文件本身是 gzip 压缩包时解压，解压前后的内容都不能超过 limit
+func decompressLog(bs []byte, limit int64) ([]byte, error) {
+	if int64(len(bs)) > limit {
+		return nil, newUploadSizeError(limit)
+	}
+
+	if !bytes.HasPrefix(bs, gzipMagic) {
+		return bs, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(bs))
+	if err != nil {
+		return nil, room.NewUnsupportedEncodingError("read gzip log file error: %s", err.Error())
+	}
+
+	defer reader.Close()
+	content, err := io.ReadAll(newLimitReader(reader, limit))
+	if err != nil {
+		var re *room.Error
+		if errors.As(err, &re) {
+			return nil, re
+		}
+
+		return nil, room.NewUnsupportedEncodingError("read gzip log file error: %s", err.Error())
+	}
+
+	return content, nil
+}
+
+func validateLogEntries(entries []*logEntry) error {
+	for i, entry := range entries {
+		if entry == nil {
+			return room.NewInvalidLogError("log entry %d is not an object", i)
+		}
+
+		if entry.Type == nil || *entry.Type == "" {
+			return room.NewInvalidLogError("log entry %d missing type", i)
+		}
+
+		if entry.Timestamp == nil {
+			return room.NewInvalidLogError("log entry %d missing timestamp", i)
+		}
+	}
+
+	return nil
+}
+
+// detectLogFormat 校验离线日志内容并返回格式版本
+func detectLogFormat(bs []byte) (int, error) {
+	content := bytes.TrimLeft(bs, " \t\r\n")
+	if bytes.HasPrefix(content, []byte("\xef\xbb\xbf")) {
+		content = content[3:]
+	}
+
+	if len(content) <= 0 {
+		return LogFormatUnknown, room.NewInvalidLogError("log content is empty")
+	}
+
+	switch content[0] {
+	case '[':
+		var entries []*logEntry
+		err := json.Unmarshal(content, &entries)
+		if err != nil {
+			return LogFormatUnknown, room.NewInvalidLogError("log content is not a valid log entry array: %s", err.Error())
+		}
+
+		return LogFormatV1, validateLogEntries(entries)
+	case '{':
+		doc := &logDocument{}
+		err := json.Unmarshal(content, doc)
+		if err != nil {
+			return LogFormatUnknown, room.NewInvalidLogError("log content is not a valid log object: %s", err.Error())
+		}
+
+		if doc.Data == nil {
+			return LogFormatUnknown, room.NewInvalidLogError("log object missing data array")
+		}
+
+		if doc.Version != nil && *doc.Version > LogFormatV2 {
+			return LogFormatUnknown, room.NewInvalidLogError("log format version %d is not supported", *doc.Version)
+		}
+
+		return LogFormatV2, validateLogEntries(*doc.Data)
+	default:
+		return LogFormatUnknown, room.NewInvalidLogError("log content is not json")
+	}
+}
+
+// ParseLogContent 解压并校验上传的日志，返回保存的内容和格式版本，limit 为解压后的大小上限
+func (c *CoreApi) ParseLogContent(bs []byte, limit int64) ([]byte, int, error) {
+	content, err := decompressLog(bs, limit)
+	if err != nil {
+		return nil, LogFormatUnknown, err
+	}
+
+	if c.config.SkipUploadValidation {
+		return content, LogFormatUnknown, nil
+	}
+
+	version, err := detectLogFormat(content)
+	if err != nil {
+		return nil, LogFormatUnknown, err
+	}
+
+	return content, version, nil
+}
@@ -0,0 +1,347 @@
+package route
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/serve/common"
+	selfMiddleware "github.com/HuolalaTech/page-spy-api/serve/middleware"
+	"github.com/HuolalaTech/page-spy-api/storage"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	uploadKeyQuery     = "uploadKey"
+	headerUploadKey    = "X-Upload-Key"
+	uploadKeyCacheTime = time.Minute
+	// uploadKeyCacheSize 超过后不再缓存不存在的密钥，防止随机密钥撑大缓存
+	uploadKeyCacheSize = 10000
+	// uploadKeyRejectContext 上传密钥校验失败的原因，限流之后再拒绝请求
+	uploadKeyRejectContext = "uploadKeyReject"
+	// uploadKeyProjectContext 校验通过的密钥所属的项目
+	uploadKeyProjectContext = "uploadKeyProject"
+)
+
+type UploadKeyRequest struct {
+	Name    string   `json:"name"`
+	Project string   `json:"project"`
+	Origins []string `json:"origins"`
+}
+
+func hashUploadKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type uploadKeyCacheItem struct {
+	key      *data.UploadKey
+	cachedAt time.Time
+}
+
+// uploadKeyCache 缓存密钥查询结果，避免每次上传都跨节点查询，不存在的密钥也会缓存
+type uploadKeyCache struct {
+	lock  sync.Mutex
+	items map[string]*uploadKeyCacheItem
+}
+
+func newUploadKeyCache() *uploadKeyCache {
+	return &uploadKeyCache{
+		items: map[string]*uploadKeyCacheItem{},
+	}
+}
+
+func (c *uploadKeyCache) get(keyHash string) (*data.UploadKey, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	item, ok := c.items[keyHash]
+	if !ok || time.Since(item.cachedAt) > uploadKeyCacheTime {
+		return nil, false
+	}
+
+	return item.key, true
+}
+
+func (c *uploadKeyCache) set(keyHash string, key *data.UploadKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k, item := range c.items {
+		if time.Since(item.cachedAt) > uploadKeyCacheTime {
+			delete(c.items, k)
+		}
+	}
+
+	if key == nil && len(c.items) >= uploadKeyCacheSize {
+		return
+	}
+
+	c.items[keyHash] = &uploadKeyCacheItem{key: key, cachedAt: time.Now()}
+}
+
+func (c *uploadKeyCache) remove(keyId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k, item := range c.items {
+		if item.key != nil && item.key.KeyId == keyId {
+			delete(c.items, k)
+		}
+	}
+}
+
+func normalizeOrigins(origins []string) ([]string, error) {
+	result := []string{}
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return nil, fmt.Errorf("origin %s should be scheme://host[:port]", origin)
+		}
+
+		result = append(result, strings.ToLower(origin))
+	}
+
+	return result, nil
+}
+
+// CreateUploadKey 创建上传密钥，密钥格式为 machineId.随机值，明文只在返回结果中出现一次
+func (c *CoreApi) CreateUploadKey(req *UploadKeyRequest, operator string) (*data.UploadKey, error) {
+	project := strings.TrimSpace(req.Project)
+	if project == "" {
+		return nil, fmt.Errorf("project is required")
+	}
+
+	origins, err := normalizeOrigins(req.Origins)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 24)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	machineId := c.addressManager.GetSelfMachineID()
+	secretHex := hex.EncodeToString(secret)
+	plain := fmt.Sprintf("%s.%s", machineId, secretHex)
+	key := &data.UploadKey{
+		Model: data.Model{
+			UpdatedAt: time.Now(),
+			CreatedAt: time.Now(),
+		},
+		KeyId:     c.CreateRecordId(),
+		Name:      req.Name,
+		Project:   project,
+		Origins:   origins,
+		KeyHash:   hashUploadKey(plain),
+		KeyPrefix: fmt.Sprintf("%s.%s", machineId, secretHex[:6]),
+		CreatedBy: operator,
+	}
+
+	err = c.data.CreateUploadKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Key = plain
+	return key, nil
+}
+
+func (c *CoreApi) GetUploadKeyList(query *data.UploadKeyListQuery) (*data.Page[*data.UploadKey], error) {
+	res := &data.Page[*data.UploadKey]{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindUploadKeys", query, res)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Desc()
+	res.UniqData()
+	return res, nil
+}
+
+func (c *CoreApi) RevokeUploadKey(keyId string) error {
+	key, err := c.data.FindUploadKey(keyId)
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		return fmt.Errorf("upload key %s not found", keyId)
+	}
+
+	err = c.data.RevokeUploadKey(keyId)
+	if err != nil {
+		return err
+	}
+
+	c.uploadKeyCache.remove(keyId)
+	return nil
+}
+
+// FindUploadKey 到创建密钥的节点查询密钥，结果缓存 uploadKeyCacheTime，其它节点上的撤销最迟在缓存过期后生效
+func (c *CoreApi) FindUploadKey(key string) (*data.UploadKey, error) {
+	machine, err := c.GetMachineIdByFileName(key)
+	if err != nil {
+		return nil, nil
+	}
+
+	keyHash := hashUploadKey(key)
+	uploadKey, ok := c.uploadKeyCache.get(keyHash)
+	if ok {
+		return uploadKey, nil
+	}
+
+	if c.IsSelfMachine(machine) {
+		uploadKey, err = c.data.FindUploadKeyByHash(keyHash)
+	} else {
+		client := c.rpcManager.GetRpcByMachineID(machine)
+		if client == nil {
+			return nil, nil
+		}
+
+		res := &UploadKeyResponse{}
+		err = client.Call(context.Background(), "CoreApi.FindUploadKeyByHash", &UploadKeyHashRequest{KeyHash: keyHash}, res)
+		uploadKey = res.Key
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.uploadKeyCache.set(keyHash, uploadKey)
+	return uploadKey, nil
+}
+
+// requestOrigin 优先使用 Origin，没有时从 Referer 中取
+func requestOrigin(r *http.Request) string {
+	origin := r.Header.Get(echo.HeaderOrigin)
+	if origin != "" {
+		return origin
+	}
+
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+type uploadKeyReject struct {
+	status  int
+	message string
+	code    string
+}
+
+// uploadKeyMiddleware 校验上传密钥并把日志标记为密钥所属的项目，校验结果由 requireUploadKeyMiddleware 处理，
+// 两者之间的限流中间件按校验通过的密钥 ID 限流
+func uploadKeyMiddleware(core *CoreApi) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(headerUploadKey)
+			if key == "" {
+				key = c.QueryParam(uploadKeyQuery)
+			}
+
+			if key == "" {
+				if core.config.NotAllowedAnonymousUpload {
+					c.Set(uploadKeyRejectContext, &uploadKeyReject{http.StatusUnauthorized, "Upload key not provided", "MISSING_UPLOAD_KEY"})
+				}
+
+				return next(c)
+			}
+
+			uploadKey, err := core.FindUploadKey(key)
+			if err != nil {
+				return err
+			}
+
+			if uploadKey == nil || !uploadKey.IsValid() {
+				c.Set(uploadKeyRejectContext, &uploadKeyReject{http.StatusUnauthorized, "Upload key revoked or invalid", "INVALID_UPLOAD_KEY"})
+				return next(c)
+			}
+
+			if !uploadKey.AllowOrigin(requestOrigin(c.Request())) {
+				c.Set(uploadKeyRejectContext, &uploadKeyReject{http.StatusForbidden, "Origin not allowed for this upload key", "ORIGIN_NOT_ALLOWED"})
+				return next(c)
+			}
+
+			c.Set(selfMiddleware.ContextUploadKeyID, uploadKey.KeyId)
+			c.Set(uploadKeyProjectContext, uploadKey.Project)
+			return next(c)
+		}
+	}
+}
+
+// requireUploadKeyMiddleware 拒绝 uploadKeyMiddleware 校验失败的请求
+func requireUploadKeyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		reject, ok := c.Get(uploadKeyRejectContext).(*uploadKeyReject)
+		if ok {
+			return c.JSON(reject.status, common.NewErrorResponseWithCode(reject.message, reject.code))
+		}
+
+		return next(c)
+	}
+}
+
+// getUploadTags 上传日志的标签，使用密钥时按配额的 tagKey 打上密钥所属的项目，覆盖客户端传入的同名标签
+func getUploadTags(c echo.Context, core *CoreApi) []*storage.Tag {
+	tags := getTags(c.QueryParams())
+	project, ok := c.Get(uploadKeyProjectContext).(string)
+	if !ok {
+		return tags
+	}
+
+	tagKey := core.config.QuotaConfig.GetTagKey()
+	result := []*storage.Tag{}
+	for _, t := range tags {
+		if t.Key != tagKey {
+			result = append(result, t)
+		}
+	}
+
+	return append(result, &storage.Tag{Key: tagKey, Value: project})
+}
+
+type UploadKeyHashRequest struct {
+	KeyHash string
+}
+
+type UploadKeyResponse struct {
+	Key *data.UploadKey
+}
+
+func (r *RcpCoreApi) FindUploadKeyByHash(_ *http.Request, req *UploadKeyHashRequest, res *UploadKeyResponse) error {
+	key, err := r.core.data.FindUploadKeyByHash(req.KeyHash)
+	if err != nil {
+		return err
+	}
+
+	res.Key = key
+	return nil
+}
+
+func (r *RcpCoreApi) FindUploadKeys(_ *http.Request, req *data.UploadKeyListQuery, res *data.Page[*data.UploadKey]) error {
+	page, err := r.core.data.FindUploadKeys(req)
+	if err != nil {
+		return err
+	}
+
+	res.Data = page.Data
+	res.Total = page.Total
+	return nil
+}
@@ -0,0 +1,533 @@
+package route
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/data"
+	"github.com/HuolalaTech/page-spy-api/hook"
+	"github.com/HuolalaTech/page-spy-api/metric"
+	"github.com/HuolalaTech/page-spy-api/rpc"
+	"github.com/HuolalaTech/page-spy-api/storage"
+)
+
+const (
+	webhookQueueSize = 1024
+	webhookBatchSize = 100
+	// 同时进行的投递数，单个 webhook 最多占用一半，响应慢的 webhook 不会阻塞其它 webhook
+	webhookWorkers        = 8
+	webhookWorkersPerHook = webhookWorkers / 2
+	webhookRetryInterval  = 5 * time.Second
+	webhookMinBackoff     = 30 * time.Second
+	webhookMaxBackoff     = time.Hour
+	// 投递失败时记录的响应内容长度
+	webhookErrorSize = 512
+
+	headerWebhookEvent     = "X-PageSpy-Event"
+	headerWebhookDelivery  = "X-PageSpy-Delivery"
+	headerWebhookTimestamp = "X-PageSpy-Timestamp"
+	headerWebhookSignature = "X-PageSpy-Signature"
+)
+
+// WebhookPayload 推送的请求体，同一事件推送给不同 webhook 时 id 相同，接收方可以用来去重
+type WebhookPayload struct {
+	Id        string            `json:"id"`
+	Type      string            `json:"type"`
+	MachineId string            `json:"machineId"`
+	Tags      map[string]string `json:"tags"`
+	Data      json.RawMessage   `json:"data"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type webhookSubscription struct {
+	hook   *config.Webhook
+	events map[string]bool
+	tags   []*storage.Tag
+}
+
+func (s *webhookSubscription) match(payload *WebhookPayload) bool {
+	if !s.events[payload.Type] {
+		return false
+	}
+
+	for _, tag := range s.tags {
+		if payload.Tags[tag.Key] != tag.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newWebhookSubscription(w *config.Webhook) (*webhookSubscription, error) {
+	if w.Name == "" {
+		return nil, fmt.Errorf("webhook name is required")
+	}
+
+	u, err := url.Parse(w.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook %s url %s should be http or https", w.Name, w.Url)
+	}
+
+	sub := &webhookSubscription{
+		hook:   w,
+		events: map[string]bool{},
+		tags:   []*storage.Tag{},
+	}
+	events := w.Events
+	if len(events) <= 0 {
+		events = hook.DefaultEventTypes
+	}
+
+	for _, e := range events {
+		if !hook.IsEventType(e) {
+			return nil, fmt.Errorf("webhook %s event %s is not supported, use one of %s", w.Name, e, strings.Join(hook.EventTypes, ", "))
+		}
+
+		sub.events[e] = true
+	}
+
+	for _, t := range w.Tags {
+		key, value, ok := strings.Cut(t, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("webhook %s tag %s format error, expect key=value", w.Name, t)
+		}
+
+		sub.tags = append(sub.tags, &storage.Tag{Key: key, Value: value})
+	}
+
+	return sub, nil
+}
+
+// webhookBackoff 第 n 次失败后的等待时间，从 webhookMinBackoff 开始翻倍，最长 webhookMaxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookMinBackoff
+	for i := 1; i < attempts && delay < webhookMaxBackoff; i++ {
+		delay = delay * 2
+	}
+
+	return min(delay, webhookMaxBackoff)
+}
+
+// signWebhook 签名内容为 timestamp.body，接收方需要同时校验时间戳防止重放
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookManager 把事件写入数据库中的投递队列，再由另一个后台协程按退避时间投递，重启后未完成的投递会继续
+type WebhookManager struct {
+	config         *config.WebhookConfig
+	data           data.DataApi
+	addressManager *rpc.AddressManager
+	subscriptions  []*webhookSubscription
+	events         chan *WebhookPayload
+	wakeup         chan struct{}
+	client         *http.Client
+	lock           sync.Mutex
+	// inflight 正在投递的记录，inflightHook 是每个 webhook 正在投递的数量
+	inflight     map[string]bool
+	inflightHook map[string]int
+}
+
+func NewWebhookManager(c *config.Config, data data.DataApi, addressManager *rpc.AddressManager) (*WebhookManager, error) {
+	m := &WebhookManager{
+		config:         c.WebhookConfig,
+		data:           data,
+		addressManager: addressManager,
+		subscriptions:  []*webhookSubscription{},
+		events:         make(chan *WebhookPayload, webhookQueueSize),
+		wakeup:         make(chan struct{}, 1),
+		inflight:       map[string]bool{},
+		inflightHook:   map[string]int{},
+		client: &http.Client{
+			Timeout: time.Duration(c.WebhookConfig.GetTimeoutOfSecond()) * time.Second,
+		},
+	}
+
+	names := map[string]bool{}
+	for _, w := range c.WebhookConfig.GetHooks() {
+		sub, err := newWebhookSubscription(w)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[w.Name] {
+			return nil, fmt.Errorf("webhook name %s is duplicated", w.Name)
+		}
+
+		names[w.Name] = true
+		m.subscriptions = append(m.subscriptions, sub)
+	}
+
+	return m, nil
+}
+
+func (m *WebhookManager) Enabled() bool {
+	return len(m.subscriptions) > 0
+}
+
+func (m *WebhookManager) Start() {
+	names := []string{}
+	for _, sub := range m.subscriptions {
+		names = append(names, sub.hook.Name)
+	}
+
+	err := m.data.FailRemovedWebhookDeliveries(m.addressManager.GetSelfMachineID(), names)
+	if err != nil {
+		log.Errorf("fail removed webhook deliveries error %s", err.Error())
+	}
+
+	go m.enqueueLoop()
+	go m.deliverLoop()
+}
+
+func (m *WebhookManager) createId() string {
+	return fmt.Sprintf("%s.%s", m.addressManager.GetSelfMachineID(), m.addressManager.GeneratorLocalID())
+}
+
+// Emit 在调用方的协程中序列化事件数据，队列满时丢弃事件
+func (m *WebhookManager) Emit(event *hook.Event) {
+	eventData, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Errorf("marshal webhook event %s error %s", event.Type, err.Error())
+		return
+	}
+
+	tags := map[string]string{}
+	for k, v := range event.Tags {
+		tags[k] = v
+	}
+
+	payload := &WebhookPayload{
+		Id:        m.createId(),
+		Type:      event.Type,
+		MachineId: m.addressManager.GetSelfMachineID(),
+		Tags:      tags,
+		Data:      eventData,
+		CreatedAt: event.CreatedAt,
+	}
+
+	select {
+	case m.events <- payload:
+	default:
+		metric.Count("webhook_drop", map[string]string{
+			"event": event.Type,
+		}, 1)
+		log.Errorf("webhook queue is full, drop event %s", payload.Id)
+	}
+}
+
+func (m *WebhookManager) notify() {
+	select {
+	case m.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueLoop 只写数据库，投递由 deliverLoop 完成，网络请求不会阻塞事件入队
+func (m *WebhookManager) enqueueLoop() {
+	for payload := range m.events {
+		err := m.enqueue(payload)
+		if err != nil {
+			log.Errorf("enqueue webhook event %s error %s", payload.Id, err.Error())
+			continue
+		}
+
+		m.notify()
+	}
+}
+
+func (m *WebhookManager) deliverLoop() {
+	ticker := time.NewTicker(webhookRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.wakeup:
+		case <-ticker.C:
+		}
+
+		err := m.deliverDue()
+		if err != nil {
+			log.Errorf("deliver webhook error %s", err.Error())
+		}
+	}
+}
+
+// enqueue 为每个匹配的 webhook 生成一条待投递记录
+func (m *WebhookManager) enqueue(payload *WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := []*data.WebhookDelivery{}
+	for _, sub := range m.subscriptions {
+		if !sub.match(payload) {
+			continue
+		}
+
+		deliveries = append(deliveries, &data.WebhookDelivery{
+			Model: data.Model{
+				UpdatedAt: now,
+				CreatedAt: now,
+			},
+			DeliveryId:    m.createId(),
+			EventId:       payload.Id,
+			Event:         payload.Type,
+			Webhook:       sub.hook.Name,
+			MachineId:     payload.MachineId,
+			Payload:       string(body),
+			Status:        data.DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+
+	return m.data.CreateWebhookDeliveries(deliveries)
+}
+
+func (m *WebhookManager) deliverDue() error {
+	// 按 webhook 分别查询，一个 webhook 积压的投递不会挤占其它 webhook
+	for _, sub := range m.subscriptions {
+		deliveries, err := m.data.FindDueWebhookDeliveries(m.addressManager.GetSelfMachineID(), sub.hook.Name, time.Now(), webhookWorkers)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			if !m.acquire(delivery) {
+				continue
+			}
+
+			go func(delivery *data.WebhookDelivery) {
+				defer m.release(delivery)
+				delivery, err := m.reload(delivery)
+				if err != nil {
+					log.Errorf("find webhook delivery %s error %s", delivery.DeliveryId, err.Error())
+					return
+				}
+
+				if delivery == nil {
+					return
+				}
+
+				m.deliver(delivery)
+				err = m.data.UpdateWebhookDelivery(delivery)
+				if err != nil {
+					log.Errorf("update webhook delivery %s error %s", delivery.DeliveryId, err.Error())
+				}
+			}(delivery)
+		}
+	}
+
+	return nil
+}
+
+// acquire 正在投递的记录状态还没有更新，再次查询到时跳过，避免重复推送
+func (m *WebhookManager) acquire(delivery *data.WebhookDelivery) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.inflight[delivery.DeliveryId] || len(m.inflight) >= webhookWorkers || m.inflightHook[delivery.Webhook] >= webhookWorkersPerHook {
+		return false
+	}
+
+	m.inflight[delivery.DeliveryId] = true
+	m.inflightHook[delivery.Webhook]++
+	return true
+}
+
+// release 投递结束后立即查询下一批，不用等待重试间隔
+func (m *WebhookManager) release(delivery *data.WebhookDelivery) {
+	m.lock.Lock()
+	delete(m.inflight, delivery.DeliveryId)
+	m.inflightHook[delivery.Webhook]--
+	m.lock.Unlock()
+	m.notify()
+}
+
+// reload 查询到记录后可能被重新投递重置，取得投递权后重新读取，避免旧数据覆盖重置后的状态
+func (m *WebhookManager) reload(delivery *data.WebhookDelivery) (*data.WebhookDelivery, error) {
+	latest, err := m.data.FindWebhookDelivery(delivery.DeliveryId)
+	if err != nil {
+		return delivery, err
+	}
+
+	if latest == nil || latest.Status != data.DeliveryPending || latest.NextAttemptAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	return latest, nil
+}
+
+func (m *WebhookManager) findSubscription(name string) *webhookSubscription {
+	for _, sub := range m.subscriptions {
+		if sub.hook.Name == name {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+// deliver 投递一次并更新记录状态，2xx 视为成功，其它情况按退避时间重试，超过最大次数后标记为失败
+func (m *WebhookManager) deliver(delivery *data.WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.LastError = ""
+
+	sub := m.findSubscription(delivery.Webhook)
+	if sub == nil {
+		delivery.Status = data.DeliveryFailed
+		delivery.LastError = fmt.Sprintf("webhook %s is removed from config", delivery.Webhook)
+		return
+	}
+
+	status, err := m.post(sub.hook, delivery)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = data.DeliverySuccess
+		return
+	}
+
+	delivery.LastError = err.Error()
+	metric.Count("webhook_delivery_error", map[string]string{
+		"webhook": delivery.Webhook,
+	}, 1)
+	if delivery.Attempts >= m.config.GetMaxAttempts() {
+		delivery.Status = data.DeliveryFailed
+		log.Errorf("webhook %s delivery %s failed after %d attempts, %s", delivery.Webhook, delivery.DeliveryId, delivery.Attempts, delivery.LastError)
+		return
+	}
+
+	delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+}
+
+func (m *WebhookManager) post(w *config.Webhook, delivery *data.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PageSpy-Webhook")
+	req.Header.Set(headerWebhookEvent, delivery.Event)
+	req.Header.Set(headerWebhookDelivery, delivery.DeliveryId)
+	req.Header.Set(headerWebhookTimestamp, timestamp)
+	if w.Secret != "" {
+		req.Header.Set(headerWebhookSignature, signWebhook(w.Secret, timestamp, body))
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	content, _ := io.ReadAll(io.LimitReader(res.Body, webhookErrorSize))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("response status %d, %s", res.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	return res.StatusCode, nil
+}
+
+// Redeliver 重置投递状态并立即重新投递，已经成功的投递也可以重新推送
+func (m *WebhookManager) Redeliver(deliveryId string) (*data.WebhookDelivery, error) {
+	delivery, err := m.reset(deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	m.notify()
+	return delivery, nil
+}
+
+// reset 只能在投递所属的节点上执行，持有锁保证重置期间不会开始投递，正在投递的记录拒绝重置
+func (m *WebhookManager) reset(deliveryId string) (*data.WebhookDelivery, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.inflight[deliveryId] {
+		return nil, fmt.Errorf("webhook delivery %s is being delivered, please retry later", deliveryId)
+	}
+
+	delivery, err := m.data.FindWebhookDelivery(deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	if delivery == nil {
+		return nil, fmt.Errorf("webhook delivery %s not found", deliveryId)
+	}
+
+	if delivery.MachineId != m.addressManager.GetSelfMachineID() {
+		return nil, fmt.Errorf("webhook delivery %s belongs to machine %s", deliveryId, delivery.MachineId)
+	}
+
+	if m.findSubscription(delivery.Webhook) == nil {
+		return nil, fmt.Errorf("webhook %s is removed from config", delivery.Webhook)
+	}
+
+	delivery.Status = data.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	return delivery, m.data.UpdateWebhookDelivery(delivery)
+}
+
+func (c *CoreApi) CleanWebhookDelivery() error {
+	lifeTime := time.Duration(c.config.WebhookConfig.GetLogLifeTimeOfHour()) * time.Hour
+	return c.data.PurgeWebhookDeliveries(c.addressManager.GetSelfMachineID(), time.Now().Add(-lifeTime))
+}
+
+func (c *CoreApi) GetWebhookDeliveries(query *data.WebhookDeliveryQuery) (*data.Page[*data.WebhookDelivery], error) {
+	res := &data.Page[*data.WebhookDelivery]{}
+	err := rpc.CallAllClient(c.rpcManager, context.Background(), "CoreApi.FindWebhookDeliveries", query, res)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Desc()
+	res.UniqData()
+	return res, nil
+}
+
+func (c *CoreApi) RedeliverWebhook(deliveryId string) (*data.WebhookDelivery, error) {
+	if !c.webhookManager.Enabled() {
+		return nil, fmt.Errorf("webhook is not configured")
+	}
+
+	return c.webhookManager.Redeliver(deliveryId)
+}
+
+func (r *RcpCoreApi) FindWebhookDeliveries(_ *http.Request, req *data.WebhookDeliveryQuery, res *data.Page[*data.WebhookDelivery]) error {
+	page, err := r.core.data.FindWebhookDeliveries(req)
+	if err != nil {
+		return err
+	}
+
+	res.Data = page.Data
+	res.Total = page.Total
+	return nil
+}
@@ -0,0 +1,97 @@
+package socket
+
+import (
+	"fmt"
+	"net/http"
+
+	eventApi "github.com/HuolalaTech/page-spy-api/api/event"
+	roomApi "github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/metric"
+	"github.com/HuolalaTech/page-spy-api/serve/common"
+)
+
+func getRoomAddress(r *http.Request) (*eventApi.Address, error) {
+	id := r.URL.Query().Get("address")
+	if id == "" {
+		return nil, fmt.Errorf("'address' cannot be empty")
+	}
+
+	return eventApi.NewAddressFromID(id)
+}
+
+// GetRoomDetail 房间详情由房间所在节点返回
+func (s *WebSocket) GetRoomDetail(rw http.ResponseWriter, r *http.Request) {
+	address, err := getRoomAddress(r)
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	detail, err := s.roomManager.GetRoomDetail(r.Context(), &roomApi.Info{Address: address})
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	writeResponse(rw, common.NewSuccessResponse(detail))
+}
+
+// CloseRoom 关闭房间，operator 记录在日志中
+func (s *WebSocket) CloseRoom(rw http.ResponseWriter, r *http.Request, operator string) {
+	address, err := getRoomAddress(r)
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "closed by admin"
+	}
+
+	err = s.roomManager.CloseRoom(r.Context(), &roomApi.Info{Address: address}, reason)
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	metric.Count("tunnel_room_admin", map[string]string{"action": "close"}, 1)
+	joinLog.Infof("room %s closed by %s, %s", address.ID, operator, reason)
+	writeResponse(rw, common.NewSuccessResponse(true))
+}
+
+// KickConnection 断开房间中的一个连接，operator 记录在日志中
+func (s *WebSocket) KickConnection(rw http.ResponseWriter, r *http.Request, operator string) {
+	address, err := getRoomAddress(r)
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	id := r.URL.Query().Get("connection")
+	if id == "" {
+		writeResponse(rw, common.NewErrorResponse(fmt.Errorf("'connection' cannot be empty")))
+		return
+	}
+
+	connectionAddress, err := eventApi.NewAddressFromID(id)
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+
+	err = s.roomManager.KickConnection(r.Context(), &roomApi.Info{Address: address}, &roomApi.Connection{Address: connectionAddress}, reason)
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	metric.Count("tunnel_room_admin", map[string]string{"action": "kick"}, 1)
+	joinLog.Infof("connection %s of room %s kicked by %s, %s", id, address.ID, operator, reason)
+	writeResponse(rw, common.NewSuccessResponse(true))
+}
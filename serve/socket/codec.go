@@ -0,0 +1,107 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	roomApi "github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	JSONSubprotocol    = "page-spy.json"
+	MsgpackSubprotocol = "page-spy.msgpack"
+)
+
+// codec 连接使用的消息编码，房间和节点之间的消息始终是 JSON，只在收发时转换
+type codec interface {
+	frameType() int
+	encode(data interface{}) ([]byte, error)
+	decode(data []byte, msg *roomApi.RawMessage) error
+}
+
+func newCodec(subprotocol string) codec {
+	if subprotocol == MsgpackSubprotocol {
+		return &msgpackCodec{}
+	}
+
+	return &jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) frameType() int {
+	return websocket.TextMessage
+}
+
+func (c *jsonCodec) encode(data interface{}) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (c *jsonCodec) decode(data []byte, msg *roomApi.RawMessage) error {
+	return json.Unmarshal(data, msg)
+}
+
+type msgpackCodec struct{}
+
+func (c *msgpackCodec) frameType() int {
+	return websocket.BinaryMessage
+}
+
+func (c *msgpackCodec) encode(data interface{}) ([]byte, error) {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpack.Marshal(fromJSONValue(value))
+}
+
+func (c *msgpackCodec) decode(data []byte, msg *roomApi.RawMessage) error {
+	var value interface{}
+	err := msgpack.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("msgpack message can not convert to json, %w", err)
+	}
+
+	return json.Unmarshal(bs, msg)
+}
+
+// fromJSONValue 整数保持为整数，避免 float64 丢失精度
+func fromJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		i, err := v.Int64()
+		if err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = fromJSONValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJSONValue(item)
+		}
+	}
+
+	return value
+}
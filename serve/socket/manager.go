@@ -1,19 +1,110 @@
 package socket
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	roomApi "github.com/HuolalaTech/page-spy-api/api/room"
 	"github.com/HuolalaTech/page-spy-api/config"
+	"github.com/HuolalaTech/page-spy-api/data"
 	"github.com/HuolalaTech/page-spy-api/event"
+	"github.com/HuolalaTech/page-spy-api/hook"
 	"github.com/HuolalaTech/page-spy-api/logger"
 	"github.com/HuolalaTech/page-spy-api/room"
 	"github.com/HuolalaTech/page-spy-api/rpc"
 	"github.com/HuolalaTech/page-spy-api/util"
 )
 
-func NewManager(config *config.Config, rpcManager *rpc.RpcManager, addressManager *rpc.AddressManager) (*room.RemoteRpcRoomManager, error) {
+func NewManager(config *config.Config, rpcManager *rpc.RpcManager, addressManager *rpc.AddressManager, data data.DataApi) (*room.RemoteRpcRoomManager, error) {
 	localEvent := event.NewLocalEventEmitter(addressManager, rpcManager)
-	localRoomManager := room.NewLocalRoomManager(localEvent, addressManager, int64(config.GetMaxRoomNumber()))
+	reconnectGrace := time.Duration(config.GetRoomReconnectGraceOfSecond()) * time.Second
+	roomConfig := config.RoomConfig
+	timeouts := &room.TimeoutConfig{
+		Default: roomApi.Timeouts{
+			EmptyTimeoutOfSecond: roomConfig.GetEmptyTimeoutOfSecond(),
+			IdleTimeoutOfSecond:  roomConfig.GetIdleTimeoutOfSecond(),
+			LifeTimeOfSecond:     roomConfig.GetLifeTimeOfSecond(),
+		},
+		Max: roomApi.Timeouts{
+			EmptyTimeoutOfSecond: roomConfig.GetMaxEmptyTimeoutOfSecond(),
+			IdleTimeoutOfSecond:  roomConfig.GetMaxIdleTimeoutOfSecond(),
+			LifeTimeOfSecond:     roomConfig.GetMaxLifeTimeOfSecond(),
+		},
+		RemoteIdle: time.Duration(roomConfig.GetRemoteIdleTimeoutOfSecond()) * time.Second,
+	}
+
+	replayConfig := roomConfig.GetReplay()
+	replay := &room.ReplayConfig{
+		Enabled:     replayConfig != nil && replayConfig.Enabled,
+		MaxMessages: replayConfig.GetMaxMessages(),
+		MaxSize:     replayConfig.GetMaxSizeOfKB() * 1024,
+		MaxAge:      time.Duration(replayConfig.GetMaxAgeOfSecond()) * time.Second,
+		UserIds:     map[string]bool{},
+	}
+	for _, userId := range replayConfig.GetUserIds() {
+		replay.UserIds[userId] = true
+	}
+
+	recordConfig := roomConfig.GetRecord()
+	record := &room.RecordConfig{
+		Tags:    []*room.RecordTag{},
+		MaxSize: recordConfig.GetMaxSizeOfMB() * 1024 * 1024,
+	}
+	for _, t := range recordConfig.GetTags() {
+		key, value, ok := strings.Cut(t, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("room record tag %s format error, expect key=value", t)
+		}
+
+		record.Tags = append(record.Tags, &room.RecordTag{Key: key, Value: value})
+	}
+
+	queueConfig := roomConfig.GetQueue()
+	queue := &room.QueueConfig{
+		Size:      queueConfig.GetSize(),
+		Policy:    queueConfig.GetPolicy(),
+		DropTypes: map[string]bool{},
+	}
+	err := room.CheckQueuePolicy(queue.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range queueConfig.GetDropTypes() {
+		queue.DropTypes[t] = true
+	}
+
+	rolesConfig := roomConfig.GetRoles()
+	roles := &room.RoleConfig{
+		ClientUserIds: map[string]bool{},
+		DebuggerAuth:  rolesConfig != nil && rolesConfig.DebuggerAuth,
+	}
+	for _, userId := range rolesConfig.GetClientUserIds() {
+		roles.ClientUserIds[userId] = true
+	}
+
+	var permissions map[string][]string
+	if rolesConfig != nil {
+		permissions = rolesConfig.Permissions
+	}
+
+	roles.Permissions, err = room.NewPermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	localRoomManager := room.NewLocalRoomManager(localEvent, addressManager, int64(config.GetMaxRoomNumber()), data, reconnectGrace, timeouts, replay, record, roles)
+	err = localRoomManager.Restore(context.Background())
+	if err != nil {
+		logger.Log().WithError(err).Error("restore rooms failed")
+	}
+
 	localRoomManager.Start()
-	_, err := event.NewRpcEventEmitter(localEvent, rpcManager)
+	_, err = event.NewRpcEventEmitter(localEvent, rpcManager)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +114,11 @@ func NewManager(config *config.Config, rpcManager *rpc.RpcManager, addressManage
 		return nil, err
 	}
 
-	manager := room.NewRemoteRpcRoomManager(addressManager, rpcManager, localEvent, localRoomManager)
+	stream := room.NewRoomStream(localEvent, addressManager)
+	hook.AddHook(stream)
+	stream.Start()
+
+	manager := room.NewRemoteRpcRoomManager(addressManager, rpcManager, localEvent, localRoomManager, timeouts, queue, roles, stream)
 	manager.Start()
 	logger.Log().Infof("start rpc server %s successful", addressManager.GetSelfMachineID())
 	logger.Log().Infof("local ip %s:%s", util.GetLocalIP(), config.Port)
@@ -1,6 +1,7 @@
 package socket
 
 import (
+	"compress/flate"
 	"context"
 	"encoding/json"
 	"errors"
@@ -14,6 +15,7 @@ import (
 
 	eventApi "github.com/HuolalaTech/page-spy-api/api/event"
 	roomApi "github.com/HuolalaTech/page-spy-api/api/room"
+	"github.com/HuolalaTech/page-spy-api/config"
 	"github.com/HuolalaTech/page-spy-api/logger"
 	"github.com/HuolalaTech/page-spy-api/metric"
 	"github.com/HuolalaTech/page-spy-api/room"
@@ -46,10 +48,17 @@ func writeResponse(w http.ResponseWriter, res *common.Response) {
 type socket struct {
 	rwLock sync.RWMutex
 	conn   *websocket.Conn
+	codec  codec
+	// 小于该大小的消息不压缩，0 表示不压缩
+	compressThreshold int
 }
 
-func (s *socket) WriteMessage(messageType int, data []byte) error {
-	return s.conn.WriteMessage(messageType, data)
+func newSocket(conn *websocket.Conn, compressThreshold int) *socket {
+	return &socket{
+		conn:              conn,
+		codec:             newCodec(conn.Subprotocol()),
+		compressThreshold: compressThreshold,
+	}
 }
 
 func (s *socket) WriteDataIgnoreError(data interface{}) {
@@ -63,22 +72,41 @@ func (s *socket) WriteDataIgnoreError(data interface{}) {
 func (s *socket) WriteData(data interface{}) error {
 	s.rwLock.Lock()
 	defer s.rwLock.Unlock()
-	bs, err := json.Marshal(data)
+	bs, err := s.codec.encode(data)
 	if err != nil {
 		return roomApi.NewMessageContentError("send message marshal error %s", err.Error())
 	}
 
-	return s.conn.WriteMessage(websocket.TextMessage, bs)
+	s.conn.EnableWriteCompression(s.compressThreshold > 0 && len(bs) >= s.compressThreshold)
+	return s.conn.WriteMessage(s.codec.frameType(), bs)
 }
 
-func (s *socket) WriteJSON(v interface{}) error {
-	s.rwLock.Lock()
-	defer s.rwLock.Unlock()
-	return s.conn.WriteJSON(v)
+// close 发送关闭帧后断开连接
+func (s *socket) close(reason string) {
+	err := s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason), time.Now().Add(time.Second))
+	if err != nil {
+		joinLog.WithError(err).Debug("write close frame error")
+	}
+
+	s.conn.Close()
 }
 
-func (s *socket) ReadJSON(v interface{}) error {
-	return s.conn.ReadJSON(v)
+// ReadMessage 文本帧按 JSON 解析，二进制帧需要协商 MessagePack 子协议
+func (s *socket) ReadMessage(msg *roomApi.RawMessage) error {
+	messageType, bs, err := s.conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	if messageType == websocket.TextMessage {
+		return json.Unmarshal(bs, msg)
+	}
+
+	if s.conn.Subprotocol() != MsgpackSubprotocol {
+		return fmt.Errorf("binary message requires subprotocol %s", MsgpackSubprotocol)
+	}
+
+	return s.codec.decode(bs, msg)
 }
 
 func (s *socket) writeWebsocketError(errRes error) {
@@ -87,25 +115,19 @@ func (s *socket) writeWebsocketError(errRes error) {
 		return
 	}
 
-	err := s.WriteJSON(message)
+	err := s.WriteData(message)
 	if err != nil {
 		joinLog.WithError(err).Error("write websocket  message error")
 	}
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
-
-func (s *WebSocket) readClientMessage(ctx context.Context, socket *socket, room roomApi.RemoteRoom) error {
+func (s *WebSocket) readClientMessage(ctx context.Context, socket *socket, connection *roomApi.Connection, room roomApi.RemoteRoom) error {
 	if room.IsClose() {
 		return roomApi.NewRoomCloseError("room %s is already close", room.GetRoomAddress().ID)
 	}
 
 	rawMsg := &roomApi.RawMessage{}
-	err := socket.ReadJSON(rawMsg)
+	err := socket.ReadMessage(rawMsg)
 	if err != nil {
 		return roomApi.NewRoomCloseError("read message websocket error %s", err.Error())
 	}
@@ -122,6 +144,12 @@ func (s *WebSocket) readClientMessage(ctx context.Context, socket *socket, room
 		return nil
 	}
 
+	err = s.roomManager.Roles.CheckSend(connection, msg.Type)
+	if err != nil {
+		socket.writeWebsocketError(err)
+		return nil
+	}
+
 	log.Debugf("socket received %s", msg.Type)
 	metric.Count("server_read_message", map[string]string{
 		"type": msg.Type,
@@ -169,6 +197,7 @@ func onRoomMessage(ctx context.Context, socket *socket, room roomApi.RemoteRoom)
 		}, float64(now-msg.CreatedAt))
 		socket.WriteDataIgnoreError(msg)
 	case <-room.Done():
+		flushRoomMessages(socket, room)
 		return roomApi.NewRoomCloseError("room %s left", room.GetRoomAddress().ID)
 	case <-ctx.Done():
 		socket.writeWebsocketError(roomApi.NewNetWorkTimeoutError("room %s context cancel", room.GetRoomAddress().ID))
@@ -178,6 +207,18 @@ func onRoomMessage(ctx context.Context, socket *socket, room roomApi.RemoteRoom)
 	return nil
 }
 
+// flushRoomMessages 房间关闭后发出队列中剩余的消息，例如 close 消息
+func flushRoomMessages(socket *socket, room roomApi.RemoteRoom) {
+	for {
+		select {
+		case msg := <-room.OnMessage():
+			socket.WriteDataIgnoreError(msg)
+		default:
+			return
+		}
+	}
+}
+
 func (s *WebSocket) serveRoom(opt *roomApi.Info, connection *roomApi.Connection, socket *socket, room roomApi.RemoteRoom) {
 	retCode := "success"
 	close := func() {
@@ -227,7 +268,10 @@ func (s *WebSocket) serveRoom(opt *roomApi.Info, connection *roomApi.Connection,
 			case <-cancelCtx.Done():
 				return
 			case <-room.Done():
+				// 房间关闭或连接被踢出后发出剩余消息并主动断开，阻塞读取的循环随之退出
 				writeCode = "room_close"
+				flushRoomMessages(socket, room)
+				socket.close("room closed")
 				return
 			default:
 				err := onRoomMessage(cancelCtx, socket, room)
@@ -235,6 +279,9 @@ func (s *WebSocket) serveRoom(opt *roomApi.Info, connection *roomApi.Connection,
 					writeCode = "write_message_close"
 					socket.writeWebsocketError(err)
 					joinLog.WithField("connection", connection.Address.ID).Info(err)
+					if room.IsClose() {
+						socket.close("room closed")
+					}
 					return
 				}
 			}
@@ -249,7 +296,12 @@ func (s *WebSocket) serveRoom(opt *roomApi.Info, connection *roomApi.Connection,
 			retCode = "room_close"
 			return
 		default:
-			err := s.readClientMessage(cancelCtx, socket, room)
+			err := s.readClientMessage(cancelCtx, socket, connection, room)
+			if err != nil && room.IsClose() {
+				retCode = "room_close"
+				return
+			}
+
 			if err != nil {
 				retCode = "read_message_close"
 				socket.writeWebsocketError(err)
@@ -261,14 +313,37 @@ func (s *WebSocket) serveRoom(opt *roomApi.Info, connection *roomApi.Connection,
 
 }
 
-func NewWebSocket(rooManager *room.RemoteRpcRoomManager) *WebSocket {
-	return &WebSocket{
+func NewWebSocket(rooManager *room.RemoteRpcRoomManager, config *config.Config) (*WebSocket, error) {
+	compression := config.WebsocketConfig.GetCompression()
+	level := compression.GetLevel()
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("websocket compression level %d is invalid, it should be from %d to %d", level, flate.HuffmanOnly, flate.BestCompression)
+	}
+
+	s := &WebSocket{
 		roomManager: rooManager,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+			Subprotocols: []string{MsgpackSubprotocol, JSONSubprotocol},
+		},
 	}
+
+	if compression != nil && compression.Enabled {
+		s.upgrader.EnableCompression = true
+		s.compressionLevel = level
+		s.compressThreshold = compression.GetThresholdOfByte()
+	}
+
+	return s, nil
 }
 
 type WebSocket struct {
-	roomManager *room.RemoteRpcRoomManager
+	roomManager       *room.RemoteRpcRoomManager
+	upgrader          websocket.Upgrader
+	compressionLevel  int
+	compressThreshold int
 }
 
 type ListRoomParams struct {
@@ -303,6 +378,12 @@ func getTags(query url.Values) map[string]string {
 type RoomOptions struct {
 	Secret    string `json:"secret"`
 	UseSecret bool   `json:"useSecret"`
+	// 单个房间的超时设置，为 0 时使用默认值
+	roomApi.Timeouts
+	// 是否开启消息回放，不传时使用服务端配置
+	Replay *bool `json:"replay"`
+	// 是否录制房间，不传时按服务端的标签规则
+	Record *bool `json:"record"`
 }
 
 func (s *WebSocket) CreateRoom(rw http.ResponseWriter, r *http.Request) {
@@ -325,6 +406,9 @@ func (s *WebSocket) CreateRoom(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 	opt := roomApi.NewRoomInfo(name, secretOpt.Secret, secretOpt.UseSecret, tags, group, address)
+	opt.Timeouts = &secretOpt.Timeouts
+	opt.Replay = secretOpt.Replay
+	opt.Record = secretOpt.Record
 	_, err = s.roomManager.CreateLocalRoom(r.Context(), opt)
 	if err != nil {
 		writeResponse(rw, common.NewErrorResponse(err))
@@ -340,15 +424,23 @@ func (s *WebSocket) CreateRoom(rw http.ResponseWriter, r *http.Request) {
 	writeResponse(rw, common.NewSuccessResponse(opt))
 }
 
-func (s *WebSocket) JoinRoom(rw http.ResponseWriter, r *http.Request) {
+// JoinRoom authorized 表示请求带有有效的登录令牌，开启 debuggerAuth 后调试端需要登录
+func (s *WebSocket) JoinRoom(rw http.ResponseWriter, r *http.Request, authorized bool) {
 
-	conn, err := upgrader.Upgrade(rw, r, nil)
+	conn, err := s.upgrader.Upgrade(rw, r, nil)
 	if err != nil {
 		joinLog.Error(fmt.Errorf("websocket upgrader error%w", err))
 		return
 	}
 	defer conn.Close()
 
+	if s.upgrader.EnableCompression {
+		err = conn.SetCompressionLevel(s.compressionLevel)
+		if err != nil {
+			joinLog.WithError(err).Error("set websocket compression level error")
+		}
+	}
+
 	id := r.URL.Query().Get("address")
 	group := r.URL.Query().Get("group")
 	name := r.URL.Query().Get("name")
@@ -359,15 +451,23 @@ func (s *WebSocket) JoinRoom(rw http.ResponseWriter, r *http.Request) {
 		Secret:    r.URL.Query().Get("secret"),
 		UseSecret: r.URL.Query().Get("useSecret") == "true",
 	}
-	socket := &socket{conn: conn}
+	socket := newSocket(conn, s.compressThreshold)
 	if err != nil {
 		socket.writeWebsocketError(roomApi.NewRoomNotFoundError(err.Error()))
 		return
 	}
 
+	clientToken := r.URL.Query().Get("clientToken")
+	role, err := s.roomManager.Roles.Resolve(r.URL.Query().Get("role"), userId, authorized, clientToken)
+	if err != nil {
+		socket.writeWebsocketError(err)
+		return
+	}
+
 	connection := s.roomManager.CreateConnection()
 	connection.Name = name
 	connection.UserID = userId
+	connection.Role = role
 	joinOpt := &roomApi.Info{
 		BasicInfo: roomApi.BasicInfo{
 			Group: group,
@@ -375,10 +475,14 @@ func (s *WebSocket) JoinRoom(rw http.ResponseWriter, r *http.Request) {
 		Address: address,
 		Secret:  secretOpt.Secret,
 	}
+	if role == roomApi.ClientRole {
+		joinOpt.ClientToken = clientToken
+	}
 
 	var room roomApi.RemoteRoom
 	if forceCreate == "true" {
 		opt := roomApi.NewRoomInfo("", secretOpt.Secret, secretOpt.UseSecret, map[string]string{}, "", address)
+		opt.ClientToken = joinOpt.ClientToken
 		room, err = s.roomManager.ForceJoinRoom(r.Context(), connection, joinOpt, opt)
 	} else {
 		room, err = s.roomManager.JoinRoom(r.Context(), connection, joinOpt)
@@ -396,17 +500,34 @@ func (s *WebSocket) JoinRoom(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	msg := roomApi.NewConnectMessage(connection, users)
-	bs, err := json.Marshal(msg)
+	err = socket.WriteData(msg)
 	if err != nil {
-		joinLog.WithError(err).Error("send connect message marshal error")
+		joinLog.WithError(err).Error("send connect message error")
 	}
 
-	err = socket.WriteMessage(websocket.TextMessage, bs)
+	s.replayMessages(r.Context(), joinOpt, connection, socket)
+	s.serveRoom(joinOpt, connection, socket, room)
+}
+
+// replayMessages 紧跟 connect 消息补发加入前 SDK 广播的消息
+func (s *WebSocket) replayMessages(ctx context.Context, opt *roomApi.Info, connection *roomApi.Connection, socket *socket) {
+	messages, err := s.roomManager.GetReplayMessages(ctx, opt, connection)
 	if err != nil {
-		joinLog.WithError(err).Error("send connect message error")
+		joinLog.WithError(err).Errorf("get replay messages of room %s error", opt.Address.ID)
+		return
 	}
 
-	s.serveRoom(joinOpt, connection, socket, room)
+	for _, msg := range messages {
+		err = socket.WriteData(msg)
+		if err != nil {
+			joinLog.WithError(err).Error("send replay message error")
+			return
+		}
+	}
+
+	if len(messages) > 0 {
+		metric.Count("tunnel_room_replay", map[string]string{}, float64(len(messages)))
+	}
 }
 
 func (s *WebSocket) CheckRoomSecret(rw http.ResponseWriter, r *http.Request) {
@@ -433,7 +554,7 @@ func (s *WebSocket) CheckRoomSecret(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if secret == room.GetInfo().Secret {
+	if room.GetInfo().CheckSecret(secret) {
 		writeResponse(rw, common.NewSuccessResponse(nil))
 	} else {
 		writeResponse(rw, common.NewErrorResponse(fmt.Errorf("wrong secret")))
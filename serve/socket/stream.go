@@ -0,0 +1,154 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/HuolalaTech/page-spy-api/metric"
+	"github.com/HuolalaTech/page-spy-api/room"
+	"github.com/HuolalaTech/page-spy-api/serve/common"
+	"github.com/gorilla/websocket"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+// getStreamFilter token 和 types 之外的参数按房间标签过滤，和房间列表一致
+func getStreamFilter(query url.Values) (map[string]string, []string, error) {
+	types := []string{}
+	for _, t := range strings.Split(query.Get("types"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+
+		if !room.IsStreamEventType(t) {
+			return nil, nil, fmt.Errorf("room event %s is not supported, use one of %s", t, strings.Join(room.StreamEventTypes, ", "))
+		}
+
+		types = append(types, t)
+	}
+
+	tags := getTags(query)
+	delete(tags, "token")
+	delete(tags, "types")
+	return tags, types, nil
+}
+
+// StreamRooms 推送房间事件，WebSocket 升级请求使用 WebSocket，否则使用 SSE
+func (s *WebSocket) StreamRooms(rw http.ResponseWriter, r *http.Request) {
+	tags, types, err := getStreamFilter(r.URL.Query())
+	if err != nil {
+		writeResponse(rw, common.NewErrorResponse(err))
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.streamRoomsWebSocket(rw, r, tags, types)
+		return
+	}
+
+	s.streamRoomsSSE(rw, r, tags, types)
+}
+
+func (s *WebSocket) streamRoomsSSE(rw http.ResponseWriter, r *http.Request, tags map[string]string, types []string) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		writeResponse(rw, common.NewErrorResponse(errors.New("streaming is not supported")))
+		return
+	}
+
+	sub := s.roomManager.Stream.Subscribe(tags, types)
+	defer s.roomManager.Stream.Unsubscribe(sub)
+	metric.Count("tunnel_room_stream", map[string]string{"protocol": "sse"}, 1)
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprint(rw, "retry: 3000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case e := <-sub.Events():
+			var bs []byte
+			bs, err = json.Marshal(e)
+			if err != nil {
+				joinLog.WithError(err).Error("room stream event marshal error")
+				continue
+			}
+
+			_, err = fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", e.Type, bs)
+		case <-ticker.C:
+			_, err = fmt.Fprint(rw, ": ping\n\n")
+		}
+
+		if err != nil {
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (s *WebSocket) streamRoomsWebSocket(rw http.ResponseWriter, r *http.Request, tags map[string]string, types []string) {
+	conn, err := s.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		joinLog.Error(fmt.Errorf("websocket upgrader error%w", err))
+		return
+	}
+	defer conn.Close()
+
+	sub := s.roomManager.Stream.Subscribe(tags, types)
+	defer s.roomManager.Stream.Unsubscribe(sub)
+	metric.Count("tunnel_room_stream", map[string]string{"protocol": "websocket"}, 1)
+
+	// 客户端不发送消息，读取只用于处理控制帧和感知断开
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	socket := newSocket(conn, s.compressThreshold)
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done():
+			socket.close("room stream overflow")
+			return
+		case e := <-sub.Events():
+			err = socket.WriteData(e)
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+		}
+
+		if err != nil {
+			joinLog.WithError(err).Debug("room stream write error")
+			return
+		}
+	}
+}
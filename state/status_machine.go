@@ -9,6 +9,8 @@ const (
 	RunningStatus Status = 2
 	CloseStatus   Status = 3
 	ErrorStatus   Status = 4
+	// ReconnectStatus 重启后恢复的房间，等待原来的连接重新加入
+	ReconnectStatus Status = 5
 )
 
 func NewStatusMachine() *StatusMachine {
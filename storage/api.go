@@ -20,6 +20,8 @@ type LogFile struct {
 	Tags       []*Tag        `json:"tags"`
 	UpdateFile []byte        `json:"-"`
 	FileSteam  io.ReadCloser `json:"-"`
+	// FormatVersion 离线日志格式版本，0 表示未识别
+	FormatVersion int `json:"formatVersion"`
 }
 
 type LogGroupFile struct {
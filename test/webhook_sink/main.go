@@ -0,0 +1,89 @@
+// webhook_sink 本地接收 webhook 推送，校验签名并打印事件，用于调试 webhookConfig
+//
+//	go run ./test/webhook_sink -addr :9090 -secret my-secret -fail 2
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	secret := flag.String("secret", "", "webhook secret, skip signature check when empty")
+	fail := flag.Int64("fail", 0, "respond 500 to the first n requests to test retries")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "max age of the signature timestamp")
+	flag.Parse()
+
+	var count int64
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&count, 1)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		event := r.Header.Get("X-PageSpy-Event")
+		delivery := r.Header.Get("X-PageSpy-Delivery")
+		timestamp := r.Header.Get("X-PageSpy-Timestamp")
+		if *secret != "" {
+			err = verify(*secret, timestamp, r.Header.Get("X-PageSpy-Signature"), body, *tolerance)
+			if err != nil {
+				log.Printf("#%d %s %s rejected: %s", n, event, delivery, err.Error())
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		pretty := &bytes.Buffer{}
+		if json.Indent(pretty, body, "", "  ") != nil {
+			pretty.Reset()
+			pretty.Write(body)
+		}
+
+		if n <= *fail {
+			log.Printf("#%d %s %s failed on purpose", n, event, delivery)
+			http.Error(w, "sink failure", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("#%d %s %s\n%s", n, event, delivery, pretty.String())
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("webhook sink listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp %s is out of tolerance", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}